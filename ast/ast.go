@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/masp/garlang/lexer"
@@ -115,9 +117,10 @@ func (g *CommentGroup) Text() string {
 }
 
 type Module struct {
-	File  *token.File
-	Id    *Identifier
-	Decls []Decl
+	File     *token.File
+	Id       *Identifier   // module name, which is also the name of the Erlang module
+	Segments []*Identifier // segments of a dotted name like `module a.b.c`; or nil
+	Decls    []Decl
 
 	Imports []*ImportDecl
 	Scope   *Scope // this module only
@@ -131,6 +134,69 @@ func (p *Module) End() token.Pos {
 	return p.File.Pos(p.File.Size)
 }
 
+// Func returns the function declared with name and arity, if any.
+func (p *Module) Func(name string, arity int) (*FuncDecl, bool) {
+	for _, decl := range p.Decls {
+		if fn, ok := decl.(*FuncDecl); ok && fn.Name.Name == name && len(fn.Parameters) == arity {
+			return fn, true
+		}
+	}
+	return nil, false
+}
+
+// Type returns the type declared with name, if any.
+func (p *Module) Type(name string) (*TypeDecl, bool) {
+	for _, decl := range p.Decls {
+		if typ, ok := decl.(*TypeDecl); ok && typ.Name.Name == name {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+// Dependencies returns the modules p depends on, sorted: the path of every import and
+// every other module called like `lists.map(f, xs)`, including Erlang's own modules. A
+// call through an imported module is covered by the path of its import.
+func (p *Module) Dependencies() []string {
+	deps := make(map[string]bool)
+	imported := make(map[string]bool) // names the imported modules are called by
+	for _, decl := range p.Decls {
+		if imp, ok := decl.(*ImportDecl); ok {
+			deps[imp.Path.Value] = true
+			imported[path.Base(imp.Path.Value)] = true
+			if imp.Alias != nil {
+				imported[imp.Alias.Name] = true
+			}
+		}
+	}
+	Inspect(p, func(node Node) bool {
+		call, ok := node.(*CallExpr)
+		if !ok {
+			return true
+		}
+		if dot, ok := call.Callee.(*DotExpr); ok {
+			var name string
+			switch target := dot.Target.(type) {
+			case *Identifier:
+				name = target.Name
+			case *AtomLiteral:
+				name = target.Value
+			}
+			if name != "" && !imported[name] {
+				deps[name] = true
+			}
+		}
+		return true
+	})
+
+	list := make([]string, 0, len(deps))
+	for dep := range deps {
+		list = append(list, dep)
+	}
+	sort.Strings(list)
+	return list
+}
+
 type Decl interface {
 	Node
 	isDeclaration()
@@ -140,6 +206,9 @@ type ImportDecl struct {
 	Import token.Pos      // `import` keyword
 	Alias  *Identifier    // name to import (default to last element of path). Can be nil.
 	Path   *StringLiteral // value of import
+	LParen token.Pos      // or NoPos if no functions are imported
+	Funcs  []*ImportedFunc
+	RParen token.Pos
 }
 
 func (i *ImportDecl) isDeclaration() {}
@@ -148,12 +217,53 @@ func (i *ImportDecl) Pos() token.Pos {
 	return i.Import
 }
 func (i *ImportDecl) End() token.Pos {
+	if i.RParen.IsValid() {
+		return i.RParen + 1
+	}
 	return i.Path.End()
 }
 
+// ImportedFunc is a function imported by name, like `foo/1` in `import "mod" (foo/1)`,
+// which can then be called without the module.
+type ImportedFunc struct {
+	Name  *Identifier
+	Slash token.Pos
+	Arity *IntLiteral
+}
+
+func (f *ImportedFunc) isNode() {}
+func (f *ImportedFunc) Pos() token.Pos {
+	return f.Name.Pos()
+}
+func (f *ImportedFunc) End() token.Pos {
+	return f.Arity.End()
+}
+
+// Annotation adds metadata to the declaration after it, like `@inline` or
+// `@deprecated("use g")`.
+type Annotation struct {
+	At     token.Pos // '@'
+	Name   *Identifier
+	LParen token.Pos    // '(' if there are arguments; or NoPos
+	Args   []Expression // arguments in parentheses, if any
+	RParen token.Pos    // ')' if there are arguments; or NoPos
+}
+
+func (a *Annotation) isNode() {}
+func (a *Annotation) Pos() token.Pos {
+	return a.At
+}
+func (a *Annotation) End() token.Pos {
+	if a.RParen != token.NoPos {
+		return a.RParen + 1
+	}
+	return a.Name.End()
+}
+
 // TypeDecl defines a new type, and looks like `[export] type <name> <definition>`
 type TypeDecl struct {
-	Type token.Pos // `type` keyword
+	Annotations []*Annotation // annotations before the declaration
+	Type        token.Pos     // `type` keyword
 
 	Name       *Identifier // the new type name
 	Definition Expression  // the type value
@@ -168,10 +278,13 @@ func (t *TypeDecl) End() token.Pos {
 	return t.Definition.End()
 }
 
+// ConstDecl defines a module level constant, and looks like `const <name> = <value>`.
+// The value must be a constant expression: literals, other constants and operators on them.
 type ConstDecl struct {
-	Const      token.Pos   // `const` keyword
-	Identifier *Identifier // left hand of assignment
-	Value      Literal     // right hand of assignment
+	Const  token.Pos   // `const` keyword
+	Name   *Identifier // left hand of assignment
+	Equals token.Pos
+	Value  Expression // right hand of assignment
 }
 
 func (c *ConstDecl) isDeclaration() {}
@@ -183,13 +296,41 @@ func (c *ConstDecl) End() token.Pos {
 	return c.Value.End()
 }
 
-type FuncDecl struct {
-	Func       token.Pos // `func` keyword
-	LeftBrace  token.Pos // `{` and `}` token
-	RightBrace token.Pos
+// GuardDecl is a reusable guard like `guard even(x) = x % 2 == 0`. Erlang guards can't
+// call functions, so every call of a guard is replaced with its body.
+type GuardDecl struct {
+	Guard      token.Pos   // `guard` keyword
+	Name       *Identifier // guard name
+	Parameters []*Identifier
+	Equals     token.Pos
+	Body       Expression // a guard test
+}
 
-	Name       *Identifier   // function name
-	Parameters []*Identifier // function parameters
+func (g *GuardDecl) isDeclaration() {}
+func (g *GuardDecl) isNode()        {}
+func (g *GuardDecl) Pos() token.Pos {
+	return g.Guard
+}
+func (g *GuardDecl) End() token.Pos {
+	return g.Body.End()
+}
+
+// FuncDecl is a function declaration like `func f(x) when x > 0 { ... }`. Its parameters
+// and guard are the head of a clause, and the guard is parsed like the guard of a case or
+// receive Clause. FuncDecl doesn't hold a Clause, though: the body of a function is a
+// list of statements, not an expression, and a function without parameters has no
+// pattern for Clause.Pos to start at. Consecutive declarations with the same name and
+// arity are the clauses of one function.
+type FuncDecl struct {
+	Doc         *CommentGroup // associated documentation; or nil
+	Annotations []*Annotation // annotations before the declaration
+	Func        token.Pos     // `func` keyword
+	LeftBrace   token.Pos     // `{` and `}` token
+	RightBrace  token.Pos
+
+	Name       *Identifier  // function name
+	Parameters []Expression // function parameters, either identifiers or patterns
+	Guard      *GuardSeq    // guard on the parameters; or nil
 	Statements []Statement
 }
 
@@ -206,6 +347,31 @@ func (f *FuncDecl) End() token.Pos {
 	return f.RightBrace + 1
 }
 
+// Span returns where the source text of the function starts and ends, which includes
+// its doc comment unlike Pos.
+func (f *FuncDecl) Span() (start, end token.Pos) {
+	if f.Doc != nil {
+		return f.Doc.Pos(), f.End()
+	}
+	return f.Pos(), f.End()
+}
+
+// GuardSeq is a guard sequence like `when a, b; c`. The guards separated by ';' are
+// alternatives, and every test separated by ',' in a guard must be true for it to pass.
+type GuardSeq struct {
+	When   token.Pos      // `when` keyword
+	Guards [][]Expression // len(Guards) > 0 and every guard has at least one test
+}
+
+func (g *GuardSeq) isNode() {}
+func (g *GuardSeq) Pos() token.Pos {
+	return g.When
+}
+func (g *GuardSeq) End() token.Pos {
+	last := g.Guards[len(g.Guards)-1]
+	return last[len(last)-1].End()
+}
+
 type BadDecl struct {
 	From, To token.Pos
 }
@@ -258,11 +424,93 @@ func (e *ReturnStatement) End() token.Pos {
 	return e.Expression.End()
 }
 
+// DeferStmt evaluates Expression when the function returns, like `defer close(f)`, even
+// if the rest of the function raises an exception. The variables in Expression have the
+// values they have at the defer. Deferred expressions run in reverse order.
+type DeferStmt struct {
+	Defer      token.Pos // `defer` keyword
+	Expression Expression
+}
+
+func (d *DeferStmt) isStatement() {}
+func (d *DeferStmt) isNode()      {}
+func (d *DeferStmt) Pos() token.Pos {
+	return d.Defer
+}
+func (d *DeferStmt) End() token.Pos {
+	return d.Expression.End()
+}
+
+// WhileStmt repeats Body as long as Cond is true.
+type WhileStmt struct {
+	While  token.Pos // `while` keyword
+	Cond   Expression
+	LBrace token.Pos
+	Body   []Statement
+	RBrace token.Pos
+}
+
+func (w *WhileStmt) isStatement() {}
+func (w *WhileStmt) isNode()      {}
+func (w *WhileStmt) Pos() token.Pos {
+	return w.While
+}
+func (w *WhileStmt) End() token.Pos {
+	return w.RBrace + 1
+}
+
+// IfStmt runs Body if Cond is true and Else otherwise. Init is run first, and the
+// variables it binds are only visible in Cond, Body and Else.
+type IfStmt struct {
+	If     token.Pos // `if` keyword
+	Init   Statement // or nil
+	Cond   Expression
+	LBrace token.Pos
+	Body   []Statement
+	RBrace token.Pos
+	Else   Statement // *IfStmt for `else if`, *BlockStmt for `else { ... }`, or nil
+}
+
+func (s *IfStmt) isStatement() {}
+func (s *IfStmt) isNode()      {}
+func (s *IfStmt) Pos() token.Pos {
+	return s.If
+}
+func (s *IfStmt) End() token.Pos {
+	if s.Else != nil {
+		return s.Else.End()
+	}
+	return s.RBrace + 1
+}
+
+// BlockStmt is a braced list of statements, like the else branch of an if.
+type BlockStmt struct {
+	LBrace token.Pos
+	List   []Statement
+	RBrace token.Pos
+}
+
+func (b *BlockStmt) isStatement() {}
+func (b *BlockStmt) isNode()      {}
+func (b *BlockStmt) Pos() token.Pos {
+	return b.LBrace
+}
+func (b *BlockStmt) End() token.Pos {
+	return b.RBrace + 1
+}
+
 type Expression interface {
 	Node
 	isExpression()
 }
 
+// OpExpr is an expression with an operator, like `a + b`, `-a` or `a = b`.
+type OpExpr interface {
+	Expression
+	// Operator returns the type and position of the operator.
+	Operator() (token.Type, token.Pos)
+}
+
 type BadExpr struct {
 	From, To token.Pos
 }
@@ -369,6 +617,7 @@ func (t *TupleType) End() token.Pos {
 type CallExpr struct {
 	Callee    Expression
 	Arguments []Expression
+	Ellipsis  token.Pos // position of "..." after the last argument, which is a list of the rest, or NoPos
 
 	LeftParen, RightParen token.Pos
 }
@@ -393,6 +642,24 @@ func (u *DotExpr) End() token.Pos {
 	return u.Attribute.End()
 }
 
+// IndexExpr reads an element of a tuple, like `p[0]`. Unlike Erlang's element/2, the
+// first element is at index 0.
+type IndexExpr struct {
+	Target   Expression
+	LBracket token.Pos
+	Index    Expression
+	RBracket token.Pos
+}
+
+func (u *IndexExpr) isExpression() {}
+func (u *IndexExpr) isNode()       {}
+func (u *IndexExpr) Pos() token.Pos {
+	return u.Target.Pos()
+}
+func (u *IndexExpr) End() token.Pos {
+	return u.RBracket + 1
+}
+
 type UnaryExpr struct {
 	Op    token.Type
 	OpPos token.Pos
@@ -407,6 +674,55 @@ func (u *UnaryExpr) Pos() token.Pos {
 func (u *UnaryExpr) End() token.Pos {
 	return u.Right.End()
 }
+func (u *UnaryExpr) Operator() (token.Type, token.Pos) {
+	return u.Op, u.OpPos
+}
+
+// PinExpr is a variable in a pattern that is pinned with '^', like `^x`, so the pattern
+// matches the current value of the variable instead of binding it again.
+type PinExpr struct {
+	Caret token.Pos // position of '^'
+	Var   *Identifier
+}
+
+func (p *PinExpr) isExpression() {}
+func (p *PinExpr) isNode()       {}
+func (p *PinExpr) Pos() token.Pos {
+	return p.Caret
+}
+func (p *PinExpr) End() token.Pos {
+	return p.Var.End()
+}
+func (p *PinExpr) Operator() (token.Type, token.Pos) {
+	return token.Caret, p.Caret
+}
+
+// FuncRef refers to a function by name and arity, like `foo/2`, which evaluates to the
+// function as a fun. The parser can't tell it apart from a division of a variable by an
+// integer, so if Name is a variable or constant, the FuncRef is the division Division
+// returns instead.
+type FuncRef struct {
+	Name  *Identifier
+	Slash token.Pos
+	Arity *IntLiteral
+}
+
+func (f *FuncRef) isExpression() {}
+func (f *FuncRef) isNode()       {}
+func (f *FuncRef) Pos() token.Pos {
+	return f.Name.Pos()
+}
+func (f *FuncRef) End() token.Pos {
+	return f.Arity.End()
+}
+func (f *FuncRef) Operator() (token.Type, token.Pos) {
+	return token.Slash, f.Slash
+}
+
+// Division returns f as the division `Name / Arity`.
+func (f *FuncRef) Division() *BinaryExpr {
+	return &BinaryExpr{Left: f.Name, OpPos: f.Slash, Op: token.Slash, Right: f.Arity}
+}
 
 type BinaryExpr struct {
 	Left  Expression
@@ -423,6 +739,9 @@ func (b *BinaryExpr) Pos() token.Pos {
 func (b *BinaryExpr) End() token.Pos {
 	return b.Right.End()
 }
+func (b *BinaryExpr) Operator() (token.Type, token.Pos) {
+	return b.Op, b.OpPos
+}
 
 type Literal interface {
 	Node
@@ -445,6 +764,22 @@ func (s *StringLiteral) End() token.Pos {
 	return s.QuotePos + token.Pos(len(s.Value)) + 2 // +2 for quotes
 }
 
+// InterpString is a string with interpolated expressions like "hello #{name}". Parts
+// alternates between the literal text as *StringLiteral, which may be empty, and the
+// expressions, so it starts and ends with a literal.
+type InterpString struct {
+	Parts []Expression
+}
+
+func (s *InterpString) isExpression() {}
+func (s *InterpString) isNode()       {}
+func (s *InterpString) Pos() token.Pos {
+	return s.Parts[0].Pos()
+}
+func (s *InterpString) End() token.Pos {
+	return s.Parts[len(s.Parts)-1].End()
+}
+
 type AtomLiteral struct {
 	QuotePos token.Pos
 	Value    string
@@ -492,6 +827,225 @@ func (s *FloatLiteral) End() token.Pos {
 	return s.FloatPos + token.Pos(len(s.Lit))
 }
 
+// NilLiteral is the `nil` keyword, which is the empty list like `[]` in Erlang.
+type NilLiteral struct {
+	NilPos token.Pos
+}
+
+func (n *NilLiteral) isExpression() {}
+func (n *NilLiteral) isLiteral()    {}
+func (n *NilLiteral) isNode()       {}
+func (n *NilLiteral) Pos() token.Pos {
+	return n.NilPos
+}
+func (n *NilLiteral) End() token.Pos {
+	return n.NilPos + token.Pos(len("nil"))
+}
+
+// ListExpr is a list like `[a, b, c]` or, when Tail is set, a cons like `[h | t]`.
+// There is no separate prepend operator: a cons is also an expression, so `[x | xs]`
+// prepends x to the list xs like in Erlang, and `[a, b | xs]` prepends both.
+type ListExpr struct {
+	LBracket token.Pos
+	Elements []Expression
+	Pipe     token.Pos  // position of '|', if any
+	Tail     Expression // list the elements are prepended to; or nil
+	RBracket token.Pos
+}
+
+func (l *ListExpr) isExpression() {}
+func (l *ListExpr) isNode()       {}
+func (l *ListExpr) Pos() token.Pos {
+	return l.LBracket
+}
+func (l *ListExpr) End() token.Pos {
+	return l.RBracket + 1
+}
+
+// TupleExpr is a tuple of values. It has no braces (LBrace and RBrace are NoPos) when
+// it is the implicit tuple of a multiple value return like `return a, b`.
+type TupleExpr struct {
+	LBrace   token.Pos
+	Elements []Expression // len(Elements) > 0 if there are no braces
+	RBrace   token.Pos
+}
+
+func (t *TupleExpr) isExpression() {}
+func (t *TupleExpr) isNode()       {}
+func (t *TupleExpr) Pos() token.Pos {
+	if t.LBrace.IsValid() {
+		return t.LBrace
+	}
+	return t.Elements[0].Pos()
+}
+func (t *TupleExpr) End() token.Pos {
+	if t.RBrace.IsValid() {
+		return t.RBrace + 1
+	}
+	return t.Elements[len(t.Elements)-1].End()
+}
+
+// TypeTestExpr tests whether X has the built-in type Type, like `x is int`.
+type TypeTestExpr struct {
+	X    Expression
+	Is   token.Pos // `is` keyword
+	Type Expression
+}
+
+func (t *TypeTestExpr) isExpression() {}
+func (t *TypeTestExpr) isNode()       {}
+func (t *TypeTestExpr) Pos() token.Pos {
+	return t.X.Pos()
+}
+func (t *TypeTestExpr) End() token.Pos {
+	return t.Type.End()
+}
+func (t *TypeTestExpr) Operator() (token.Type, token.Pos) {
+	return token.Is, t.Is
+}
+
+// TernaryExpr chooses between two expressions on a boolean, like `x > 0 ? x : -x`.
+type TernaryExpr struct {
+	Cond     Expression
+	Question token.Pos // '?'
+	Then     Expression
+	Colon    token.Pos // ':'
+	Else     Expression
+}
+
+func (t *TernaryExpr) isExpression() {}
+func (t *TernaryExpr) isNode()       {}
+func (t *TernaryExpr) Pos() token.Pos {
+	return t.Cond.Pos()
+}
+func (t *TernaryExpr) End() token.Pos {
+	return t.Else.End()
+}
+func (t *TernaryExpr) Operator() (token.Type, token.Pos) {
+	return token.Question, t.Question
+}
+
+// CatchExpr evaluates Expr and returns any exception it raises as a value, like Erlang's
+// `catch risky()`. It is a prefix operator, so `catch a + b` is `(catch a) + b`.
+type CatchExpr struct {
+	Catch token.Pos // `catch` keyword
+	Expr  Expression
+}
+
+func (c *CatchExpr) isExpression() {}
+func (c *CatchExpr) isNode()       {}
+func (c *CatchExpr) Pos() token.Pos {
+	return c.Catch
+}
+func (c *CatchExpr) End() token.Pos {
+	return c.Expr.End()
+}
+func (c *CatchExpr) Operator() (token.Type, token.Pos) {
+	return token.CatchKeyword, c.Catch
+}
+
+// LetExpr binds Name to Value in Body, like `let x = f(y) in x + 1`. Unlike an
+// assignment, Name is a new variable that is only visible in Body, so it shadows a
+// variable with the same name instead of matching against it.
+type LetExpr struct {
+	Let   token.Pos // `let` keyword
+	Name  *Identifier
+	Equal token.Pos
+	Value Expression
+	In    token.Pos // `in` keyword
+	Body  Expression
+}
+
+func (l *LetExpr) isExpression() {}
+func (l *LetExpr) isNode()       {}
+func (l *LetExpr) Pos() token.Pos {
+	return l.Let
+}
+func (l *LetExpr) End() token.Pos {
+	return l.Body.End()
+}
+
+// FuncLit is a fun expression like `fn(x) { return x + 1 }`. A named fun like
+// `fn loop(n) { ... }` can call itself by its name, which is only visible in its body.
+type FuncLit struct {
+	Fn         token.Pos   // `fn` keyword
+	Name       *Identifier // or nil
+	Parameters []Expression
+	LeftBrace  token.Pos
+	Statements []Statement
+	RightBrace token.Pos
+}
+
+func (f *FuncLit) isExpression() {}
+func (f *FuncLit) isNode()       {}
+func (f *FuncLit) Pos() token.Pos {
+	return f.Fn
+}
+func (f *FuncLit) End() token.Pos {
+	return f.RightBrace + 1
+}
+
+// CaseExpr matches Value against the pattern of each clause in order and evaluates to the
+// body of the first clause that matches.
+type CaseExpr struct {
+	Case    token.Pos // `case` keyword
+	Value   Expression
+	LBrace  token.Pos
+	Clauses []*Clause
+	RBrace  token.Pos
+}
+
+func (c *CaseExpr) isExpression() {}
+func (c *CaseExpr) isNode()       {}
+func (c *CaseExpr) Pos() token.Pos {
+	return c.Case
+}
+func (c *CaseExpr) End() token.Pos {
+	return c.RBrace + 1
+}
+
+// ReceiveExpr waits for a message in the mailbox of the process that matches the pattern
+// of a clause, and evaluates to the body of that clause, like Erlang's receive. With an
+// `after Timeout -> Action` section, it evaluates to Action if no message matched within
+// Timeout milliseconds.
+type ReceiveExpr struct {
+	Receive    token.Pos // `receive` keyword
+	LBrace     token.Pos
+	Clauses    []*Clause
+	After      token.Pos  // `after` keyword, or NoPos to wait forever
+	Timeout    Expression // integer or 'infinity'; or nil
+	AfterArrow token.Pos
+	Action     Expression // or nil
+	RBrace     token.Pos
+}
+
+func (r *ReceiveExpr) isExpression() {}
+func (r *ReceiveExpr) isNode()       {}
+func (r *ReceiveExpr) Pos() token.Pos {
+	return r.Receive
+}
+func (r *ReceiveExpr) End() token.Pos {
+	return r.RBrace + 1
+}
+
+// Clause is a single `pattern when guard -> body` clause of a case or receive. An
+// AssignExpr pattern like `all = {a, b}` is an alias that binds both the whole value and
+// its parts. The guard is parsed the same way as the guard of a function head.
+type Clause struct {
+	Patterns []Expression // one pattern per value matched
+	Guard    *GuardSeq    // or nil
+	Arrow    token.Pos
+	Body     Expression
+}
+
+func (c *Clause) isNode() {}
+func (c *Clause) Pos() token.Pos {
+	return c.Patterns[0].Pos()
+}
+func (c *Clause) End() token.Pos {
+	return c.Body.End()
+}
+
 type KVExpr struct {
 	Key, Value Expression
 	Colon      token.Pos
@@ -519,6 +1073,8 @@ func NewIdent(tok lexer.Token) *Identifier {
 	}
 }
 
+// Identifier is a name, which may be quoted like `weird name` to use a name that is not
+// a valid identifier or is a keyword. Name is the decoded name without the quotes.
 type Identifier struct {
 	NamePos token.Pos
 	Name    string
@@ -550,8 +1106,12 @@ func (p *ParenExpr) End() token.Pos {
 	return p.RParen + 1
 }
 
+// AssignExpr binds Left to Right, like `a = 1`. A type annotation like `p: Point = {1, 2}`
+// declares the type of the variable.
 type AssignExpr struct { // '='
 	Left   *Identifier
+	Colon  token.Pos  // position of ':', if any
+	Type   Expression // declared type; or nil
 	Equals token.Pos
 	Right  Expression
 }
@@ -564,9 +1124,36 @@ func (a *AssignExpr) Pos() token.Pos {
 func (a *AssignExpr) End() token.Pos {
 	return a.Right.End()
 }
+func (a *AssignExpr) Operator() (token.Type, token.Pos) {
+	return token.Equal, a.Equals
+}
 
-type MatchAssignExpr struct { // ':='
+// MultiAssignExpr binds each name to an element of the tuple on the right, like
+// `q, r = divmod(a, b)`.
+type MultiAssignExpr struct {
+	Left   []*Identifier
+	Equals token.Pos
+	Right  Expression
+}
+
+func (a *MultiAssignExpr) isExpression() {}
+func (a *MultiAssignExpr) isNode()       {}
+func (a *MultiAssignExpr) Pos() token.Pos {
+	return a.Left[0].Pos()
+}
+func (a *MultiAssignExpr) End() token.Pos {
+	return a.Right.End()
+}
+func (a *MultiAssignExpr) Operator() (token.Type, token.Pos) {
+	return token.Equal, a.Equals
+}
+
+// MatchAssignExpr matches Right against the pattern Left, like `{'ok', v} := f()`, and
+// raises a badmatch error if it doesn't match. A pattern on the left of '=' is matched
+// the same way, like Erlang's `{ok, V} = f()`.
+type MatchAssignExpr struct {
 	Left   Expression
+	Op     token.Type // token.ColonEqual or token.Equal
 	Equals token.Pos
 	Right  Expression
 }
@@ -579,3 +1166,6 @@ func (a *MatchAssignExpr) Pos() token.Pos {
 func (a *MatchAssignExpr) End() token.Pos {
 	return a.Right.End()
 }
+func (a *MatchAssignExpr) Operator() (token.Type, token.Pos) {
+	return a.Op, a.Equals
+}
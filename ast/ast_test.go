@@ -0,0 +1,216 @@
+package ast_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/parser"
+	"github.com/masp/garlang/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleLookup(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+type Pair tuple[int, int]
+func add(a, b) { return a + b }
+func add(a) { return a }`))
+	require.NoError(t, err)
+
+	fn, ok := mod.Func("add", 2)
+	require.True(t, ok)
+	require.Len(t, fn.Parameters, 2)
+
+	fn, ok = mod.Func("add", 1)
+	require.True(t, ok)
+	require.Len(t, fn.Parameters, 1)
+
+	_, ok = mod.Func("add", 3)
+	require.False(t, ok, "add/3 is not declared")
+	_, ok = mod.Func("sub", 2)
+	require.False(t, ok, "sub is not declared")
+
+	typ, ok := mod.Type("Pair")
+	require.True(t, ok)
+	require.Equal(t, "Pair", typ.Name.Name)
+	_, ok = mod.Type("Triple")
+	require.False(t, ok)
+}
+
+func TestModuleDependencies(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+import "lists"
+import "net/http" (get/1)
+import j "encoding/json"
+func f(xs) {
+	ys = lists.map(fn(x) { return maps.get(x, 'k') }, xs)
+	return {j.encode(ys), 'string'.length("abc"), http.post(ys), get(ys), erlang.self()}
+}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"encoding/json", "erlang", "lists", "maps", "net/http", "string"}, mod.Dependencies())
+
+	mod, err = parser.Module("<test>", []byte(`module test
+func f(x) { return x }`))
+	require.NoError(t, err)
+	require.Empty(t, mod.Dependencies())
+}
+
+func TestClone(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+import "lists" (sum/1)
+const Limit = 10
+// f does a bit of everything.
+func f(x, [h | t]) when x > 0 {
+	y = case x { {'ok', v} when v < Limit -> [v | t]; _ -> sum([h]) }
+	return fn(z) { return {y, z, "#{x}"} }
+}`))
+	require.NoError(t, err)
+	print := func(node ast.Node) string {
+		var out bytes.Buffer
+		require.NoError(t, ast.Fprint(&out, mod.File, node, ast.NotNilFilter))
+		return out.String()
+	}
+	orig := print(mod)
+
+	clone := ast.Clone(mod).(*ast.Module)
+	require.Equal(t, orig, print(clone))
+	require.Same(t, mod.File, clone.File)
+	require.Same(t, clone.Decls[0], clone.Imports[0], "a shared node stays shared")
+
+	// change a node of every kind in the clone
+	clone.Id.Name = "other"
+	clone.Imports[0].Funcs[0].Arity.Value = 2
+	clone.Decls[1].(*ast.ConstDecl).Value.(*ast.IntLiteral).Value = 20
+	fn := clone.Decls[2].(*ast.FuncDecl)
+	fn.Doc.List[0].Text = "// changed"
+	fn.Parameters[1].(*ast.ListExpr).Tail = nil
+	fn.Guard.Guards[0][0].(*ast.BinaryExpr).Op = token.Less
+	assign := fn.Statements[0].(*ast.ExprStatement).Expression.(*ast.AssignExpr)
+	clause := assign.Right.(*ast.CaseExpr).Clauses[0]
+	clause.Patterns[0].(*ast.TupleExpr).Elements[0] = &ast.AtomLiteral{Value: "error"}
+	clause.Guard = nil
+	lit := fn.Statements[1].(*ast.ReturnStatement).Expression.(*ast.FuncLit)
+	lit.Statements = append(lit.Statements, lit.Statements[0])
+	clone.Decls = clone.Decls[:1]
+
+	require.NotEqual(t, orig, print(clone))
+	require.Equal(t, orig, print(mod), "changing the clone changed the original")
+	require.Nil(t, ast.Clone(nil))
+}
+
+func TestUnparse(t *testing.T) {
+	src := `module a.b.test
+import "lists" (sum/1, foldl/3)
+import j "encoding/json"
+
+type Pair tuple[int, int]
+@deprecated("use g")
+type Old string
+const Limit = 10 * 2
+guard small(x) = x < Limit andalso x > -Limit
+
+// f does a bit of everything.
+@inline
+func f(x, [h | t], {a, 'ok'}, 1) when x > 0, x < 10; x == -1 {
+	y: int = case x { {'ok', v} when v < Limit -> [v, 1 | t]; all = {_, _} -> all; _ -> sum([h]) }
+	{'ok', z} := j.decode("a \"quoted\" #{x} and \#{not} \\ \t")
+	{q, r} = {x / 2, x % 2}
+	q2, r2 = divmod(x, 2)
+	^x = x
+	defer erlang.display('done')
+	while q > 0 {
+		q = q - 1
+	}
+	if {'ok', n} := lists.keyfind(q, 1, t); n > q {
+		q = n
+	} else if q < 0 {
+		q = 0
+	} else {
+		erlang.display(q)
+	}
+	w = let n = x + 1 in n * (n - 1) -- [n]
+	v = lists.max(q, [r]...)
+	k = x > 0 ? -x : + - x
+	m = catch risky(x)[0]
+	s = x is tuple and x is tuple[int, lists.t] or not_a_list is list
+	b = not x is int and not (not x) == (not q > 0)
+	g = fn loop(n) { return n == 0 ? 'done' : loop(n - 1) }
+	fns = {f/4, lists.map/2, 1.5e-3, 16#ff, nil, 'it\'s'}
+	return receive {
+		{'ping', from} -> erlang.send(from, "pong #{x + 1}")
+		after 1000 -> 'timeout'
+	}, ` + "`weird name`" + `, ` + "`case`" + `.fn(y, z, w, k, m, s, g)
+}
+
+func empty() {}
+`
+	mod, err := parser.Module("<test>", []byte(src))
+	require.NoError(t, err)
+
+	unparse := func(node ast.Node) string {
+		var out bytes.Buffer
+		require.NoError(t, ast.Unparse(&out, node))
+		return out.String()
+	}
+	// the trees are compared without positions, which change
+	posType := reflect.TypeOf(token.NoPos)
+	noPos := func(name string, v reflect.Value) bool {
+		return ast.NotNilFilter(name, v) && v.Type() != posType && name != "File" && name != "Scope"
+	}
+	print := func(node ast.Node) string {
+		var out bytes.Buffer
+		require.NoError(t, ast.Fprint(&out, nil, node, noPos))
+		return out.String()
+	}
+
+	out := unparse(mod)
+	reparsed, err := parser.Module("<test>", []byte(out))
+	require.NoError(t, err, out)
+	require.Equal(t, print(mod), print(reparsed), out)
+	require.Equal(t, out, unparse(reparsed), "unparsing is stable")
+}
+
+func TestUnparseExpr(t *testing.T) {
+	ident := func(name string) *ast.Identifier { return &ast.Identifier{Name: name} }
+	tests := []struct {
+		node ast.Node
+		want string
+	}{
+		// a tree built by a pass has parentheses where its meaning needs them
+		{&ast.BinaryExpr{
+			Left:  &ast.BinaryExpr{Left: ident("a"), Op: token.Plus, Right: ident("b")},
+			Op:    token.Star,
+			Right: &ast.BinaryExpr{Left: ident("c"), Op: token.Minus, Right: ident("d")},
+		}, "(a + b) * (c - d)"},
+		{&ast.BinaryExpr{
+			Left:  ident("a"),
+			Op:    token.Minus,
+			Right: &ast.BinaryExpr{Left: ident("b"), Op: token.Minus, Right: ident("c")},
+		}, "a - (b - c)"},
+		{&ast.UnaryExpr{Op: token.Minus, Right: &ast.UnaryExpr{Op: token.Minus, Right: ident("x")}}, "- -x"},
+		{&ast.BinaryExpr{
+			Left:  &ast.BinaryExpr{Left: ident("a"), Op: token.Plus, Right: &ast.UnaryExpr{Op: token.Not, Right: ident("b")}},
+			Op:    token.EqualEqual,
+			Right: ident("c"),
+		}, "a + (not b) == c"},
+		{&ast.UnaryExpr{Op: token.Not, Right: &ast.BinaryExpr{Left: ident("a"), Op: token.And, Right: ident("b")}}, "not (a and b)"},
+		{&ast.CallExpr{Callee: &ast.LetExpr{Name: ident("f"), Value: ident("g"), Body: ident("f")}}, "(let f = g in f)()"},
+		{&ast.IntLiteral{Value: 42}, "42"},
+		{&ast.FloatLiteral{Value: 2}, "2.0"},
+		{ident("nil"), "`nil`"},
+		{ident("größe"), "größe"},
+		{&ast.AtomLiteral{Value: "it's\n"}, `'it\'s\n'`},
+		{&ast.BadExpr{}, "/* bad expression */"},
+		{&ast.BadStmt{}, "/* bad statement */"},
+		{&ast.BadDecl{}, "/* bad declaration */"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		require.NoError(t, ast.Unparse(&out, tt.node))
+		require.Equal(t, tt.want, out.String())
+	}
+
+	var out bytes.Buffer
+	require.EqualError(t, ast.Unparse(&out, ident("a`b")), "cannot unparse name \"a`b\"")
+}
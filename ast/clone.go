@@ -0,0 +1,69 @@
+package ast
+
+import (
+	"reflect"
+
+	"github.com/masp/garlang/token"
+)
+
+// Clone returns a deep copy of node, so a pass can change the copy without changing
+// node. A node that is referenced twice, like an import that is both in Module.Decls and
+// Module.Imports, is copied once and referenced twice in the copy. The *token.File and
+// *Scope of a Module are not part of the tree and are shared with the copy.
+func Clone(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	c := cloner{}
+	return c.clone(reflect.ValueOf(node)).Interface().(Node)
+}
+
+// cloner maps each pointer that was already copied to its copy.
+type cloner map[any]reflect.Value
+
+var (
+	fileType  = reflect.TypeOf((*token.File)(nil))
+	scopeType = reflect.TypeOf((*Scope)(nil))
+)
+
+func (c cloner) clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Type() == fileType || v.Type() == scopeType {
+			return v
+		}
+		if cp, ok := c[v.Interface()]; ok {
+			return cp
+		}
+		cp := reflect.New(v.Type().Elem())
+		c[v.Interface()] = cp
+		cp.Elem().Set(c.clone(v.Elem()))
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(c.clone(v.Elem()))
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(c.clone(v.Index(i)))
+		}
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(c.clone(v.Field(i)))
+			}
+		}
+		return cp
+	}
+	return v // strings, numbers and positions are values
+}
@@ -214,6 +214,10 @@ func (p *printer) print(x reflect.Value) {
 
 	case reflect.Struct:
 		t := x.Type()
+		if span, ok := p.badSpan(x); ok {
+			p.printf("%s {%s}", t, span)
+			return
+		}
 		p.printf("%s {", t)
 		p.indent++
 		first := true
@@ -254,3 +258,31 @@ func (p *printer) print(x reflect.Value) {
 		p.printf("%v", v)
 	}
 }
+
+// badSpan returns the source range covered by a bad node as a single span like
+// file:3:5-5:3, which reads better than separate From and To positions.
+// It needs a file to resolve positions.
+func (p *printer) badSpan(x reflect.Value) (string, bool) {
+	if p.file == nil || !x.CanAddr() {
+		return "", false
+	}
+	var from, to token.Pos
+	switch n := x.Addr().Interface().(type) {
+	case *BadDecl:
+		from, to = n.From, n.To
+	case *BadStmt:
+		from, to = n.From, n.To
+	case *BadExpr:
+		from, to = n.From, n.To
+	default:
+		return "", false
+	}
+	start, end := p.file.Position(from), p.file.Position(to)
+	if !start.IsValid() || !end.IsValid() {
+		return "", false
+	}
+	if start.Line == end.Line {
+		return fmt.Sprintf("%s-%d", start, end.Column), true
+	}
+	return fmt.Sprintf("%s-%d:%d", start, end.Line, end.Column), true
+}
@@ -74,7 +74,7 @@ func (s *Scope) String() string {
 type Object struct {
 	Kind ObjKind
 	Name string // declared name
-	Decl any    // corresponding Field, XxxSpec, FuncDecl, AssignStmt, Scope; or nil
+	Decl any    // corresponding Field, XxxDecl, binding Identifier, Scope; or nil
 	Data any    // object-specific data; or nil
 	Type any    // placeholder for type information; may be nil
 }
@@ -100,11 +100,32 @@ func (obj *Object) Pos() token.Pos {
 		if d.Alias != nil && d.Alias.Name == name {
 			return d.Alias.Pos()
 		}
+		for _, fn := range d.Funcs {
+			if fn.Name.Name == name {
+				return fn.Name.Pos()
+			}
+		}
 		return d.Path.Pos()
 	case *FuncDecl:
 		if d.Name.Name == name {
 			return d.Name.Pos()
 		}
+	case *ConstDecl:
+		if d.Name.Name == name {
+			return d.Name.Pos()
+		}
+	case *GuardDecl:
+		if d.Name.Name == name {
+			return d.Name.Pos()
+		}
+	case *TypeDecl:
+		if d.Name.Name == name {
+			return d.Name.Pos()
+		}
+	case *Identifier:
+		if d.Name == name {
+			return d.Pos()
+		}
 	case *MatchAssignExpr:
 		if ident, isIdent := d.Left.(*Identifier); isIdent && ident.Name == name {
 			return ident.Pos()
@@ -0,0 +1,658 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/masp/garlang/token"
+)
+
+// Unparse writes node to w as garlang source, which parses back to the same tree except
+// for positions. Unlike a formatter it does not keep comments other than doc comments,
+// and only adds the parentheses that are needed, so a tree changed by a pass is written
+// with the meaning it has. Bad nodes are written as a comment like /* bad expression */,
+// so the output of a tree with errors doesn't parse.
+//
+// An error is returned if writing to w fails, or if node has a name or string that can't
+// be written, like a name with a '`' in it.
+func Unparse(w io.Writer, node Node) (err error) {
+	u := unparser{output: w}
+	defer func() {
+		if e := recover(); e != nil {
+			err = e.(localError).err // re-panics if it's not a localError
+		}
+	}()
+	u.node(node)
+	return nil
+}
+
+// Levels of the expressions, from the loosest to the tightest binding. An expression
+// with a lower level than its context needs is written in parentheses. The binary
+// operators are between levelTernary and levelUnary at their precedence plus one.
+const (
+	levelAssign  = 0 // assignments and let, whose body extends as far as possible
+	levelTernary = 1
+	levelUnary   = 9
+	levelPostfix = 10 // calls, '.' and indexes
+	levelPrimary = 11
+)
+
+// operators are the spellings of the operator tokens.
+var operators = map[token.Type]string{
+	token.Bang:            "!",
+	token.Plus:            "+",
+	token.Minus:           "-",
+	token.Star:            "*",
+	token.Slash:           "/",
+	token.Percent:         "%",
+	token.MinusMinus:      "--",
+	token.EqualEqual:      "==",
+	token.BangEqual:       "!=",
+	token.EqualEqualEqual: "===",
+	token.BangEqualEqual:  "!==",
+	token.Less:            "<",
+	token.LessEqual:       "<=",
+	token.Greater:         ">",
+	token.GreaterEqual:    ">=",
+	token.And:             "and",
+	token.Or:              "or",
+	token.AndAlso:         "andalso",
+	token.OrElse:          "orelse",
+	token.Not:             "not",
+	token.Equal:           "=",
+	token.ColonEqual:      ":=",
+}
+
+type unparser struct {
+	output io.Writer
+	indent int // number of tabs at the start of each line
+}
+
+func (u *unparser) print(s string) {
+	if _, err := io.WriteString(u.output, s); err != nil {
+		panic(localError{err})
+	}
+}
+
+func (u *unparser) errorf(format string, args ...any) {
+	panic(localError{fmt.Errorf(format, args...)})
+}
+
+// newline ends the line and indents the next one.
+func (u *unparser) newline() {
+	u.print("\n" + strings.Repeat("\t", u.indent))
+}
+
+func (u *unparser) node(node Node) {
+	switch n := node.(type) {
+	case *Module:
+		u.module(n)
+	case Decl:
+		u.decl(n)
+	case Statement:
+		u.stmt(n)
+	case Expression:
+		u.expr(n, levelAssign)
+	case *GuardSeq:
+		u.guard(n)
+	case *Clause:
+		u.clause(n)
+	case *Annotation:
+		u.annotation(n)
+	case *ImportedFunc:
+		u.importedFunc(n)
+	case *KVExpr:
+		u.expr(n.Key, levelAssign)
+		u.print(": ")
+		u.expr(n.Value, levelAssign)
+	default:
+		u.errorf("cannot unparse %T", node)
+	}
+}
+
+func (u *unparser) module(mod *Module) {
+	u.print("module ")
+	if len(mod.Segments) > 0 {
+		for i, seg := range mod.Segments {
+			if i > 0 {
+				u.print(".")
+			}
+			u.ident(seg)
+		}
+	} else {
+		u.ident(mod.Id)
+	}
+	u.print(";\n")
+	for _, decl := range mod.Decls {
+		u.print("\n")
+		u.decl(decl)
+		u.print(";\n")
+	}
+}
+
+func (u *unparser) decl(decl Decl) {
+	switch d := decl.(type) {
+	case *ImportDecl:
+		u.print("import ")
+		if d.Alias != nil {
+			u.ident(d.Alias)
+			u.print(" ")
+		}
+		u.str('"', d.Path.Value)
+		if d.LParen.IsValid() || len(d.Funcs) > 0 {
+			u.print(" (")
+			for i, fn := range d.Funcs {
+				if i > 0 {
+					u.print(", ")
+				}
+				u.importedFunc(fn)
+			}
+			u.print(")")
+		}
+	case *TypeDecl:
+		u.annotations(d.Annotations)
+		u.print("type ")
+		u.ident(d.Name)
+		u.print(" ")
+		u.typ(d.Definition)
+	case *ConstDecl:
+		u.print("const ")
+		u.ident(d.Name)
+		u.print(" = ")
+		u.expr(d.Value, levelAssign)
+	case *GuardDecl:
+		u.print("guard ")
+		u.ident(d.Name)
+		u.print("(")
+		for i, param := range d.Parameters {
+			if i > 0 {
+				u.print(", ")
+			}
+			u.ident(param)
+		}
+		u.print(") = ")
+		u.expr(d.Body, levelAssign)
+	case *FuncDecl:
+		if d.Doc != nil {
+			for _, c := range d.Doc.List {
+				u.print(c.Text)
+				u.newline()
+			}
+		}
+		u.annotations(d.Annotations)
+		u.print("func ")
+		u.ident(d.Name)
+		u.params(d.Parameters)
+		if d.Guard != nil {
+			u.print(" ")
+			u.guard(d.Guard)
+		}
+		u.print(" ")
+		u.block(d.Statements)
+	case *BadDecl:
+		u.print("/* bad declaration */")
+	default:
+		u.errorf("cannot unparse %T", decl)
+	}
+}
+
+func (u *unparser) importedFunc(fn *ImportedFunc) {
+	u.ident(fn.Name)
+	u.print("/")
+	u.int(fn.Arity)
+}
+
+func (u *unparser) annotations(annotations []*Annotation) {
+	for _, ann := range annotations {
+		u.annotation(ann)
+		u.newline()
+	}
+}
+
+func (u *unparser) annotation(ann *Annotation) {
+	u.print("@")
+	u.ident(ann.Name)
+	if ann.LParen.IsValid() || len(ann.Args) > 0 {
+		u.print("(")
+		u.exprs(ann.Args)
+		u.print(")")
+	}
+}
+
+func (u *unparser) params(params []Expression) {
+	u.print("(")
+	u.exprs(params)
+	u.print(")")
+}
+
+// block writes statements in braces, one per line.
+func (u *unparser) block(stmts []Statement) {
+	if len(stmts) == 0 {
+		u.print("{}")
+		return
+	}
+	u.print("{")
+	u.indent++
+	for _, stmt := range stmts {
+		u.newline()
+		u.stmt(stmt)
+		// an explicit ';', since a line only ends a statement after some tokens
+		u.print(";")
+	}
+	u.indent--
+	u.newline()
+	u.print("}")
+}
+
+func (u *unparser) stmt(stmt Statement) {
+	switch s := stmt.(type) {
+	case *ExprStatement:
+		if s.Expression != nil {
+			u.expr(s.Expression, levelAssign)
+		}
+	case *ReturnStatement:
+		u.print("return ")
+		if tuple, ok := s.Expression.(*TupleExpr); ok && !tuple.LBrace.IsValid() && len(tuple.Elements) > 0 {
+			u.exprs(tuple.Elements) // a multiple value return like `return a, b`
+			return
+		}
+		u.expr(s.Expression, levelAssign)
+	case *DeferStmt:
+		u.print("defer ")
+		u.expr(s.Expression, levelAssign)
+	case *WhileStmt:
+		u.print("while ")
+		u.expr(s.Cond, levelAssign)
+		u.print(" ")
+		u.block(s.Body)
+	case *IfStmt:
+		u.print("if ")
+		if s.Init != nil {
+			u.stmt(s.Init)
+			u.print("; ")
+		}
+		u.expr(s.Cond, levelAssign)
+		u.print(" ")
+		u.block(s.Body)
+		if s.Else != nil {
+			u.print(" else ")
+			u.stmt(s.Else)
+		}
+	case *BlockStmt:
+		u.block(s.List)
+	case *BadStmt:
+		u.print("/* bad statement */")
+	default:
+		u.errorf("cannot unparse %T", stmt)
+	}
+}
+
+func (u *unparser) guard(seq *GuardSeq) {
+	u.print("when ")
+	for i, guard := range seq.Guards {
+		if i > 0 {
+			u.print("; ")
+		}
+		u.exprs(guard)
+	}
+}
+
+func (u *unparser) clause(clause *Clause) {
+	u.exprs(clause.Patterns)
+	if clause.Guard != nil {
+		u.print(" ")
+		u.guard(clause.Guard)
+	}
+	u.print(" -> ")
+	u.expr(clause.Body, levelAssign)
+}
+
+// clauses writes the clauses of a case or receive in braces, one per line, and the
+// timeout of a receive if there is one.
+func (u *unparser) clauses(clauses []*Clause, receive *ReceiveExpr) {
+	u.print("{")
+	u.indent++
+	for _, clause := range clauses {
+		u.newline()
+		u.clause(clause)
+		u.print(";")
+	}
+	if receive != nil && receive.Timeout != nil {
+		u.newline()
+		u.print("after ")
+		u.expr(receive.Timeout, levelAssign)
+		u.print(" -> ")
+		u.expr(receive.Action, levelAssign)
+		u.print(";")
+	}
+	u.indent--
+	u.newline()
+	u.print("}")
+}
+
+func (u *unparser) exprs(exprs []Expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			u.print(", ")
+		}
+		u.expr(expr, levelAssign)
+	}
+}
+
+// level returns the level of expr, which is the loosest binding context it can be written
+// in without parentheses.
+func level(expr Expression) int {
+	switch e := expr.(type) {
+	case *AssignExpr, *MultiAssignExpr, *MatchAssignExpr, *LetExpr:
+		return levelAssign
+	case *TernaryExpr:
+		return levelTernary
+	case *BinaryExpr:
+		prec, _ := e.Op.Precedence()
+		return prec + 1
+	case *TypeTestExpr:
+		prec, _ := token.Is.Precedence()
+		return prec + 1
+	case *FuncRef:
+		prec, _ := token.Slash.Precedence()
+		return prec + 1
+	case *UnaryExpr:
+		if e.Op == token.Not {
+			// the operand of not takes comparisons, so it binds like and
+			prec, _ := token.And.Precedence()
+			return prec + 1
+		}
+		return levelUnary
+	case *CatchExpr:
+		return levelUnary
+	case *CallExpr, *DotExpr, *IndexExpr:
+		return levelPostfix
+	}
+	return levelPrimary
+}
+
+// expr writes expr in a context that needs an expression of at least the given level.
+func (u *unparser) expr(expr Expression, min int) {
+	if expr == nil {
+		u.errorf("cannot unparse a missing expression")
+	}
+	if level(expr) < min {
+		u.print("(")
+		defer u.print(")")
+	}
+
+	switch e := expr.(type) {
+	case *Identifier:
+		u.ident(e)
+	case *IntLiteral:
+		u.int(e)
+	case *FloatLiteral:
+		if e.Lit != "" {
+			u.print(e.Lit)
+			break
+		}
+		lit := strconv.FormatFloat(e.Value, 'f', -1, 64)
+		if !strings.Contains(lit, ".") {
+			lit += ".0" // a float needs digits on both sides of the '.'
+		}
+		u.print(lit)
+	case *StringLiteral:
+		u.str('"', e.Value)
+	case *AtomLiteral:
+		u.str('\'', e.Value)
+	case *NilLiteral:
+		u.print("nil")
+	case *InterpString:
+		u.print(`"`)
+		for i, part := range e.Parts {
+			if lit, ok := part.(*StringLiteral); ok && i%2 == 0 {
+				u.print(escape(lit.Value, '"'))
+				continue
+			}
+			u.print("#{")
+			u.expr(part, levelAssign)
+			u.print("}")
+		}
+		u.print(`"`)
+	case *ListExpr:
+		u.print("[")
+		u.exprs(e.Elements)
+		if e.Tail != nil {
+			u.print(" | ")
+			u.expr(e.Tail, levelAssign)
+		}
+		u.print("]")
+	case *TupleExpr:
+		u.print("{")
+		u.exprs(e.Elements)
+		u.print("}")
+	case *ParenExpr:
+		u.print("(")
+		u.expr(e.Expression, levelAssign)
+		u.print(")")
+	case *PinExpr:
+		u.print("^")
+		u.ident(e.Var)
+	case *FuncRef:
+		u.ident(e.Name)
+		u.print("/")
+		u.int(e.Arity)
+	case *CallExpr:
+		u.expr(e.Callee, levelPostfix)
+		u.print("(")
+		u.exprs(e.Arguments)
+		if e.Ellipsis.IsValid() {
+			u.print("...")
+		}
+		u.print(")")
+	case *DotExpr:
+		u.expr(e.Target, levelPostfix)
+		u.print(".")
+		u.ident(e.Attribute)
+	case *IndexExpr:
+		u.expr(e.Target, levelPostfix)
+		u.print("[") // right after the target, or it is a list
+		u.expr(e.Index, levelAssign)
+		u.print("]")
+	case *UnaryExpr:
+		op, ok := operators[e.Op]
+		if !ok {
+			u.errorf("cannot unparse unary operator %s", e.Op)
+		}
+		u.print(op)
+		if e.Op == token.Not {
+			prec, _ := token.EqualEqual.Precedence()
+			u.print(" ")
+			u.expr(e.Right, prec+1)
+			break
+		}
+		if inner, ok := e.Right.(*UnaryExpr); ok && inner.Op == e.Op {
+			u.print(" ") // - -x, not the operator --
+		}
+		u.expr(e.Right, levelUnary)
+	case *CatchExpr:
+		u.print("catch ")
+		u.expr(e.Expr, levelUnary)
+	case *BinaryExpr:
+		op, ok := operators[e.Op]
+		if !ok {
+			u.errorf("cannot unparse binary operator %s", e.Op)
+		}
+		// the operators are left-associative, so only the right operand of an operator
+		// with the same precedence needs parentheses
+		lvl, right := level(e), level(e)+1
+		if not, ok := e.Right.(*UnaryExpr); ok && not.Op == token.Not && level(not) >= lvl {
+			right = lvl // `a and not b`, the operand of not stops at the next and
+		}
+		u.expr(e.Left, lvl)
+		u.print(" " + op + " ")
+		u.expr(e.Right, right)
+	case *TypeTestExpr:
+		u.expr(e.X, level(e))
+		u.print(" is ")
+		u.typ(e.Type)
+	case *TernaryExpr:
+		u.expr(e.Cond, levelTernary+1)
+		u.print(" ? ")
+		u.expr(e.Then, levelTernary)
+		u.print(" : ")
+		u.expr(e.Else, levelTernary)
+	case *AssignExpr:
+		u.ident(e.Left)
+		if e.Type != nil {
+			u.print(": ")
+			u.typ(e.Type)
+		}
+		u.print(" = ")
+		u.expr(e.Right, levelAssign)
+	case *MultiAssignExpr:
+		for i, name := range e.Left {
+			if i > 0 {
+				u.print(", ")
+			}
+			u.ident(name)
+		}
+		u.print(" = ")
+		u.expr(e.Right, levelAssign)
+	case *MatchAssignExpr:
+		op := e.Op
+		if op != token.Equal {
+			op = token.ColonEqual
+		}
+		u.expr(e.Left, levelTernary)
+		u.print(" " + operators[op] + " ")
+		if op == token.Equal {
+			u.expr(e.Right, levelAssign)
+		} else {
+			u.expr(e.Right, levelTernary)
+		}
+	case *LetExpr:
+		u.print("let ")
+		u.ident(e.Name)
+		u.print(" = ")
+		u.expr(e.Value, levelAssign)
+		u.print(" in ")
+		u.expr(e.Body, levelAssign)
+	case *FuncLit:
+		u.print("fn")
+		if e.Name != nil {
+			u.print(" ")
+			u.ident(e.Name)
+		}
+		u.params(e.Parameters)
+		u.print(" ")
+		u.block(e.Statements)
+	case *CaseExpr:
+		u.print("case ")
+		u.expr(e.Value, levelAssign)
+		u.print(" ")
+		u.clauses(e.Clauses, nil)
+	case *ReceiveExpr:
+		u.print("receive ")
+		u.clauses(e.Clauses, e)
+	case *TupleType:
+		u.typ(e)
+	case *BadExpr:
+		u.print("/* bad expression */")
+	default:
+		u.errorf("cannot unparse %T", expr)
+	}
+}
+
+// typ writes a type, where names like `tuple` in `x is tuple` are not quoted.
+func (u *unparser) typ(typ Expression) {
+	switch t := typ.(type) {
+	case *Identifier:
+		u.print(t.Name)
+	case *DotExpr:
+		u.typ(t.Target)
+		u.print(".")
+		u.print(t.Attribute.Name)
+	case *TupleType:
+		u.print("tuple")
+		u.fields(t.Elts)
+	case *BadExpr:
+		u.print("/* bad type */")
+	default:
+		u.errorf("cannot unparse type %T", typ)
+	}
+}
+
+func (u *unparser) fields(fields *FieldList) {
+	u.print("[")
+	for i, field := range fields.List {
+		if i > 0 {
+			u.print(", ")
+		}
+		u.typ(field.Type)
+	}
+	u.print("]")
+}
+
+func (u *unparser) int(lit *IntLiteral) {
+	if lit.Lit != "" {
+		u.print(lit.Lit)
+		return
+	}
+	u.print(strconv.FormatInt(lit.Value, 10))
+}
+
+// ident writes a name, quoted like `weird name` if it is a keyword or not a valid
+// identifier.
+func (u *unparser) ident(ident *Identifier) {
+	if isIdent(ident.Name) && token.Lookup(ident.Name) == token.Identifier {
+		u.print(ident.Name)
+		return
+	}
+	u.str('`', ident.Name)
+}
+
+func isIdent(name string) bool {
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// str writes s quoted with quote, which is a double quote for a string, a single quote
+// for an atom or a backtick for a name.
+func (u *unparser) str(quote byte, s string) {
+	if quote == '`' && (s == "" || strings.ContainsRune(s, '`')) {
+		u.errorf("cannot unparse name %q", s)
+	}
+	if strings.IndexByte(s, 0) >= 0 || !utf8.ValidString(s) && quote != '"' {
+		u.errorf("cannot unparse %q", s)
+	}
+	u.print(string(quote) + escape(s, quote) + string(quote))
+}
+
+// escapes are the escape sequences of the characters that can't be written as they are
+// in a string, atom or quoted name.
+var escapes = map[byte]string{
+	'\a': `\a`, '\b': `\b`, '\f': `\f`, '\n': `\n`, '\r': `\r`, '\t': `\t`, '\v': `\v`,
+	'\\': `\\`, '#': `\#`,
+}
+
+// escape returns s with the characters that would end or change a string quoted with
+// quote escaped.
+func escape(s string, quote byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote != '`':
+			b.WriteString(`\` + string(c))
+		case escapes[c] != "":
+			b.WriteString(escapes[c])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,284 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements walking the AST with a visitor.
+// Modified from original: https://cs.opensource.google/go/go/+/refs/heads/master:src/go/ast/walk.go
+
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+func walkExprList(v Visitor, list []Expression) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+func walkAnnotations(v Visitor, list []*Annotation) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+func walkStmtList(v Visitor, list []Statement) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+func walkDeclList(v Visitor, list []Decl) {
+	for _, x := range list {
+		Walk(v, x)
+	}
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor
+// w for each of the non-nil children of node, followed by a call of
+// w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	// walk children
+	// (the order of the cases matches the order
+	// of the corresponding node types in ast.go)
+	switch n := node.(type) {
+	case *Module:
+		if n.Id != nil {
+			Walk(v, n.Id)
+		}
+		walkDeclList(v, n.Decls)
+
+	case *ImportDecl:
+		if n.Alias != nil {
+			Walk(v, n.Alias)
+		}
+		Walk(v, n.Path)
+		for _, fn := range n.Funcs {
+			Walk(v, fn)
+		}
+
+	case *ImportedFunc:
+		Walk(v, n.Name)
+		Walk(v, n.Arity)
+
+	case *Annotation:
+		Walk(v, n.Name)
+		walkExprList(v, n.Args)
+
+	case *TypeDecl:
+		walkAnnotations(v, n.Annotations)
+		Walk(v, n.Name)
+		Walk(v, n.Definition)
+
+	case *ConstDecl:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+
+	case *GuardDecl:
+		Walk(v, n.Name)
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+
+	case *FuncDecl:
+		walkAnnotations(v, n.Annotations)
+		Walk(v, n.Name)
+		walkExprList(v, n.Parameters)
+		if n.Guard != nil {
+			Walk(v, n.Guard)
+		}
+		walkStmtList(v, n.Statements)
+
+	case *GuardSeq:
+		for _, guard := range n.Guards {
+			walkExprList(v, guard)
+		}
+
+	case *BadDecl, *BadStmt, *BadExpr:
+		// nothing to do
+
+	case *ExprStatement:
+		Walk(v, n.Expression)
+
+	case *ReturnStatement:
+		Walk(v, n.Expression)
+
+	case *DeferStmt:
+		Walk(v, n.Expression)
+
+	case *WhileStmt:
+		Walk(v, n.Cond)
+		walkStmtList(v, n.Body)
+
+	case *IfStmt:
+		if n.Init != nil {
+			Walk(v, n.Init)
+		}
+		Walk(v, n.Cond)
+		walkStmtList(v, n.Body)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+
+	case *BlockStmt:
+		walkStmtList(v, n.List)
+
+	case *TupleType:
+		for _, f := range n.Elts.List {
+			for _, name := range f.Names {
+				Walk(v, name)
+			}
+			if f.Type != nil {
+				Walk(v, f.Type)
+			}
+		}
+
+	case *CallExpr:
+		Walk(v, n.Callee)
+		walkExprList(v, n.Arguments)
+
+	case *DotExpr:
+		Walk(v, n.Target)
+		Walk(v, n.Attribute)
+
+	case *IndexExpr:
+		Walk(v, n.Target)
+		Walk(v, n.Index)
+
+	case *UnaryExpr:
+		Walk(v, n.Right)
+
+	case *BinaryExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *StringLiteral, *AtomLiteral, *IntLiteral, *FloatLiteral, *NilLiteral, *Identifier:
+		// nothing to do
+
+	case *ListExpr:
+		walkExprList(v, n.Elements)
+		if n.Tail != nil {
+			Walk(v, n.Tail)
+		}
+
+	case *KVExpr:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+
+	case *ParenExpr:
+		Walk(v, n.Expression)
+
+	case *AssignExpr:
+		Walk(v, n.Left)
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		Walk(v, n.Right)
+
+	case *MatchAssignExpr:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *MultiAssignExpr:
+		for _, ident := range n.Left {
+			Walk(v, ident)
+		}
+		Walk(v, n.Right)
+
+	case *TupleExpr:
+		walkExprList(v, n.Elements)
+
+	case *InterpString:
+		walkExprList(v, n.Parts)
+
+	case *TypeTestExpr:
+		Walk(v, n.X)
+		Walk(v, n.Type)
+
+	case *CatchExpr:
+		Walk(v, n.Expr)
+
+	case *PinExpr:
+		Walk(v, n.Var)
+
+	case *FuncRef:
+		Walk(v, n.Name)
+		Walk(v, n.Arity)
+
+	case *TernaryExpr:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		Walk(v, n.Else)
+
+	case *LetExpr:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+		Walk(v, n.Body)
+
+	case *FuncLit:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkExprList(v, n.Parameters)
+		walkStmtList(v, n.Statements)
+
+	case *CaseExpr:
+		Walk(v, n.Value)
+		for _, clause := range n.Clauses {
+			Walk(v, clause)
+		}
+
+	case *ReceiveExpr:
+		for _, clause := range n.Clauses {
+			Walk(v, clause)
+		}
+		if n.Timeout != nil {
+			Walk(v, n.Timeout)
+		}
+		if n.Action != nil {
+			Walk(v, n.Action)
+		}
+
+	case *Clause:
+		walkExprList(v, n.Patterns)
+		if n.Guard != nil {
+			Walk(v, n.Guard)
+		}
+		Walk(v, n.Body)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -1,6 +1,7 @@
 package build
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -11,7 +12,7 @@ import (
 	"github.com/masp/garlang/compiler"
 	"github.com/masp/garlang/core"
 	"github.com/masp/garlang/parser"
-	"github.com/masp/garlang/token"
+	"github.com/masp/garlang/types"
 )
 
 const Help = `Usage: gar build [options] <file>
@@ -19,17 +20,23 @@ const Help = `Usage: gar build [options] <file>
 Options:
   -o <file>  Write output to <file> instead. Default: <inputpath>.core
   -beam      Compile to BEAM instead of Core Erlang
+  -werror    Treat warnings as errors
+  -nofold    Don't evaluate operators on constants at compile time
 `
 
 var (
 	flagOutput *string
 	flagBeam   *bool
+	flagWerror *bool
+	flagNoFold *bool
 )
 
 func parseFlags(args []string) (*flag.FlagSet, error) {
 	fset := flag.NewFlagSet("build", flag.ContinueOnError)
 	flagOutput = fset.String("o", "", "")
 	flagBeam = fset.Bool("beam", false, "")
+	flagWerror = fset.Bool("werror", false, "")
+	flagNoFold = fset.Bool("nofold", false, "")
 	fset.Usage = func() {
 		fmt.Fprint(os.Stdout, Help)
 	}
@@ -57,18 +64,41 @@ func Main(args []string) error {
 	}
 
 	garMod, err := parser.Module(inputName, inputSrc)
-	if lexErrs, ok := err.(token.ErrorList); ok {
-		for _, err := range lexErrs {
-			fmt.Fprintf(os.Stderr, "%s:%d:%d: %v", inputName, err.Pos.Line, err.Pos.Column, err.Msg)
+	var parseErr parser.Error
+	if errors.As(err, &parseErr) {
+		for _, err := range parseErr.Errors {
+			fmt.Fprintf(os.Stderr, "%s: parse error: %v\n", err.Pos, err.Msg)
 		}
+		return errors.New("parse failed")
 	} else if err != nil {
 		return fmt.Errorf("parse: %w", err)
 	}
 
-	coreMod, err := compiler.New().CompileModule(garMod)
-	if err != nil {
+	if err := types.Check(garMod); err != nil {
+		return fmt.Errorf("type check: %w", err)
+	}
+
+	var opts []compiler.Option
+	if *flagWerror {
+		opts = append(opts, compiler.WerrorMode())
+	}
+	if *flagNoFold {
+		opts = append(opts, compiler.WithoutConstFold())
+	}
+	comp := compiler.New(opts...)
+	coreMod, err := comp.CompileModule(garMod)
+	var compileErr compiler.Error
+	if errors.As(err, &compileErr) {
+		return fmt.Errorf("compile error: %w", compileErr.Err)
+	} else if err != nil {
 		return fmt.Errorf("compile: %w", err)
 	}
+	for _, warning := range comp.Warnings() {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", warning)
+	}
+	if err := core.Validate(coreMod); err != nil {
+		return fmt.Errorf("internal compiler error: %w", err)
+	}
 
 	output, err := findOutput(input)
 	if err != nil {
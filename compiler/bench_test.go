@@ -0,0 +1,40 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/internal/bench"
+	"github.com/masp/garlang/parser"
+)
+
+// BenchmarkCompileModule compiles a large module with and without the atom table, to
+// show how many allocations interning the atoms saves.
+func BenchmarkCompileModule(b *testing.B) {
+	mod, err := parser.Module("bench.gar", bench.Module(500))
+	if err != nil {
+		b.Fatalf("parse: %v", err)
+	}
+	for _, bm := range []struct {
+		name   string
+		intern bool
+	}{
+		{"interned", true},
+		{"plain", false},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			c := New()
+			if !bm.intern {
+				c.atoms = nil
+			}
+			if _, err := c.CompileModule(mod); err != nil {
+				b.Fatalf("compile: %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.CompileModule(mod)
+			}
+		})
+	}
+}
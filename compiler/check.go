@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/core"
+	"github.com/masp/garlang/token"
+)
+
+// Severity tells errors, which fail a compile, apart from warnings.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem in a module reported by Check.
+type Diagnostic struct {
+	Pos      token.Position // Line is 0 if the problem is not at a place in the source
+	Severity Severity
+	Msg      string
+}
+
+func (d Diagnostic) String() string {
+	return d.Pos.String() + ": " + d.Severity.String() + ": " + d.Msg
+}
+
+// Check reports the problems that building mod would, sorted by position, for an
+// editor that only wants diagnostics. These are the compile error, if any, the
+// warnings, and the problems core.Validate finds in the compiled module, like calls of
+// undefined functions or with the wrong number of arguments, which are reported at the
+// function they are in. In WerrorMode the warnings are errors.
+//
+// Check runs the whole pipeline, compiling mod to Core Erlang and validating it, so it
+// costs as much as a build without the output. The compiled module is thrown away.
+func (c *Compiler) Check(mod *ast.Module) []Diagnostic {
+	var diags []Diagnostic
+	coreMod, err := c.CompileModule(mod)
+	var compileErr Error
+	if errors.As(err, &compileErr) {
+		err = compileErr.Err
+	}
+	var tokErr *token.Error
+	switch {
+	case errors.As(err, &tokErr):
+		diags = append(diags, Diagnostic{Pos: tokErr.Pos, Severity: SeverityError, Msg: tokErr.Msg.Error()})
+	case errors.As(err, new(token.ErrorList)):
+		// the warnings in WerrorMode, which are added below
+	case err != nil:
+		diags = append(diags, Diagnostic{Pos: token.Position{Filename: mod.File.Name}, Severity: SeverityError, Msg: err.Error()})
+	}
+
+	severity := SeverityWarning
+	if c.werror {
+		severity = SeverityError
+	}
+	for _, warning := range c.warnings {
+		diags = append(diags, Diagnostic{Pos: warning.Pos, Severity: severity, Msg: warning.Msg.Error()})
+	}
+
+	if err == nil {
+		if err := core.Validate(coreMod); err != nil {
+			errs := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			}
+			for _, err := range errs {
+				diag := Diagnostic{Pos: token.Position{Filename: mod.File.Name}, Severity: SeverityError, Msg: err.Error()}
+				if errors.As(err, &tokErr) {
+					diag.Pos, diag.Msg = tokErr.Pos, tokErr.Msg.Error()
+				}
+				diags = append(diags, diag)
+			}
+		}
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Pos.Offset < diags[j].Pos.Offset
+	})
+	return diags
+}
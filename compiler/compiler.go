@@ -3,11 +3,18 @@ package compiler
 
 import (
 	"fmt"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/masp/garlang/ast"
 	"github.com/masp/garlang/core"
 	"github.com/masp/garlang/parser"
+	"github.com/masp/garlang/token"
 )
 
 type Environment struct {
@@ -15,77 +22,1510 @@ type Environment struct {
 }
 
 type Compiler struct {
-	errors []error
+	errors   []error         // errors found while compiling expressions, which can't return them
+	warnings token.ErrorList // non-fatal problems found by the last compile
+	noWarn   bool            // suppresses warnings, e.g. for the base functions
+	werror   bool            // report warnings as errors
+	noFold   bool            // don't evaluate operators on constants at compile time
+	version  core.Version    // Core Erlang syntax of the compiled modules
+	inline   int             // size of the largest function inlined, 0 to not inline
+
+	baseDecls []ast.Decl // functions injected into every compiled module
+	baseErr   error      // error parsing the base functions, reported on compile
+	module    string     // name of the module currently being compiled
+	file      *token.File
+
+	consts   map[string]*ast.ConstDecl  // module constants, inlined where referenced
+	guards   map[string]*ast.GuardDecl  // module guards, inlined where called
+	imports  map[core.FuncName]string   // functions imported by name, and the module they are from
+	arities  map[string][]int           // arities of the module's functions by name, in declaration order
+	aliases  map[string]*ast.Identifier // aliases of imported modules, like foo in `import foo "bar"`
+	inlining []inlinedGuard             // guards being inlined, innermost last
+	guard    bool                       // compiling a guard, where an exception is a failed test
+	pins     []core.Expr                // tests for the variables pinned by the patterns being compiled
+	patVars  map[string]bool            // variables bound by the patterns being compiled
+
+	pos      token.Pos                // node being compiled, for internal compiler errors
+	fn       string                   // name of the function being compiled
+	funs     map[string]core.FuncName // named funs visible where the current expression is
+	nextFun  int                      // counter for named funs, reset per function
+	nextLoop int                      // counter for loop helper functions, reset per function
+	nextVar  int                      // counter for compiler generated variables, reset per function
+	bound    map[string]bool          // variables bound in the current function
+	decls    []*ast.Identifier        // where each variable in the current function is bound, in order
+	used     map[string]bool          // variables referenced in the current function
+
+	atoms map[string]core.Expr // interned atoms, so every use of an atom shares one value
+}
+
+// Error is returned by CompileModule and CompileFunction when the AST can't be compiled,
+// so callers can tell compile errors apart from errors in other phases with errors.As.
+// Err is a *token.Error, or a token.ErrorList of the warnings in WerrorMode.
+type Error struct {
+	Err error
+}
+
+func (e Error) Error() string { return e.Err.Error() }
+func (e Error) Unwrap() error { return e.Err }
+
+// Option configures a Compiler created with New.
+type Option func(*Compiler)
+
+// WithBaseFuncs replaces the functions injected into every compiled module (by default
+// the module_info functions) with the functions declared in src. src must be a complete
+// module, but only its declarations are used. The atom '{{mod}}' in src is replaced with
+// the name of the module being compiled.
+func WithBaseFuncs(src []byte) Option {
+	return func(c *Compiler) {
+		c.baseDecls, c.baseErr = parseBaseFuncs(src)
+	}
+}
+
+// WithoutConstFold compiles operators on constants to calls of the Erlang operators
+// instead of their value, so `2 + 3` is call 'erlang':'+'(2, 3) and not 5. It is meant
+// for debugging how operators are compiled.
+func WithoutConstFold() Option {
+	return func(c *Compiler) {
+		c.noFold = true
+	}
+}
+
+// WerrorMode makes any warning fail the compile. CompileModule and CompileFunction return
+// an Error wrapping the warnings as a token.ErrorList instead of succeeding.
+func WerrorMode() Option {
+	return func(c *Compiler) {
+		c.werror = true
+	}
+}
+
+// WithCoreVersion compiles modules to be printed in the Core Erlang syntax of version v,
+// for an older OTP release or tools that only read older syntax. The default is the
+// latest version.
+func WithCoreVersion(v core.Version) Option {
+	return func(c *Compiler) {
+		c.version = v
+	}
+}
+
+// WithInlineThreshold inlines the calls of local functions whose bodies have at most n
+// Core Erlang expressions, like `func double(x) { return x * 2 }`, to save the cost of
+// the call. Recursive functions are never inlined. By default nothing is inlined, so
+// every call shows up in stack traces.
+func WithInlineThreshold(n int) Option {
+	return func(c *Compiler) {
+		c.inline = n
+	}
+}
+
+func New(opts ...Option) *Compiler {
+	c := &Compiler{atoms: make(map[string]core.Expr)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.baseDecls == nil && c.baseErr == nil {
+		c.baseDecls, c.baseErr = defaultBaseFuncs()
+	}
+	return c
+}
+
+// CompileModule compiles mod into a Core Erlang module. A successful compile may still
+// report warnings, which are available from Warnings until the next compile.
+//
+// A panic while compiling is a bug in the compiler, and is returned as an internal
+// compiler error instead of crashing the caller.
+func (c *Compiler) CompileModule(mod *ast.Module) (coreMod *core.Module, err error) {
+	c.warnings = nil
+	c.pos = token.NoPos
+	if c.baseErr != nil {
+		return nil, c.baseErr
+	}
+	defer c.recoverInternal(&err)
+	coreMod, err = c.compileModule(mod, withBaseFuncs(mod, c.baseDecls))
+	if err == nil {
+		err = c.warningErr()
+	}
+	if err != nil {
+		return coreMod, Error{Err: err}
+	}
+	return coreMod, nil
+}
+
+// compileModule compiles a module AST into a Core Erlang module.
+func (c *Compiler) compileModule(mod *ast.Module, decls []ast.Decl) (*core.Module, error) {
+	coreMod := &core.Module{
+		Name:    mod.Id.Name,
+		Version: c.version,
+	}
+	c.module = mod.Id.Name
+	c.file = mod.File
+	if err := c.collectConsts(decls); err != nil {
+		return coreMod, err
+	}
+	if err := c.collectGuards(decls); err != nil {
+		return coreMod, err
+	}
+	if err := c.collectImports(decls); err != nil {
+		return coreMod, err
+	}
+
+	nbase := len(decls) - len(mod.Decls)
+	defined := make(map[core.FuncName]*ast.FuncDecl)
+	for i := 0; i < len(decls); i++ {
+		decl := decls[i]
+		c.pos = decl.Pos()
+		// the base functions are not written by the user, so don't warn about them
+		c.noWarn = i < nbase
+		switch d := decl.(type) {
+		case *ast.ConstDecl, *ast.GuardDecl:
+			continue // inlined at every use
+		case *ast.ImportDecl:
+			continue // imported functions are called where they are used
+		case *ast.TypeDecl:
+			// types are only checked by tooling, they have no code
+			for _, ann := range d.Annotations {
+				c.warnf(ann.Name.Pos(), "annotation @%s has no effect on a type", ann.Name.Name)
+			}
+			continue
+		case *ast.FuncDecl:
+			// like in Erlang, consecutive declarations with the same name and arity are
+			// the heads of one function
+			heads := []*ast.FuncDecl{d}
+			for i+1 < len(decls) && sameFunc(decls[i+1], d) {
+				i++
+				heads = append(heads, decls[i].(*ast.FuncDecl))
+			}
+			name := core.FuncName{Name: d.Name.Name, Arity: len(d.Parameters)}
+			if prev, ok := defined[name]; ok {
+				prevPos := c.file.Position(prev.Name.Pos())
+				return coreMod, c.errorf(d.Name.Pos(), "function %s/%d redeclared, previous declaration at %s", name.Name, name.Arity, prevPos)
+			}
+			defined[name] = d
+			coreFn, err := c.compileFunction(heads)
+			if err != nil {
+				return coreMod, err
+			}
+			attrs, err := c.compileAnnotations(heads, coreFn.Name)
+			if err != nil {
+				return coreMod, err
+			}
+			coreMod.Attributes = append(coreMod.Attributes, attrs...)
+			if d.IsPublic() {
+				coreMod.Exports = append(coreMod.Exports, coreFn.Name)
+				if i >= nbase {
+					if coreMod.ExportPos == nil {
+						coreMod.ExportPos = make(map[core.FuncName]token.Position)
+					}
+					coreMod.ExportPos[coreFn.Name] = c.file.Position(d.Pos())
+				}
+			}
+			if i >= nbase {
+				if coreMod.FuncPos == nil {
+					coreMod.FuncPos = make(map[core.FuncName]token.Position)
+				}
+				coreMod.FuncPos[coreFn.Name] = c.file.Position(d.Pos())
+			}
+			coreMod.Functions = append(coreMod.Functions, coreFn)
+		default:
+			panic(fmt.Errorf("unrecognized decl: %T", decl))
+		}
+	}
+	c.noWarn = false
+	inlineCalls(coreMod, c.inline)
+	// sorted, so the output doesn't depend on the order of the declarations
+	sort.Slice(coreMod.Exports, func(i, j int) bool {
+		a, b := coreMod.Exports[i], coreMod.Exports[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Arity < b.Arity
+	})
+	return coreMod, nil
+}
+
+// Warnings returns the warnings reported by the last call to CompileModule or CompileFunction,
+// like variables that are never used. Warnings never prevent a module from compiling.
+func (c *Compiler) Warnings() token.ErrorList {
+	return c.warnings
+}
+
+func (c *Compiler) CompileFunction(fn *ast.FuncDecl) (coreFn core.Func, err error) {
+	c.warnings = nil
+	c.pos = token.NoPos
+	defer c.recoverInternal(&err)
+	coreFn, err = c.compileFunction([]*ast.FuncDecl{fn})
+	if err == nil {
+		err = c.warningErr()
+	}
+	if err != nil {
+		return coreFn, Error{Err: err}
+	}
+	return coreFn, nil
+}
+
+// CompileExpression compiles a single expression, like an expression typed into a shell,
+// to a Core Erlang expression. Variables that the expression doesn't bind are expected to
+// be bound where the result is evaluated. The expression is not part of a module, so it
+// can't refer to the constants, guards or imports of a previously compiled module. file is
+// the file expr was parsed from, which gives errors and warnings their position, or nil.
+func (c *Compiler) CompileExpression(file *token.File, expr ast.Expression) (coreExpr core.Expr, err error) {
+	c.warnings = nil
+	c.pos = token.NoPos
+	c.file, c.consts, c.guards, c.imports = file, nil, nil, nil
+	defer c.recoverInternal(&err)
+	c.startFunction("")
+	coreExpr = c.compileExpr(expr)
+	c.checkUnused()
+	if len(c.errors) > 0 {
+		err = c.errors[0]
+	} else {
+		err = c.warningErr()
+	}
+	if err != nil {
+		return coreExpr, Error{Err: err}
+	}
+	return coreExpr, nil
+}
+
+// Expression parses and compiles the expression in src with a new Compiler. It is the
+// evaluation primitive of a shell, which runs the result with the shell's bindings.
+func Expression(src []byte) (core.Expr, error) {
+	expr, file, err := parser.Expression(src)
+	if err != nil {
+		return nil, err
+	}
+	return New().CompileExpression(file, expr)
+}
+
+// startFunction resets the state kept while compiling a function, before compiling the
+// function called name.
+func (c *Compiler) startFunction(name string) {
+	c.nextVar = 0
+	c.nextFun = 0
+	c.nextLoop = 0
+	c.errors = nil
+	c.funs = nil
+	c.fn = name
+	c.bound = make(map[string]bool)
+	c.decls = nil
+	c.used = make(map[string]bool)
+}
+
+// recoverInternal turns a panic into an internal compiler error at the node that was
+// being compiled, which is stored in *err.
+func (c *Compiler) recoverInternal(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if c.file != nil && c.pos.IsValid() {
+		*err = Error{Err: fmt.Errorf("internal compiler error at %s: %v", c.file.Position(c.pos), r)}
+	} else {
+		*err = Error{Err: fmt.Errorf("internal compiler error: %v", r)}
+	}
+}
+
+// warningErr returns the warnings as an error if warnings are errors.
+func (c *Compiler) warningErr() error {
+	if c.werror && len(c.warnings) > 0 {
+		return c.warnings
+	}
+	return nil
+}
+
+// sameFunc reports whether decl is another head of the function fn.
+func sameFunc(decl ast.Decl, fn *ast.FuncDecl) bool {
+	d, ok := decl.(*ast.FuncDecl)
+	return ok && d.Name.Name == fn.Name.Name && len(d.Parameters) == len(fn.Parameters)
+}
+
+// compileFunction compiles the heads of a function into a single Core Erlang function.
+func (c *Compiler) compileFunction(heads []*ast.FuncDecl) (core.Func, error) {
+	fn := heads[0]
+	c.startFunction(fn.Name.Name)
+	defer c.checkUnused()
+	coreFn := core.Func{
+		Name: core.FuncName{Name: fn.Name.Name, Arity: len(fn.Parameters)},
+		Annotation: core.Annotation{Attrs: []core.Const{
+			core.ConstTuple{Elements: []core.Const{
+				c.constAtom("function"),
+				core.ConstTuple{
+					Elements: []core.Const{c.constAtom(fn.Name.Name), core.Integer{Value: int64(len(fn.Parameters))}},
+				},
+			}},
+		}},
+	}
+
+	var err error
+	if len(heads) == 1 {
+		coreFn.Parameters, coreFn.Body, err = c.compileFuncBody(fn.Parameters, fn.Guard, fn.Statements)
+	} else {
+		coreFn.Parameters, coreFn.Body, err = c.compileHeads(heads)
+	}
+	if err != nil {
+		return coreFn, err
+	}
+	coreFn.Body = propagateConsts(coreFn.Body)
+	return coreFn, nil
+}
+
+// compileAnnotations compiles the annotations of a function to the module attributes
+// Erlang reads them from:
+//
+//	@inline                  -compile({inline, [f/N]}).
+//	@deprecated              -deprecated([{f, N}]).
+//	@deprecated("use g")     -deprecated([{f, N, "use g"}]).
+//
+// Any other annotation is ignored with a warning.
+func (c *Compiler) compileAnnotations(heads []*ast.FuncDecl, name core.FuncName) ([]core.Attribute, error) {
+	fn := []core.Const{c.constAtom(name.Name), core.Integer{Value: int64(name.Arity)}}
+	var attrs []core.Attribute
+	for _, head := range heads {
+		for _, ann := range head.Annotations {
+			switch ann.Name.Name {
+			case "inline":
+				if len(ann.Args) > 0 {
+					return nil, c.errorf(ann.Args[0].Pos(), "@inline takes no arguments")
+				}
+				inline := core.ConstTuple{Elements: []core.Const{
+					c.constAtom("inline"),
+					core.ConstList{Elements: []core.Const{core.ConstTuple{Elements: fn}}},
+				}}
+				attrs = append(attrs, core.Attribute{
+					Key:   core.Atom{Value: "compile"},
+					Value: core.ConstList{Elements: []core.Const{inline}},
+				})
+			case "deprecated":
+				desc := fn
+				if len(ann.Args) > 0 {
+					lit, ok := ann.Args[0].(*ast.StringLiteral)
+					if !ok || len(ann.Args) > 1 {
+						return nil, c.errorf(ann.Args[0].Pos(), "@deprecated takes no arguments or a string")
+					}
+					desc = append(desc[:len(desc):len(desc)], core.String{Value: lit.Value})
+				}
+				attrs = append(attrs, core.Attribute{
+					Key:   core.Atom{Value: "deprecated"},
+					Value: core.ConstList{Elements: []core.Const{core.ConstTuple{Elements: desc}}},
+				})
+			default:
+				c.warnf(ann.Name.Pos(), "unknown annotation @%s", ann.Name.Name)
+			}
+		}
+	}
+	return attrs, nil
+}
+
+// compileFuncBody compiles the parameters and statements of a function or fun.
+func (c *Compiler) compileFuncBody(params []ast.Expression, guardSeq *ast.GuardSeq, stmts []ast.Statement) ([]core.Var, core.Expr, error) {
+	if names, ok := paramNames(params); ok && guardSeq == nil {
+		var vars []core.Var
+		for i, name := range names {
+			c.bind(params[i].(*ast.Identifier))
+			vars = append(vars, coreVar(name))
+		}
+		body, err := c.compileStatements(stmts)
+		return vars, body, err
+	}
+
+	// At least one parameter is a pattern or the function has a guard, so the arguments
+	// are bound to fresh variables and matched against the patterns in a case.
+	clause, err := c.compileHead(params, guardSeq, stmts)
+	if err != nil {
+		return nil, nil, err
+	}
+	args, body := c.matchArgs(len(params), []core.Clause{clause})
+	return args, body, nil
+}
+
+// compileHeads compiles a function with several heads to a case over its arguments with a
+// clause for each head, which are tried in order. The variables bound by a head are only
+// visible in that head.
+func (c *Compiler) compileHeads(heads []*ast.FuncDecl) ([]core.Var, core.Expr, error) {
+	var clauses []core.Clause
+	var earlier [][]core.Expr
+	for _, head := range heads {
+		outer := c.saveBound()
+		clause, err := c.compileHead(head.Parameters, head.Guard, head.Statements)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.checkReachable(head.Pos(), clause, &earlier)
+		clauses = append(clauses, clause)
+		c.bound = outer
+	}
+	args, body := c.matchArgs(len(heads[0].Parameters), clauses)
+	return args, body, nil
+}
+
+// compileHead compiles the parameters of a function head to the patterns of a clause.
+func (c *Compiler) compileHead(params []ast.Expression, guardSeq *ast.GuardSeq, stmts []ast.Statement) (core.Clause, error) {
+	var clause core.Clause
+	for _, param := range params {
+		pattern, err := c.compilePattern(param)
+		if err != nil {
+			c.pins, c.patVars = nil, nil
+			return clause, err
+		}
+		clause.Patterns = append(clause.Patterns, pattern)
+	}
+	if guardSeq != nil {
+		clause.Guard = c.compileGuard(guardSeq)
+	}
+	clause.Guard = c.takePins(clause.Guard)
+	var err error
+	clause.Body, err = c.compileStatements(stmts)
+	return clause, err
+}
+
+// matchArgs binds arity arguments to fresh variables and matches them against the
+// clauses in a case. If no clause matches, the function fails with function_clause like
+// in Erlang.
+func (c *Compiler) matchArgs(arity int, clauses []core.Clause) ([]core.Var, core.Expr) {
+	args := c.freshVars(arity)
+	failArgs := c.freshVars(arity)
+	clauses = append(clauses, core.Clause{Patterns: exprs(failArgs), Body: c.matchFail("function_clause", failArgs)})
+	return args, core.Case{Arg: values(args), Clauses: clauses}
+}
+
+// compileGuard lowers a guard sequence to a single guard expression. The tests in a guard
+// are joined with 'and' and the alternative guards are joined with 'or'.
+func (c *Compiler) compileGuard(seq *ast.GuardSeq) core.Expr {
+	c.guard = true
+	defer func() { c.guard = false }()
+	var result core.Expr
+	for _, guard := range seq.Guards {
+		var conj core.Expr
+		for _, test := range guard {
+			c.errors = append(c.errors, c.checkGuard(test)...)
+			if conj == nil {
+				conj = c.compileExpr(test)
+			} else {
+				conj = c.operatorCall(token.And, conj, c.compileExpr(test))
+			}
+		}
+		if result == nil {
+			result = conj
+		} else {
+			result = c.operatorCall(token.Or, result, conj)
+		}
+	}
+	return result
+}
+
+// paramNames returns the names of the parameters if every parameter is a plain identifier
+// and no name repeats, since a repeated parameter must match the same value.
+func paramNames(params []ast.Expression) ([]string, bool) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, param := range params {
+		ident, ok := param.(*ast.Identifier)
+		if !ok || seen[ident.Name] {
+			return nil, false
+		}
+		seen[ident.Name] = true
+		names = append(names, ident.Name)
+	}
+	return names, true
+}
+
+// coreVar converts a garlang variable name into a Core Erlang variable. Core Erlang
+// variables must start with an uppercase letter or '_', so the first letter is uppercased.
+//
+// Core Erlang variables can't be quoted, so a quoted name like `weird name` that is not
+// a valid identifier is encoded after a "V@" prefix, with every byte other than a letter,
+// digit or '_' written as '@' and its hex value. No unquoted name can contain '@'.
+func coreVar(name string) core.Var {
+	if !isIdent(name) {
+		var b strings.Builder
+		b.WriteString("V@")
+		for i := 0; i < len(name); i++ {
+			if ch := name[i]; isIdentByte(ch) {
+				b.WriteByte(ch)
+			} else {
+				fmt.Fprintf(&b, "@%02x", ch)
+			}
+		}
+		return core.Var{Name: b.String()}
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return core.Var{Name: string(unicode.ToUpper(r)) + name[size:]}
+}
+
+// isIdent reports whether name could be written as an unquoted identifier.
+func isIdent(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentByte(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_'
+}
+
+// freshVars returns n new compiler generated variables that cannot conflict with user variables.
+func (c *Compiler) freshVars(n int) []core.Var {
+	vars := make([]core.Var, n)
+	for i := range vars {
+		vars[i] = core.Var{Name: "_" + strconv.Itoa(c.nextVar)}
+		c.nextVar++
+	}
+	return vars
+}
+
+func exprs(vars []core.Var) []core.Expr {
+	result := make([]core.Expr, len(vars))
+	for i, v := range vars {
+		result[i] = v
+	}
+	return result
+}
+
+// values groups vars into a single case argument.
+func values(vars []core.Var) core.Expr {
+	if len(vars) == 1 {
+		return vars[0]
+	}
+	return core.Values{Elements: exprs(vars)}
+}
+
+// bindVar binds the variable ident in a pattern and returns it. The wildcard `_` binds
+// nothing and is a fresh variable instead, so every `_` in `{_, _}` matches any value.
+//
+// Core Erlang doesn't allow a variable twice in one pattern, so a repeat like the second
+// x in `{x, x}` is a fresh variable that the guard of the clause compares to the first,
+// like a pin.
+func (c *Compiler) bindVar(ident *ast.Identifier) core.Var {
+	if ident.Name == "_" {
+		return c.freshVars(1)[0]
+	}
+	if c.patVars[ident.Name] {
+		c.used[ident.Name] = true
+		v := c.freshVars(1)[0]
+		c.pins = append(c.pins, c.operatorCall(token.EqualEqualEqual, v, coreVar(ident.Name)))
+		return v
+	}
+	if c.patVars == nil {
+		c.patVars = make(map[string]bool)
+	}
+	c.patVars[ident.Name] = true
+	c.bind(ident)
+	return coreVar(ident.Name)
+}
+
+// bind marks the variable ident as bound in the current function.
+func (c *Compiler) bind(ident *ast.Identifier) {
+	if c.bound[ident.Name] {
+		// binding a variable again shadows the earlier binding. Uses are only tracked by
+		// name, so they can't tell the two apart, and the name counts as used to avoid
+		// warning about either binding.
+		c.used[ident.Name] = true
+		return
+	}
+	if _, ok := c.consts[ident.Name]; ok {
+		c.warnf(ident.Pos(), "%s shadows constant", ident.Name)
+	}
+	if alias, ok := c.aliases[ident.Name]; ok {
+		c.errors = append(c.errors, c.errorf(ident.Pos(), "variable %s collides with import alias declared at %s", ident.Name, c.file.Position(alias.Pos())))
+	}
+	c.bound[ident.Name] = true
+	c.decls = append(c.decls, ident)
+}
+
+// saveBound returns a copy of the bound variables, which is restored after compiling
+// code whose bindings are not visible after it, like a loop body.
+func (c *Compiler) saveBound() map[string]bool {
+	saved := make(map[string]bool, len(c.bound))
+	for k, v := range c.bound {
+		saved[k] = v
+	}
+	return saved
+}
+
+// checkUnused warns about every variable bound in the current function that is never used.
+// Like in Erlang, variables starting with '_' are exempt.
+func (c *Compiler) checkUnused() {
+	for _, ident := range c.decls {
+		if !c.used[ident.Name] && !strings.HasPrefix(ident.Name, "_") {
+			c.warnf(ident.Pos(), "%s declared and not used", ident.Name)
+		}
+	}
+}
+
+// atom returns the atom name as an expression. Atoms are interned, because a module
+// uses the same few atoms many times and boxing each of them into a core.Expr would
+// allocate. A Compiler without a table, like the zero value, doesn't intern. A field
+// of type core.Atom, like PrimOp.Name, holds the atom without boxing it, so it doesn't
+// need the table.
+func (c *Compiler) atom(name string) core.Expr {
+	if c.atoms == nil {
+		return core.Atom{Value: name}
+	}
+	a, ok := c.atoms[name]
+	if !ok {
+		a = core.Atom{Value: name}
+		c.atoms[name] = a
+	}
+	return a
+}
+
+// constAtom returns the interned atom name as a constant, for annotations and attributes.
+func (c *Compiler) constAtom(name string) core.Const {
+	return c.atom(name).(core.Const)
+}
+
+// matchFail raises a match error with the given reason, e.g. function_clause.
+func (c *Compiler) matchFail(reason string, args []core.Var) core.Expr {
+	return core.PrimOp{
+		Name: core.Atom{Value: "match_fail"},
+		Args: []core.Expr{core.Tuple{Elements: append([]core.Expr{c.atom(reason)}, exprs(args)...)}},
+	}
+}
+
+// compilePattern compiles an expression in a pattern position, like a function parameter.
+func (c *Compiler) compilePattern(expr ast.Expression) (core.Expr, error) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return c.bindVar(expr), nil
+	case *ast.IntLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.AtomLiteral, *ast.NilLiteral:
+		return c.compileExpr(expr), nil
+	case *ast.ParenExpr:
+		return c.compilePattern(expr.Expression)
+	case *ast.PinExpr:
+		// Core Erlang patterns can't refer to bound variables, so the pinned value is
+		// matched by a fresh variable that the guard of the clause compares to it
+		if !c.bound[expr.Var.Name] {
+			return nil, c.errorf(expr.Var.Pos(), "cannot pin %s, which is not bound", expr.Var.Name)
+		}
+		v := c.freshVars(1)[0]
+		c.pins = append(c.pins, c.operatorCall(token.EqualEqualEqual, v, c.compileExpr(expr.Var)))
+		return v, nil
+	case *ast.AssignExpr:
+		// an alias like `all = {a, b}` binds the whole value as well as its parts
+		v := c.bindVar(expr.Left)
+		pattern, err := c.compilePattern(expr.Right)
+		if err != nil {
+			return nil, err
+		}
+		return core.Alias{Var: v, Pattern: pattern}, nil
+	case *ast.ListExpr:
+		var tail core.Expr = core.Nil{}
+		if expr.Tail != nil {
+			var err error
+			tail, err = c.compilePattern(expr.Tail)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := len(expr.Elements) - 1; i >= 0; i-- {
+			head, err := c.compilePattern(expr.Elements[i])
+			if err != nil {
+				return nil, err
+			}
+			tail = core.Cons{Head: head, Tail: tail}
+		}
+		return tail, nil
+	case *ast.TupleExpr:
+		var elems []core.Expr
+		for _, elt := range expr.Elements {
+			pattern, err := c.compilePattern(elt)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, pattern)
+		}
+		return core.Tuple{Elements: elems}, nil
+	default:
+		return nil, c.errorf(expr.Pos(), "invalid pattern")
+	}
+}
+
+// takePins returns guard with the tests for the variables pinned by the patterns just
+// compiled, which come before the tests of guard, if any.
+func (c *Compiler) takePins(guard core.Expr) core.Expr {
+	var result core.Expr
+	for _, test := range c.pins {
+		if result == nil {
+			result = test
+		} else {
+			result = c.operatorCall(token.And, result, test)
+		}
+	}
+	c.pins, c.patVars = nil, nil
+	if result == nil {
+		return guard
+	}
+	if guard != nil {
+		result = c.operatorCall(token.And, result, guard)
+	}
+	return result
+}
+
+// collectConsts records the constants declared in decls so they can be inlined, and checks
+// that every constant has a constant value.
+func (c *Compiler) collectConsts(decls []ast.Decl) error {
+	c.consts = make(map[string]*ast.ConstDecl)
+	for _, decl := range decls {
+		if d, ok := decl.(*ast.ConstDecl); ok {
+			if prev, ok := c.consts[d.Name.Name]; ok {
+				prevPos := c.file.Position(prev.Name.Pos())
+				return c.errorf(d.Name.Pos(), "const %s redeclared, previous declaration at %s", d.Name.Name, prevPos)
+			}
+			c.consts[d.Name.Name] = d
+		}
+	}
+	for _, decl := range decls {
+		if d, ok := decl.(*ast.ConstDecl); ok {
+			if err := c.checkConst(d.Value, map[string]bool{d.Name.Name: true}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collectImports collects the functions imported by name, which can't also be defined in
+// the module or imported from another module.
+func (c *Compiler) collectImports(decls []ast.Decl) error {
+	c.imports = make(map[core.FuncName]string)
+	c.aliases = make(map[string]*ast.Identifier)
+	c.arities = make(map[string][]int)
+	defined := make(map[core.FuncName]bool)
+	local := make(map[string]*ast.Identifier) // names of the functions and guards
+	for _, decl := range decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := core.FuncName{Name: d.Name.Name, Arity: len(d.Parameters)}
+			if !defined[name] {
+				c.arities[name.Name] = append(c.arities[name.Name], name.Arity)
+			}
+			defined[name] = true
+			if _, ok := local[d.Name.Name]; !ok {
+				local[d.Name.Name] = d.Name
+			}
+		case *ast.GuardDecl:
+			local[d.Name.Name] = d.Name
+		}
+	}
+	for _, decl := range decls {
+		d, ok := decl.(*ast.ImportDecl)
+		if !ok {
+			continue
+		}
+		if d.Alias != nil {
+			// `foo.f()` calls the module, but `foo()` and `foo/0` mean the local function
+			if fn, ok := local[d.Alias.Name]; ok {
+				return c.errorf(d.Alias.Pos(), "import alias %s collides with local function %s declared at %s", d.Alias.Name, fn.Name, c.file.Position(fn.Pos()))
+			}
+			c.aliases[d.Alias.Name] = d.Alias
+		}
+		module := path.Base(d.Path.Value)
+		for _, fn := range d.Funcs {
+			name := core.FuncName{Name: fn.Name.Name, Arity: int(fn.Arity.Value)}
+			if defined[name] {
+				return c.errorf(fn.Pos(), "%s/%d is imported from %s and also defined in this module", name.Name, name.Arity, module)
+			}
+			if prev, ok := c.imports[name]; ok && prev != module {
+				return c.errorf(fn.Pos(), "%s/%d is imported from both %s and %s", name.Name, name.Arity, prev, module)
+			}
+			c.imports[name] = module
+		}
+	}
+	return nil
+}
+
+// collectGuards records the guards declared in decls so they can be inlined.
+func (c *Compiler) collectGuards(decls []ast.Decl) error {
+	c.guards = make(map[string]*ast.GuardDecl)
+	for _, decl := range decls {
+		if d, ok := decl.(*ast.GuardDecl); ok {
+			if prev, ok := c.guards[d.Name.Name]; ok {
+				prevPos := c.file.Position(prev.Name.Pos())
+				return c.errorf(d.Name.Pos(), "guard %s redeclared, previous declaration at %s", d.Name.Name, prevPos)
+			}
+			c.guards[d.Name.Name] = d
+		}
+	}
+	for _, decl := range decls {
+		if d, ok := decl.(*ast.GuardDecl); ok {
+			if errs := c.checkGuard(d.Body); len(errs) > 0 {
+				return errs[0]
+			}
+		}
+	}
+	return nil
+}
+
+// checkConst returns an error if expr is not a constant expression. visiting holds the
+// constants whose values are being checked to catch constants that refer to themselves.
+func (c *Compiler) checkConst(expr ast.Expression, visiting map[string]bool) error {
+	switch expr := expr.(type) {
+	case ast.Literal:
+		return nil
+	case *ast.ParenExpr:
+		return c.checkConst(expr.Expression, visiting)
+	case *ast.UnaryExpr:
+		return c.checkConst(expr.Right, visiting)
+	case *ast.BinaryExpr:
+		if err := c.checkConst(expr.Left, visiting); err != nil {
+			return err
+		}
+		return c.checkConst(expr.Right, visiting)
+	case *ast.FuncRef:
+		if _, ok := c.consts[expr.Name.Name]; ok {
+			return c.checkConst(expr.Division(), visiting)
+		}
+		return c.errorf(expr.Pos(), "const value must be a constant expression")
+	case *ast.ListExpr:
+		for _, elt := range expr.Elements {
+			if err := c.checkConst(elt, visiting); err != nil {
+				return err
+			}
+		}
+		if expr.Tail != nil {
+			return c.checkConst(expr.Tail, visiting)
+		}
+		return nil
+	case *ast.Identifier:
+		decl, ok := c.consts[expr.Name]
+		if !ok {
+			return c.errorf(expr.Pos(), "%s is not a constant", expr.Name)
+		}
+		if visiting[expr.Name] {
+			return c.errorf(expr.Pos(), "const %s refers to itself", expr.Name)
+		}
+		visiting[expr.Name] = true
+		defer delete(visiting, expr.Name)
+		return c.checkConst(decl.Value, visiting)
+	default:
+		return c.errorf(expr.Pos(), "const value must be a constant expression")
+	}
+}
+
+// errorf returns an error located at pos in the file being compiled.
+func (c *Compiler) errorf(pos token.Pos, format string, args ...any) error {
+	err := &token.Error{Msg: fmt.Errorf(format, args...)}
+	if c.file != nil {
+		err.Pos = c.file.Position(pos)
+	}
+	return err
+}
+
+// warnf reports a warning located at pos in the file being compiled.
+func (c *Compiler) warnf(pos token.Pos, format string, args ...any) {
+	if c.noWarn {
+		return
+	}
+	c.warnings = append(c.warnings, c.errorf(pos, format, args...).(*token.Error))
+}
+
+// compileStatements compiles a sequence of statements into a single expression. Each
+// assignment wraps the statements after it so they see its bindings, and the sequence
+// evaluates to the returned value or, without a return, the value of the last statement.
+// An empty sequence, like the body of `func f() {}`, evaluates to 'ok' so that every
+// function has a value, like a function that only has side effects.
+func (c *Compiler) compileStatements(stmts []ast.Statement) (core.Expr, error) {
+	body, err := c.compileBlock(stmts, nil)
+	if err == nil && len(c.errors) > 0 {
+		err = c.errors[0]
+	}
+	return body, err
+}
+
+// compileBlock is like compileStatements, but if tail is not nil the block evaluates
+// to tail after its last statement instead, with every binding in the block in scope.
+func (c *Compiler) compileBlock(stmts []ast.Statement, tail core.Expr) (core.Expr, error) {
+	if len(stmts) == 0 {
+		if tail != nil {
+			return tail, nil
+		}
+		return c.atom("ok"), nil
+	}
+	stmt, rest := stmts[0], stmts[1:]
+	c.pos = stmt.Pos()
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement:
+		if tail != nil {
+			return nil, c.errorf(stmt.Pos(), "return inside a loop is not supported")
+		}
+		if len(rest) > 0 {
+			c.warnf(rest[0].Pos(), "unreachable statement after return")
+		}
+		return c.compileExpr(stmt.Expression), nil
+	case *ast.ExprStatement:
+		return c.compileExprStatement(stmt.Expression, rest, tail)
+	case *ast.WhileStmt:
+		return c.compileWhile(stmt, rest, tail)
+	case *ast.IfStmt:
+		return c.compileIf(stmt, rest, tail)
+	case *ast.DeferStmt:
+		return c.compileDefer(stmt, rest, tail)
+	default:
+		return nil, c.errorf(stmt.Pos(), "unsupported statement %T", stmt)
+	}
+}
+
+// compileExprStatement compiles expr followed by the statements in rest.
+func (c *Compiler) compileExprStatement(expr ast.Expression, rest []ast.Statement, tail core.Expr) (core.Expr, error) {
+	if arg, pattern, ok, err := c.compileAssign(expr); ok {
+		if err != nil {
+			return nil, err
+		}
+		return c.compileBinding(arg, pattern, rest, tail)
+	}
+
+	value := c.compileExpr(expr)
+	if len(rest) == 0 && tail == nil {
+		return value, nil
+	}
+	next, err := c.compileBlock(rest, tail)
+	return core.Seq{First: value, Second: next}, err
+}
+
+// compileAssign compiles the value of the assignment expr and binds the variables on its
+// left, returning the value and the pattern to match it against. ok is false if expr is
+// not an assignment.
+func (c *Compiler) compileAssign(expr ast.Expression) (arg, pattern core.Expr, ok bool, err error) {
+	switch expr := expr.(type) {
+	case *ast.AssignExpr:
+		arg := c.compileExpr(expr.Right)
+		return arg, c.bindVar(expr.Left), true, nil
+	case *ast.MultiAssignExpr:
+		arg := c.compileExpr(expr.Right)
+		var elems []core.Expr
+		for _, ident := range expr.Left {
+			elems = append(elems, c.bindVar(ident))
+		}
+		return arg, core.Tuple{Elements: elems}, true, nil
+	case *ast.MatchAssignExpr:
+		arg := c.compileExpr(expr.Right)
+		pattern, err := c.compilePattern(expr.Left)
+		if err != nil {
+			c.pins, c.patVars = nil, nil
+		}
+		return arg, pattern, true, err
+	}
+	return nil, nil, false, nil
+}
+
+// compileDefer compiles the statements in rest so that the deferred expression is
+// evaluated after them, whether they return or raise, like Erlang's try ... after:
+//
+//	try Rest of                     % defer Deferred; Rest
+//	    <X> -> do Deferred X
+//	catch <C,R,S> ->
+//	    do Deferred primop 'raw_raise'(C,R,S)
+//
+// A later defer is inside Rest, so it runs first.
+func (c *Compiler) compileDefer(stmt *ast.DeferStmt, rest []ast.Statement, tail core.Expr) (core.Expr, error) {
+	if tail != nil {
+		return nil, c.errorf(stmt.Pos(), "defer inside a loop is not supported")
+	}
+	deferred := c.compileExpr(stmt.Expression)
+	body, err := c.compileBlock(rest, nil)
+	if err != nil {
+		return nil, err
+	}
+	vars := c.freshVars(4)
+	result, raised := vars[0], vars[1:]
+	return core.Try{
+		Arg:       body,
+		Vars:      []core.Var{result},
+		Body:      core.Seq{First: deferred, Second: result},
+		CatchVars: raised,
+		Handler: core.Seq{
+			First:  deferred,
+			Second: core.PrimOp{Name: core.Atom{Value: "raw_raise"}, Args: exprs(raised)},
+		},
+	}, nil
+}
+
+// compileBinding matches arg against pattern and continues with the statements in rest.
+// A plain variable is bound with let, and any other pattern is matched with a case that
+// fails with badmatch, like Erlang's '='. The binding evaluates to the matched value if
+// there are no more statements.
+func (c *Compiler) compileBinding(arg, pattern core.Expr, rest []ast.Statement, tail core.Expr) (core.Expr, error) {
+	guard := c.takePins(nil)
+	body := pattern
+	if len(rest) > 0 || tail != nil {
+		var err error
+		body, err = c.compileBlock(rest, tail)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.matchBinding(arg, pattern, guard, body), nil
+}
+
+// matchBinding matches arg against pattern and guard and evaluates body, see compileBinding.
+func (c *Compiler) matchBinding(arg, pattern, guard, body core.Expr) core.Expr {
+	if v, ok := pattern.(core.Var); ok && guard == nil {
+		return core.Let{Vars: []core.Var{v}, Arg: arg, Body: body}
+	}
+	fail := c.freshVars(1)
+	return core.Case{
+		Arg: arg,
+		Clauses: []core.Clause{
+			{Patterns: []core.Expr{pattern}, Guard: guard, Body: body},
+			{Patterns: exprs(fail), Body: c.matchFail("badmatch", fail)},
+		},
+	}
+}
+
+// compileIf lowers an if statement to a case on its condition. The variables bound by
+// Init are only in scope in the condition and the branches, so the binding wraps the case:
+//
+//	let <X> = Init in          % if x := Init; Cond { Body... } else { Else... }; Rest...
+//	    case Cond of
+//	        <'true'> when 'true' -> Body... 'ok'
+//	        <'false'> when 'true' -> Else... 'ok'
+//	    end
+//	Rest...
+//
+// An else-if is compiled the same way inside the false clause. If the if has an else-if
+// and no condition can raise an error or be a non-boolean, the chain is flattened to one
+// case with a clause per branch instead, see compileGuardChain.
+//
+// Like a while loop, the branches may update one variable, which the case evaluates to
+// and which is bound again for Rest. A return is only allowed if the if is the last
+// statement, which evaluates to the branch that was taken.
+func (c *Compiler) compileIf(stmt *ast.IfStmt, rest []ast.Statement, tail core.Expr) (core.Expr, error) {
+	last := len(rest) == 0 && tail == nil
+	links, els := ifChain(stmt)
+	var bodies []ast.Statement
+	var updated []string
+	seen := make(map[string]bool)
+	shadowed := make(map[string]bool) // bound again by an init, so only updated in the if
+	update := func(body []ast.Statement) {
+		bodies = append(bodies, body...)
+		for _, name := range c.updatedVars(body) {
+			if !shadowed[name] && !seen[name] {
+				seen[name] = true
+				updated = append(updated, name)
+			}
+		}
+	}
+	for _, link := range links {
+		for _, name := range initNames(link.Init) {
+			shadowed[name] = true
+		}
+		update(link.Body)
+	}
+	if els != nil {
+		update(els.List)
+	}
+	if len(updated) > 1 && !last {
+		return nil, c.errorf(stmt.Pos(), "if statement updates more than one variable (%s), only one is supported",
+			strings.Join(updated, ", "))
+	}
+	if !last {
+		for _, s := range bodies {
+			if ret := findReturn(s); ret != nil {
+				return nil, c.errorf(ret.Pos(), "return inside an if statement is only supported in the last statement")
+			}
+			// in a loop, the defer is reported by compileDefer
+			if d := findDefer(s); d != nil && tail == nil {
+				return nil, c.errorf(d.Pos(), "defer inside an if statement is only supported in the last statement")
+			}
+		}
+	}
+	done := c.atom("ok")
+	var result []core.Var
+	if !last {
+		for _, name := range updated {
+			c.used[name] = true // the value after the if
+			result = append(result, coreVar(name))
+			done = coreVar(name)
+		}
+	}
+
+	ifExpr, err := c.compileIfChain(stmt, done, last)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case last:
+		return ifExpr, nil
+	case len(result) == 1:
+		return c.compileBinding(ifExpr, result[0], rest, tail)
+	default:
+		next, err := c.compileBlock(rest, tail)
+		return core.Seq{First: ifExpr, Second: next}, err
+	}
 }
 
-func New() *Compiler {
-	return &Compiler{}
+// initNames returns the names of the variables that the init statement of an if binds,
+// which are new variables even if the names are bound outside the if.
+func initNames(init ast.Statement) []string {
+	stmt, ok := init.(*ast.ExprStatement)
+	if !ok {
+		return nil
+	}
+	var left []ast.Node
+	switch expr := stmt.Expression.(type) {
+	case *ast.AssignExpr:
+		left = append(left, expr.Left)
+	case *ast.MultiAssignExpr:
+		for _, ident := range expr.Left {
+			left = append(left, ident)
+		}
+	case *ast.MatchAssignExpr:
+		left = append(left, expr.Left)
+	}
+	var names []string
+	for _, node := range left {
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.PinExpr:
+				return false // matches the bound variable instead
+			case *ast.Identifier:
+				names = append(names, n.Name)
+			}
+			return true
+		})
+	}
+	return names
 }
 
-func (c *Compiler) CompileModule(mod *ast.Module) (*core.Module, error) {
-	mod = addBaseFuncs(mod)
-	return c.compileModule(mod)
+// compileIfChain compiles stmt and its else branches, each of which evaluates to done
+// unless the if is the last statement, see compileIf.
+func (c *Compiler) compileIfChain(stmt *ast.IfStmt, done core.Expr, last bool) (core.Expr, error) {
+	outer := c.saveBound()
+	var init core.Expr
+	var arg, pattern, guard core.Expr
+	if stmt.Init != nil {
+		expr := stmt.Init.(*ast.ExprStatement).Expression
+		var ok bool
+		var err error
+		arg, pattern, ok, err = c.compileAssign(expr)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			guard = c.takePins(nil)
+		} else {
+			init = c.compileExpr(expr)
+		}
+	}
+
+	var ifExpr core.Expr
+	if links, els := ifChain(stmt); len(links) > 1 && c.isGuardChain(links) {
+		var err error
+		ifExpr, err = c.compileGuardChain(links, els, done, last)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		c.checkCondition(stmt.Cond)
+		cond := c.compileExpr(stmt.Cond)
+		body, err := c.compileBranch(stmt.Body, done, last)
+		if err != nil {
+			return nil, err
+		}
+		orElse := done
+		switch els := stmt.Else.(type) {
+		case *ast.IfStmt:
+			orElse, err = c.compileIfChain(els, done, last)
+		case *ast.BlockStmt:
+			orElse, err = c.compileBranch(els.List, done, last)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fail := c.freshVars(1)
+		ifExpr = core.Case{
+			Arg: cond,
+			Clauses: []core.Clause{
+				{Patterns: []core.Expr{c.atom("true")}, Body: body},
+				{Patterns: []core.Expr{c.atom("false")}, Body: orElse},
+				{Patterns: exprs(fail), Body: c.matchFail("case_clause", fail)},
+			},
+		}
+	}
+	c.bound = outer
+
+	if pattern != nil {
+		ifExpr = c.matchBinding(arg, pattern, guard, ifExpr)
+	} else if init != nil {
+		ifExpr = core.Seq{First: init, Second: ifExpr}
+	}
+	return ifExpr, nil
 }
 
-// compileModule compiles a module AST into a Core Erlang module.
-func (c *Compiler) compileModule(mod *ast.Module) (*core.Module, error) {
-	coreMod := &core.Module{
-		Name: mod.Id.Name,
+// compileGuardChain compiles an if/else-if chain whose conditions are all guard
+// expressions to a case without arguments, which tries every condition in order like
+// Erlang's if:
+//
+//	case <> of                 % if C1 { B1... } else if C2 { B2... } else { B3... }
+//	    <> when C1 -> B1... 'ok'
+//	    <> when C2 -> B2... 'ok'
+//	    <> when 'true' -> B3... 'ok'
+//	end
+//
+// A guard that raises an error or isn't a boolean is false, so the chain is only
+// flattened if no condition can, see isGuardChain.
+func (c *Compiler) compileGuardChain(links []*ast.IfStmt, els *ast.BlockStmt, done core.Expr, last bool) (core.Expr, error) {
+	clauses := make([]core.Clause, 0, len(links)+1)
+	for _, link := range links {
+		c.checkCondition(link.Cond)
+		c.guard = true
+		guard := c.compileExpr(link.Cond)
+		c.guard = false
+		body, err := c.compileBranch(link.Body, done, last)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, core.Clause{Guard: guard, Body: body})
 	}
+	orElse := done
+	if els != nil {
+		var err error
+		orElse, err = c.compileBranch(els.List, done, last)
+		if err != nil {
+			return nil, err
+		}
+	}
+	clauses = append(clauses, core.Clause{Body: orElse})
+	return core.Case{Arg: core.Values{}, Clauses: clauses}, nil
+}
 
-	for _, decl := range mod.Decls {
-		switch d := decl.(type) {
-		case *ast.FuncDecl:
-			coreFn, err := c.compileFunction(d)
-			if err != nil {
-				return coreMod, err
+// compileBranch compiles the body of one branch of an if, whose variables are only in
+// scope in the branch.
+func (c *Compiler) compileBranch(body []ast.Statement, done core.Expr, last bool) (core.Expr, error) {
+	scope := c.saveBound()
+	defer func() { c.bound = scope }()
+	if last {
+		return c.compileBlock(body, nil)
+	}
+	return c.compileBlock(body, done)
+}
+
+// ifChain returns stmt and the else-ifs that follow it, and the final else, if any.
+func ifChain(stmt *ast.IfStmt) ([]*ast.IfStmt, *ast.BlockStmt) {
+	var links []*ast.IfStmt
+	for {
+		links = append(links, stmt)
+		switch els := stmt.Else.(type) {
+		case *ast.IfStmt:
+			stmt = els
+		case *ast.BlockStmt:
+			return links, els
+		default:
+			return links, nil
+		}
+	}
+}
+
+// isGuardChain reports whether an if/else-if chain can be compiled with
+// compileGuardChain without changing what it does: every condition is a boolean that
+// can't raise an error, which a guard would turn into false, and only the first if has
+// an init statement, since it must be run before any condition.
+func (c *Compiler) isGuardChain(links []*ast.IfStmt) bool {
+	for i, link := range links {
+		if i > 0 && link.Init != nil || !c.isSafeCondition(link.Cond) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSafeCondition reports whether cond always evaluates to a boolean without raising an
+// error, like `x > 0 and is_integer(y)`: comparisons and type tests of plain values,
+// combined with and, or and not.
+func (c *Compiler) isSafeCondition(cond ast.Expression) bool {
+	if v, ok := c.foldConst(cond, nil); ok {
+		return v == atom("true") || v == atom("false")
+	}
+	switch cond := cond.(type) {
+	case *ast.ParenExpr:
+		return c.isSafeCondition(cond.Expression)
+	case *ast.UnaryExpr:
+		return cond.Op == token.Not && c.isSafeCondition(cond.Right)
+	case *ast.BinaryExpr:
+		switch cond.Op {
+		case token.And, token.Or, token.AndAlso, token.OrElse:
+			return c.isSafeCondition(cond.Left) && c.isSafeCondition(cond.Right)
+		case token.EqualEqual, token.BangEqual, token.EqualEqualEqual, token.BangEqualEqual,
+			token.Less, token.LessEqual, token.Greater, token.GreaterEqual:
+			return c.isPlainValue(cond.Left) && c.isPlainValue(cond.Right)
+		}
+	case *ast.TypeTestExpr:
+		ident, ok := cond.Type.(*ast.Identifier)
+		return ok && typeTests[ident.Name] != "" && c.isPlainValue(cond.X)
+	case *ast.CallExpr:
+		// a type test BIF like is_integer(x), unless the module has its own function
+		ident, ok := cond.Callee.(*ast.Identifier)
+		if !ok || !strings.HasPrefix(ident.Name, "is_") || len(cond.Arguments) != 1 || cond.Ellipsis.IsValid() ||
+			!core.IsGuardBIF(ident.Name) || c.bound[ident.Name] || len(c.arities[ident.Name]) > 0 {
+			return false
+		}
+		if _, ok := c.imports[core.FuncName{Name: ident.Name, Arity: 1}]; ok {
+			return false
+		}
+		_, isGuard := c.guards[ident.Name]
+		return !isGuard && c.isPlainValue(cond.Arguments[0])
+	}
+	return false
+}
+
+// isPlainValue reports whether expr is a variable, a constant or a literal, or a list or
+// tuple of them, which can be evaluated without raising an error.
+func (c *Compiler) isPlainValue(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		_, isConst := c.consts[expr.Name]
+		return c.bound[expr.Name] || isConst
+	case *ast.IntLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.AtomLiteral, *ast.NilLiteral:
+		return true
+	case *ast.ParenExpr:
+		return c.isPlainValue(expr.Expression)
+	case *ast.ListExpr:
+		if expr.Tail != nil && !c.isPlainValue(expr.Tail) {
+			return false
+		}
+		for _, elt := range expr.Elements {
+			if !c.isPlainValue(elt) {
+				return false
 			}
-			if d.IsPublic() {
-				coreMod.Exports = append(coreMod.Exports, coreFn.Name)
+		}
+		return true
+	case *ast.TupleExpr:
+		for _, elt := range expr.Elements {
+			if !c.isPlainValue(elt) {
+				return false
 			}
-			coreMod.Functions = append(coreMod.Functions, coreFn)
-		default:
-			panic(fmt.Errorf("unrecognized decl: %T", decl))
 		}
+		return true
 	}
-	return coreMod, nil
+	return false
 }
 
-func (c *Compiler) CompileFunction(fn *ast.FuncDecl) (core.Func, error) {
-	return c.compileFunction(fn)
+// findReturn returns the first return statement in stmt outside of a fun, or nil.
+func findReturn(stmt ast.Statement) *ast.ReturnStatement {
+	var ret *ast.ReturnStatement
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ReturnStatement:
+			if ret == nil {
+				ret = n
+			}
+		case *ast.FuncLit:
+			return false
+		}
+		return ret == nil
+	})
+	return ret
 }
 
-func (c *Compiler) compileFunction(fn *ast.FuncDecl) (core.Func, error) {
-	coreFn := core.Func{
-		Name: core.FuncName{Name: fn.Name.Name, Arity: len(fn.Parameters)},
-		Annotation: core.Annotation{Attrs: []core.Const{
-			core.ConstTuple{Elements: []core.Const{
-				core.Atom{Value: "function"},
-				core.ConstTuple{
-					Elements: []core.Const{core.Atom{Value: fn.Name.Name}, core.Integer{Value: int64(len(fn.Parameters))}},
-				},
-			}},
-		}},
+// findDefer returns the first defer statement in stmt outside of a fun or a loop, or nil.
+func findDefer(stmt ast.Statement) *ast.DeferStmt {
+	var d *ast.DeferStmt
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.DeferStmt:
+			if d == nil {
+				d = n
+			}
+		case *ast.FuncLit, *ast.WhileStmt:
+			return false
+		}
+		return d == nil
+	})
+	return d
+}
+
+// compileWhile lowers a while loop to a recursive fun since the BEAM has no loops. The
+// variable the loop updates, if any, is passed to every iteration, and the loop evaluates
+// to its final value, which is bound again for the statements after the loop:
+//
+//	letrec 'loop'/1 = fun (X) ->
+//	    case Cond of
+//	        <'true'> when 'true' -> Body... apply 'loop'/1(X)
+//	        <'false'> when 'true' -> X
+//	    end
+//	in let <X> = apply 'loop'/1(X) in Rest...
+func (c *Compiler) compileWhile(loop *ast.WhileStmt, rest []ast.Statement, tail core.Expr) (core.Expr, error) {
+	updated := c.updatedVars(loop.Body)
+	if len(updated) > 1 {
+		return nil, c.errorf(loop.Pos(), "while loop updates more than one variable (%s), only one is supported",
+			strings.Join(updated, ", "))
+	}
+	var params []core.Var
+	done := c.atom("ok")
+	for _, name := range updated {
+		c.used[name] = true // passed to the next iteration
+		params = append(params, coreVar(name))
+		done = coreVar(name)
 	}
+	name := core.FuncName{Name: fmt.Sprintf("-%s-while-%d-", c.fn, c.nextLoop), Arity: len(params)}
+	c.nextLoop++
+	call := core.Application{Func: name, Args: exprs(params)}
 
-	for _, arg := range fn.Parameters {
-		coreFn.Parameters = append(coreFn.Parameters, core.Var{Name: arg.Name})
+	c.checkCondition(loop.Cond)
+	cond := c.compileExpr(loop.Cond)
+	// variables bound in the body are local to an iteration
+	outer := c.saveBound()
+	body, err := c.compileBlock(loop.Body, call)
+	if err != nil {
+		return nil, err
 	}
+	c.bound = outer
 
-	var err error
-	coreFn.Body, err = c.compileStatements(fn.Statements)
-	return coreFn, err
+	fail := c.freshVars(1)
+	fun := core.Func{
+		Name:       name,
+		Parameters: params,
+		Body: core.Case{
+			Arg: cond,
+			Clauses: []core.Clause{
+				{Patterns: []core.Expr{c.atom("true")}, Body: body},
+				{Patterns: []core.Expr{c.atom("false")}, Body: done},
+				{Patterns: exprs(fail), Body: c.matchFail("case_clause", fail)},
+			},
+		},
+	}
+
+	var next core.Expr
+	if len(params) == 1 {
+		next, err = c.compileBinding(call, params[0], rest, tail)
+	} else if len(rest) == 0 && tail == nil {
+		next = call
+	} else {
+		next, err = c.compileBlock(rest, tail)
+		next = core.Seq{First: call, Second: next}
+	}
+	return core.LetRec{Funcs: []core.Func{fun}, Body: next}, err
 }
 
-func (c *Compiler) compileStatements(stmts []ast.Statement) (core.Expr, error) {
-	var expr core.Expr
+// updatedVars returns the names of the variables that are bound before stmts and
+// assigned again in stmts, in the order they are first assigned.
+func (c *Compiler) updatedVars(stmts []ast.Statement) []string {
+	var names []string
+	seen := make(map[string]bool)
 	for _, stmt := range stmts {
-		switch stmt := stmt.(type) {
-		case *ast.ReturnStatement:
-			expr = c.compileExpr(stmt.Expression)
-		}
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			var idents []*ast.Identifier
+			switch n := node.(type) {
+			case *ast.AssignExpr:
+				idents = append(idents, n.Left)
+			case *ast.MultiAssignExpr:
+				idents = append(idents, n.Left...)
+			}
+			for _, ident := range idents {
+				if c.bound[ident.Name] && !seen[ident.Name] {
+					seen[ident.Name] = true
+					names = append(names, ident.Name)
+				}
+			}
+			return true
+		})
 	}
-	return expr, nil
+	return names
 }
 
 func (c *Compiler) compileExprs(exprs []ast.Expression) []core.Expr {
@@ -97,23 +1537,395 @@ func (c *Compiler) compileExprs(exprs []ast.Expression) []core.Expr {
 }
 
 func (c *Compiler) compileExpr(expr ast.Expression) core.Expr {
+	c.pos = expr.Pos()
 	switch expr := expr.(type) {
 	case *ast.IntLiteral:
 		return core.Integer{Value: expr.Value}
+	case *ast.FloatLiteral:
+		return core.Float{Value: expr.Value}
 	case *ast.StringLiteral:
 		return core.String{Value: expr.Value}
 	case *ast.Identifier:
-		return core.Var{Name: expr.Name}
+		if n := len(c.inlining); n > 0 {
+			return c.compileGuardParam(c.inlining[n-1], expr)
+		}
+		if decl, ok := c.consts[expr.Name]; ok && !c.bound[expr.Name] {
+			return c.compileExpr(decl.Value)
+		}
+		if fn, ok := c.funs[expr.Name]; ok && !c.bound[expr.Name] {
+			return fn
+		}
+		c.used[expr.Name] = true
+		return coreVar(expr.Name)
+	case *ast.NilLiteral:
+		// nil is the empty list, like in Erlang
+		return core.Nil{}
 	case *ast.AtomLiteral:
-		return core.Atom{Value: expr.Value}
+		if expr.Value == moduleNameAtom {
+			return c.atom(c.module)
+		}
+		return c.atom(expr.Value)
 	case *ast.CallExpr:
 		return c.compileCallExpr(expr)
+	case *ast.FuncRef:
+		return c.compileFuncRef(expr)
+	case *ast.ParenExpr:
+		return c.compileExpr(expr.Expression)
+	case *ast.UnaryExpr:
+		return c.compileUnaryExpr(expr)
+	case *ast.BinaryExpr:
+		return c.compileBinaryExpr(expr)
+	case *ast.ListExpr:
+		return c.compileListExpr(expr)
+	case *ast.TupleExpr:
+		return core.Tuple{Elements: c.compileExprs(expr.Elements)}
+	case *ast.CaseExpr:
+		return c.compileCaseExpr(expr)
+	case *ast.ReceiveExpr:
+		return c.compileReceiveExpr(expr)
+	case *ast.LetExpr:
+		return c.compileLetExpr(expr)
+	case *ast.FuncLit:
+		return c.compileFuncLit(expr)
+	case *ast.InterpString:
+		return c.compileInterpString(expr)
+	case *ast.TypeTestExpr:
+		return c.compileTypeTestExpr(expr)
+	case *ast.TernaryExpr:
+		return c.compileTernaryExpr(expr)
+	case *ast.IndexExpr:
+		return c.compileIndexExpr(expr)
+	case *ast.CatchExpr:
+		return core.Catch{Body: c.compileExpr(expr.Expr)}
+	case *ast.PinExpr:
+		c.errors = append(c.errors, c.errorf(expr.Pos(), "'^' can only pin a variable in a pattern"))
+		return c.compileExpr(expr.Var)
+	case *ast.AssignExpr, *ast.MultiAssignExpr, *ast.MatchAssignExpr:
+		c.errors = append(c.errors, c.errorf(expr.Pos(), "assignment can only be used as a statement"))
+		return core.Nil{}
 	default:
 		panic(fmt.Errorf("unrecognized expression type: %T", expr))
 	}
 }
 
+// compileCaseExpr lowers a case to a Core Erlang case with an extra clause that fails
+// with case_clause if no clause matches, like in Erlang. The variables bound by a clause
+// are only visible in that clause.
+func (c *Compiler) compileCaseExpr(expr *ast.CaseExpr) core.Expr {
+	arg := c.compileExpr(expr.Value)
+	clauses := c.compileClauses(expr.Clauses)
+	fail := c.freshVars(1)
+	clauses = append(clauses, core.Clause{Patterns: exprs(fail), Body: c.matchFail("case_clause", fail)})
+	return core.Case{Arg: arg, Clauses: clauses}
+}
+
+// compileLetExpr lowers `let x = e1 in e2` to a Core Erlang let. The name is a new
+// variable that is only bound in the body, even if a variable with the same name is
+// already bound.
+func (c *Compiler) compileLetExpr(expr *ast.LetExpr) core.Expr {
+	arg := c.compileExpr(expr.Value)
+	saved := c.saveBound()
+	delete(c.bound, expr.Name.Name)
+	c.bind(expr.Name)
+	body := c.compileExpr(expr.Body)
+	c.bound = saved
+	return core.Let{Vars: []core.Var{coreVar(expr.Name.Name)}, Arg: arg, Body: body}
+}
+
+// compileReceiveExpr lowers a receive to a Core Erlang receive, which waits forever
+// unless it has a timeout. Messages that match no clause are left in the mailbox, so
+// unlike a case there is no clause that fails.
+func (c *Compiler) compileReceiveExpr(expr *ast.ReceiveExpr) core.Expr {
+	recv := core.Receive{
+		Clauses: c.compileClauses(expr.Clauses),
+		Timeout: c.atom("infinity"),
+		Action:  c.atom("true"),
+	}
+	if expr.Timeout != nil {
+		recv.Timeout = c.compileTimeout(expr.Timeout)
+		recv.Action = c.compileExpr(expr.Action)
+	}
+	return recv
+}
+
+// compileTimeout compiles the timeout of a receive, which like in Erlang is a number of
+// milliseconds or 'infinity'. Only literals can be checked, any other expression must
+// evaluate to a timeout at run time.
+func (c *Compiler) compileTimeout(timeout ast.Expression) core.Expr {
+	switch lit := timeout.(type) {
+	case *ast.AtomLiteral:
+		if lit.Value == "infinity" {
+			return c.atom("infinity")
+		}
+	case *ast.FloatLiteral, *ast.StringLiteral, *ast.InterpString, *ast.NilLiteral, *ast.ListExpr, *ast.TupleExpr:
+	default:
+		return c.compileExpr(timeout)
+	}
+	c.errors = append(c.errors, c.errorf(timeout.Pos(), "receive timeout must be an integer or 'infinity'"))
+	return c.atom("infinity")
+}
+
+// compileClauses compiles the clauses of a case or receive. The variables bound by a
+// clause are only visible in that clause.
+func (c *Compiler) compileClauses(clauses []*ast.Clause) []core.Clause {
+	var coreClauses []core.Clause
+	var earlier [][]core.Expr
+	for _, clause := range clauses {
+		outer := c.saveBound()
+		coreClause, err := c.compileClause(clause)
+		c.bound = outer
+		if err != nil {
+			c.errors = append(c.errors, err)
+			continue
+		}
+		c.checkReachable(clause.Pos(), coreClause, &earlier)
+		coreClauses = append(coreClauses, coreClause)
+	}
+	return coreClauses
+}
+
+func (c *Compiler) compileClause(clause *ast.Clause) (core.Clause, error) {
+	var coreClause core.Clause
+	for _, pattern := range clause.Patterns {
+		corePattern, err := c.compilePattern(pattern)
+		if err != nil {
+			c.pins, c.patVars = nil, nil
+			return coreClause, err
+		}
+		coreClause.Patterns = append(coreClause.Patterns, corePattern)
+	}
+	if clause.Guard != nil {
+		coreClause.Guard = c.compileGuard(clause.Guard)
+	}
+	coreClause.Guard = c.takePins(coreClause.Guard)
+	coreClause.Body = c.compileExpr(clause.Body)
+	return coreClause, nil
+}
+
+// compileIndexExpr lowers `t[i]` to erlang:element/2. Indexes start at 0, but element/2
+// counts from 1, so one is added to the index.
+func (c *Compiler) compileIndexExpr(expr *ast.IndexExpr) core.Expr {
+	var index core.Expr
+	if lit, ok := expr.Index.(*ast.IntLiteral); ok {
+		index = core.Integer{Value: lit.Value + 1}
+	} else {
+		index = c.operatorCall(token.Plus, c.compileExpr(expr.Index), core.Integer{Value: 1})
+	}
+	return c.erlangCall("element", index, c.compileExpr(expr.Target))
+}
+
+// compileTernaryExpr lowers `cond ? then : else` to a case on the condition, which fails
+// with case_clause if it is not a boolean:
+//
+//	case Cond of
+//	    <'true'> when 'true' -> Then
+//	    <'false'> when 'true' -> Else
+//	    <_0> when 'true' -> primop 'match_fail'({'case_clause', _0})
+//	end
+func (c *Compiler) compileTernaryExpr(expr *ast.TernaryExpr) core.Expr {
+	c.checkCondition(expr.Cond)
+	cond := c.compileExpr(expr.Cond)
+	then := c.compileExpr(expr.Then)
+	els := c.compileExpr(expr.Else)
+	fail := c.freshVars(1)
+	return core.Case{
+		Arg: cond,
+		Clauses: []core.Clause{
+			{Patterns: []core.Expr{c.atom("true")}, Body: then},
+			{Patterns: []core.Expr{c.atom("false")}, Body: els},
+			{Patterns: exprs(fail), Body: c.matchFail("case_clause", fail)},
+		},
+	}
+}
+
+// compileFuncLit compiles a fun expression. Variables bound outside the fun are visible
+// in its body, and variables bound in the body are local to it. A named fun is defined
+// with letrec so that its body can call it:
+//
+//	letrec '-f-fun-0-'/1 = fun (N) -> ... apply '-f-fun-0-'/1(M) ... in '-f-fun-0-'/1
+func (c *Compiler) compileFuncLit(lit *ast.FuncLit) core.Expr {
+	outerBound, outerFuns := c.saveBound(), c.funs
+	defer func() { c.bound, c.funs = outerBound, outerFuns }()
+
+	var name core.FuncName
+	if lit.Name != nil {
+		name = core.FuncName{Name: fmt.Sprintf("-%s-fun-%d-", c.fn, c.nextFun), Arity: len(lit.Parameters)}
+		c.nextFun++
+		c.funs = make(map[string]core.FuncName, len(outerFuns)+1)
+		for k, v := range outerFuns {
+			c.funs[k] = v
+		}
+		c.funs[lit.Name.Name] = name
+		delete(c.bound, lit.Name.Name) // the fun's name shadows a variable of the same name
+	}
+	params, body, err := c.compileFuncBody(lit.Parameters, nil, lit.Statements)
+	if err != nil {
+		c.errors = append(c.errors, err)
+	}
+	fun := core.Func{Name: name, Parameters: params, Body: body}
+	if lit.Name == nil {
+		return fun
+	}
+	return core.LetRec{Funcs: []core.Func{fun}, Body: name}
+}
+
+// compileInterpString concatenates the parts of an interpolated string with lists:concat,
+// which accepts strings as well as atoms and numbers, so "n = #{n}" works for any n.
+func (c *Compiler) compileInterpString(str *ast.InterpString) core.Expr {
+	var parts []ast.Expression
+	for _, part := range str.Parts {
+		if lit, ok := part.(*ast.StringLiteral); ok && lit.Value == "" {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return core.InterModuleCall{
+		Module: c.atom("lists"),
+		Func:   c.atom("concat"),
+		Args:   []core.Expr{c.compileListExpr(&ast.ListExpr{Elements: parts})},
+	}
+}
+
+// typeTests maps the built-in types to the erlang BIF that tests for them.
+var typeTests = map[string]string{
+	"int":    "is_integer",
+	"float":  "is_float",
+	"atom":   "is_atom",
+	"list":   "is_list",
+	"tuple":  "is_tuple",
+	"string": "is_list", // strings are lists of characters
+}
+
+func (c *Compiler) compileTypeTestExpr(expr *ast.TypeTestExpr) core.Expr {
+	if lit, ok := c.foldLiteral(expr); ok {
+		return lit
+	}
+	x := c.compileExpr(expr.X)
+	if ident, ok := expr.Type.(*ast.Identifier); ok {
+		if bif, ok := typeTests[ident.Name]; ok {
+			return c.erlangCall(bif, x)
+		}
+	}
+	c.errors = append(c.errors, c.errorf(expr.Type.Pos(), "type test needs a built-in type like int or atom"))
+	return x
+}
+
+// operatorBIFs are the names of the erlang BIFs that implement the operators. The names
+// must be exactly Erlang's, which differ from garlang's for some operators, like '/=' for
+// != and '=<' for <=. The comparisons order any two terms in Erlang's term order, so
+// atoms, tuples and lists are compared with the same BIFs as numbers.
+var operatorBIFs = map[token.Type]string{
+	token.Plus:            "+",
+	token.Minus:           "-",
+	token.Star:            "*",
+	token.Slash:           "/",
+	token.Percent:         "rem",
+	token.MinusMinus:      "--",
+	token.EqualEqual:      "==",
+	token.BangEqual:       "/=",
+	token.EqualEqualEqual: "=:=",
+	token.BangEqualEqual:  "=/=",
+	token.Less:            "<",
+	token.LessEqual:       "=<",
+	token.Greater:         ">",
+	token.GreaterEqual:    ">=",
+	token.And:             "and",
+	token.Or:              "or",
+	token.Not:             "not",
+}
+
+// operatorBIF returns the module and name of the BIF that implements op, like erlang:'+'
+// for +, which is both the binary and, for + and -, the unary operator, or erlang:'not'
+// for not. ok is false for operators that are not a call, like andalso, orelse and is.
+func operatorBIF(op token.Type) (module, name string, ok bool) {
+	name, ok = operatorBIFs[op]
+	return "erlang", name, ok
+}
+
+// operatorCall calls the BIF that implements op with args.
+func (c *Compiler) operatorCall(op token.Type, args ...core.Expr) core.Expr {
+	module, name, ok := operatorBIF(op)
+	if !ok {
+		panic(fmt.Errorf("unrecognized operator: %s", op))
+	}
+	return core.InterModuleCall{Module: c.atom(module), Func: c.atom(name), Args: args}
+}
+
+func (c *Compiler) compileBinaryExpr(expr *ast.BinaryExpr) core.Expr {
+	if lit, ok := c.foldLiteral(expr); ok {
+		return lit
+	}
+	if expr.Op == token.AndAlso || expr.Op == token.OrElse {
+		return c.compileShortCircuit(expr)
+	}
+	return c.operatorCall(expr.Op, c.compileExpr(expr.Left), c.compileExpr(expr.Right))
+}
+
+// compileShortCircuit lowers andalso and orelse to a case on the left side like Erlang
+// does, so the right side is only evaluated if needed:
+//
+//	case Left of                   % Left andalso Right
+//	    <'true'> when 'true' -> Right
+//	    <'false'> when 'true' -> 'false'
+//	    <X> when 'true' -> call 'erlang':'error'({'badarg',X})
+//	end
+//
+// In a guard, a left side that isn't a boolean is returned instead, which fails the guard.
+func (c *Compiler) compileShortCircuit(expr *ast.BinaryExpr) core.Expr {
+	left := c.compileExpr(expr.Left)
+	ifTrue, ifFalse := c.compileExpr(expr.Right), c.atom("false")
+	if expr.Op == token.OrElse {
+		ifTrue, ifFalse = c.atom("true"), ifTrue
+	}
+	other := c.freshVars(1)
+	var bad core.Expr = other[0]
+	if !c.guard {
+		bad = c.erlangCall("error", core.Tuple{Elements: []core.Expr{c.atom("badarg"), other[0]}})
+	}
+	return core.Case{
+		Arg: left,
+		Clauses: []core.Clause{
+			{Patterns: []core.Expr{c.atom("true")}, Body: ifTrue},
+			{Patterns: []core.Expr{c.atom("false")}, Body: ifFalse},
+			{Patterns: exprs(other), Body: bad},
+		},
+	}
+}
+
+func (c *Compiler) compileUnaryExpr(expr *ast.UnaryExpr) core.Expr {
+	if lit, ok := c.foldLiteral(expr); ok {
+		return lit
+	}
+	if expr.Op != token.Minus && expr.Op != token.Plus && expr.Op != token.Not {
+		panic(fmt.Errorf("unrecognized unary operator: %s", expr.Op))
+	}
+	return c.operatorCall(expr.Op, c.compileExpr(expr.Right))
+}
+
+// erlangCall calls the function fn in the erlang module, which is where all the BIFs live.
+func (c *Compiler) erlangCall(fn string, args ...core.Expr) core.Expr {
+	return core.InterModuleCall{
+		Module: c.atom("erlang"),
+		Func:   c.atom(fn),
+		Args:   args,
+	}
+}
+
+func (c *Compiler) compileListExpr(list *ast.ListExpr) core.Expr {
+	var tail core.Expr = core.Nil{}
+	if list.Tail != nil {
+		tail = c.compileExpr(list.Tail)
+	}
+	for i := len(list.Elements) - 1; i >= 0; i-- {
+		tail = core.Cons{Head: c.compileExpr(list.Elements[i]), Tail: tail}
+	}
+	return tail
+}
+
 func (c *Compiler) compileCallExpr(call *ast.CallExpr) core.Expr {
+	if call.Ellipsis.IsValid() {
+		return c.compileSpreadCall(call)
+	}
 	switch expr := call.Callee.(type) {
 	case *ast.DotExpr:
 		return c.compileDotCallExpr(call, expr)
@@ -122,36 +1934,250 @@ func (c *Compiler) compileCallExpr(call *ast.CallExpr) core.Expr {
 	}
 }
 
+// compileSpreadCall compiles a call like `f(a, rest...)`, whose arity is only known at
+// run time, to erlang:apply with the other arguments prepended to the list:
+//
+//	m.f(a, rest...)  =>  call 'erlang':'apply'('m', 'f', [A|Rest])
+//	g(rest...)       =>  call 'erlang':'apply'(G, Rest)
+//
+// A local function is applied as a fun, so it doesn't have to be exported, which only
+// works if the module declares it with one arity.
+func (c *Compiler) compileSpreadCall(call *ast.CallExpr) core.Expr {
+	if c.guard {
+		return c.atom("false") // reported by checkGuard
+	}
+	args := c.compileExprs(call.Arguments)
+	list := args[len(args)-1]
+	for i := len(args) - 2; i >= 0; i-- {
+		list = core.Cons{Head: args[i], Tail: list}
+	}
+
+	switch callee := call.Callee.(type) {
+	case *ast.DotExpr:
+		target := callee.Target
+		if ident, ok := target.(*ast.Identifier); ok {
+			target = &ast.AtomLiteral{Value: ident.Name}
+		}
+		return c.erlangCall("apply", c.compileExpr(target), c.atom(callee.Attribute.Name), list)
+	case *ast.Identifier:
+		if c.bound[callee.Name] {
+			break
+		}
+		if fn, ok := c.funs[callee.Name]; ok {
+			return c.erlangCall("apply", fn, list) // recursive call of a named fun
+		}
+		if _, ok := c.guards[callee.Name]; ok {
+			c.errors = append(c.errors, c.errorf(call.Ellipsis, "cannot spread arguments into guard %s", callee.Name))
+			return c.atom("false")
+		}
+		var modules []string
+		seen := make(map[string]bool)
+		for name, module := range c.imports {
+			if name.Name == callee.Name && !seen[module] {
+				seen[module] = true
+				modules = append(modules, module)
+			}
+		}
+		sort.Strings(modules)
+		if len(modules) > 1 {
+			c.errors = append(c.errors, c.errorf(call.Ellipsis, "cannot spread arguments into %s, which is imported from both %s and %s",
+				callee.Name, modules[0], modules[1]))
+			return c.atom("false")
+		}
+		if len(modules) == 1 {
+			return c.erlangCall("apply", c.atom(modules[0]), c.atom(callee.Name), list)
+		}
+		arities := c.arities[callee.Name]
+		switch len(arities) {
+		case 0:
+			for name, bif := range builtins {
+				if name.Name == callee.Name {
+					return c.erlangCall("apply", c.atom("erlang"), c.atom(bif), list)
+				}
+			}
+			c.errors = append(c.errors, c.errorf(callee.Pos(), "undefined function %s", callee.Name))
+			return c.atom("false")
+		case 1:
+			return c.erlangCall("apply", core.FuncName{Name: callee.Name, Arity: arities[0]}, list)
+		default:
+			var names []string
+			for _, arity := range arities {
+				names = append(names, fmt.Sprintf("%s/%d", callee.Name, arity))
+			}
+			c.errors = append(c.errors, c.errorf(call.Ellipsis, "cannot spread arguments into %s, which is declared as %s",
+				callee.Name, strings.Join(names, " and ")))
+			return c.atom("false")
+		}
+	}
+	return c.erlangCall("apply", c.compileExpr(call.Callee), list)
+}
+
+// checkGuard returns an error for every part of test that isn't allowed in a guard,
+// using the same rules as parser.Guard. A guard can also call the guards declared with
+// `guard`, which are inlined.
+func (c *Compiler) checkGuard(test ast.Expression) []error {
+	var errs []error
+	isGuard := func(name string) bool {
+		_, ok := c.guards[name]
+		return ok && !c.bound[name]
+	}
+	parser.CheckGuard(test, isGuard, func(pos token.Pos, err error) {
+		errs = append(errs, c.errorf(pos, "%v", err))
+	})
+	return errs
+}
+
 func (c *Compiler) compileLocalCallExpr(expr *ast.CallExpr) core.Expr {
 	// If an identifier and identifier is not defined in function as variable,
-	// treat as an atom
-	if ident, ok := expr.Callee.(*ast.Identifier); ok {
-		expr.Callee = &ast.AtomLiteral{Value: ident.Name}
+	// treat as a local function name. A variable holds a fun, which is applied.
+	var callee core.Expr
+	if ident, ok := expr.Callee.(*ast.Identifier); ok && !c.bound[ident.Name] {
+		if decl, ok := c.guards[ident.Name]; ok {
+			return c.inlineGuard(expr, decl)
+		}
+		if c.guard && core.IsGuardBIF(ident.Name) {
+			// like in Erlang, guard BIFs are called without the module in a guard
+			return c.erlangCall(ident.Name, c.compileExprs(expr.Arguments)...)
+		}
+		name := core.FuncName{Name: ident.Name, Arity: len(expr.Arguments)}
+		callee = name
+		if fn, ok := c.funs[ident.Name]; ok && fn.Arity == len(expr.Arguments) {
+			callee = fn // recursive call of a named fun
+		} else if module, ok := c.imports[name]; ok {
+			return core.InterModuleCall{
+				Module: c.atom(module),
+				Func:   c.atom(ident.Name),
+				Args:   c.compileExprs(expr.Arguments),
+			}
+		} else if bif, ok := c.builtin(name); ok {
+			return c.erlangCall(bif, c.compileExprs(expr.Arguments)...)
+		}
+	} else {
+		callee = c.compileExpr(expr.Callee)
+	}
+
+	args := c.compileExprs(expr.Arguments)
+	return c.bindCallee(callee, func(callee core.Expr) core.Expr {
+		return core.Application{Func: callee, Args: args}
+	})
+}
+
+// bindCallee returns call(callee), with callee bound to a fresh variable first unless it
+// is a name or a variable, since Core Erlang can only call those. In a chain like
+// m.f(1).g(2), the module of g is the result of m.f(1):
+//
+//	let <_0> = call 'm':'f'(1) in call _0:'g'(2)
+func (c *Compiler) bindCallee(callee core.Expr, call func(callee core.Expr) core.Expr) core.Expr {
+	switch callee.(type) {
+	case core.Atom, core.Var, core.FuncName, core.Func:
+		return call(callee)
+	}
+	v := c.freshVars(1)[0]
+	return core.Let{Vars: []core.Var{v}, Arg: callee, Body: call(v)}
+}
+
+// compileFuncRef compiles a reference like `foo/2` to the function as a fun, which is the
+// local function itself, since Core Erlang allows it as a value, or a fun made by
+// erlang:make_fun/3 for an imported function. If the name is a variable, a constant or a
+// parameter of the guard being inlined, the reference is a division instead.
+func (c *Compiler) compileFuncRef(ref *ast.FuncRef) core.Expr {
+	_, isConst := c.consts[ref.Name.Name]
+	isParam := false
+	if n := len(c.inlining); n > 0 {
+		_, isParam = c.inlining[n-1].args[ref.Name.Name]
+	}
+	if c.bound[ref.Name.Name] || isConst || isParam {
+		return c.compileExpr(ref.Division())
+	}
+
+	name := core.FuncName{Name: ref.Name.Name, Arity: int(ref.Arity.Value)}
+	if c.guard {
+		c.errors = append(c.errors, c.errorf(ref.Pos(), "reference to %s/%d is not allowed in a guard", name.Name, name.Arity))
 	}
+	if fn, ok := c.funs[name.Name]; ok && fn.Arity == name.Arity {
+		return fn // a named fun referring to itself
+	}
+	if module, ok := c.imports[name]; ok {
+		return c.erlangCall("make_fun", c.atom(module), c.atom(name.Name), core.Integer{Value: ref.Arity.Value})
+	}
+	if bif, ok := c.builtin(name); ok {
+		return c.erlangCall("make_fun", c.atom("erlang"), c.atom(bif), core.Integer{Value: ref.Arity.Value})
+	}
+	return name
+}
+
+// inlinedGuard is a guard whose body is being compiled in place of a call.
+type inlinedGuard struct {
+	decl *ast.GuardDecl
+	args map[string]core.Expr // compiled arguments by parameter name
+}
+
+// inlineGuard compiles a call of a guard declared with `guard` to its body with the
+// parameters replaced by the arguments, since Erlang guards can't call functions.
+func (c *Compiler) inlineGuard(call *ast.CallExpr, decl *ast.GuardDecl) core.Expr {
+	if len(call.Arguments) != len(decl.Parameters) {
+		c.errors = append(c.errors, c.errorf(call.Pos(), "guard %s takes %d arguments, got %d",
+			decl.Name.Name, len(decl.Parameters), len(call.Arguments)))
+		return c.atom("false")
+	}
+	for _, g := range c.inlining {
+		if g.decl == decl {
+			c.errors = append(c.errors, c.errorf(call.Pos(), "guard %s refers to itself", decl.Name.Name))
+			return c.atom("false")
+		}
+	}
+	args := make(map[string]core.Expr)
+	for i, param := range decl.Parameters {
+		args[param.Name] = c.compileExpr(call.Arguments[i])
+	}
+	c.inlining = append(c.inlining, inlinedGuard{decl: decl, args: args})
+	body := c.compileExpr(decl.Body)
+	c.inlining = c.inlining[:len(c.inlining)-1]
+	return body
+}
 
-	return core.Application{
-		Func: c.compileExpr(expr.Callee),
-		Args: c.compileExprs(expr.Arguments),
+// compileGuardParam compiles a name in the body of an inlined guard, which is either
+// one of its parameters or a constant.
+func (c *Compiler) compileGuardParam(g inlinedGuard, ident *ast.Identifier) core.Expr {
+	if arg, ok := g.args[ident.Name]; ok {
+		return arg
 	}
+	if decl, ok := c.consts[ident.Name]; ok {
+		// the value of the constant is outside of the guard
+		inlining := c.inlining
+		c.inlining = nil
+		defer func() { c.inlining = inlining }()
+		return c.compileExpr(decl.Value)
+	}
+	c.errors = append(c.errors, c.errorf(ident.Pos(), "%s is not a parameter of guard %s", ident.Name, g.decl.Name.Name))
+	return coreVar(ident.Name)
 }
 
 func (c *Compiler) compileDotCallExpr(call *ast.CallExpr, dot *ast.DotExpr) core.Expr {
 	// If an identifier and identifier is not defined in function as variable,
 	// treat as an atom
-	if ident, ok := dot.Target.(*ast.Identifier); ok {
-		dot.Target = &ast.AtomLiteral{Value: ident.Name}
-	}
-	return core.InterModuleCall{
-		Module: c.compileExpr(dot.Target),
-		Func:   core.Atom{Value: dot.Attribute.Name},
-		Args:   c.compileExprs(call.Arguments),
+	target := dot.Target
+	if ident, ok := target.(*ast.Identifier); ok {
+		target = &ast.AtomLiteral{Value: ident.Name}
 	}
+	module := c.compileExpr(target)
+	args := c.compileExprs(call.Arguments)
+	return c.bindCallee(module, func(module core.Expr) core.Expr {
+		return core.InterModuleCall{
+			Module: module,
+			Func:   c.atom(dot.Attribute.Name),
+			Args:   args,
+		}
+	})
 }
 
+// moduleNameAtom is replaced with the name of the compiled module wherever it appears
+// as an atom in the base functions.
+const moduleNameAtom = "{{mod}}"
+
 // commonModFuncs are default funcs that are included in every Erlang module
 // If these are not included, the Erlang VM will not be able to load the module.
-func commonModFuncs(mod *ast.Module) string {
-	return strings.NewReplacer("{{mod}}", mod.Id.Name).Replace(`
+const commonModFuncs = `
 module common
 
 func module_info() {
@@ -161,18 +2187,64 @@ func module_info() {
 func module_info(Value) {
 	return erlang.module_info('{{mod}}', Value)
 }
-`)
+`
+
+// builtins are the functions that every module can call without importing them, and
+// the erlang BIFs they are compiled to, so `raise('reason')` is erlang:error('reason').
+// A function declared or imported with the same name and arity takes precedence.
+var builtins = map[core.FuncName]string{
+	{Name: "raise", Arity: 1}: "error",
+	{Name: "error", Arity: 1}: "error",
+	{Name: "throw", Arity: 1}: "throw",
 }
 
-// addBaseFuncs adds the module_info functions that Erlang requires as part of every
-// module.
-//
-// The functions are very simple: just call 'erlang':module_info/1 with the appropriate atom.
-func addBaseFuncs(mod *ast.Module) *ast.Module {
-	commonMod, err := parser.Module("<builtin>", []byte(commonModFuncs(mod)))
+// builtin returns the erlang BIF that name is compiled to, if it is one of the builtins
+// and the module doesn't declare or import a function with the same name and arity.
+func (c *Compiler) builtin(name core.FuncName) (string, bool) {
+	bif, ok := builtins[name]
+	if !ok {
+		return "", false
+	}
+	if _, ok := c.imports[name]; ok {
+		return "", false
+	}
+	for _, arity := range c.arities[name.Name] {
+		if arity == name.Arity {
+			return "", false
+		}
+	}
+	return bif, true
+}
+
+var (
+	defaultBaseOnce  sync.Once
+	defaultBaseDecls []ast.Decl
+	defaultBaseErr   error
+)
+
+// defaultBaseFuncs parses commonModFuncs once and returns the cached declarations.
+func defaultBaseFuncs() ([]ast.Decl, error) {
+	defaultBaseOnce.Do(func() {
+		defaultBaseDecls, defaultBaseErr = parseBaseFuncs([]byte(commonModFuncs))
+	})
+	return defaultBaseDecls, defaultBaseErr
+}
+
+func parseBaseFuncs(src []byte) ([]ast.Decl, error) {
+	baseMod, err := parser.Module("<builtin>", src)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("parse base funcs: %w", err)
 	}
-	mod.Decls = append(commonMod.Decls, mod.Decls...)
-	return mod
+	// never nil, so an empty base module still replaces the defaults
+	return append([]ast.Decl{}, baseMod.Decls...), nil
+}
+
+// withBaseFuncs returns the declarations of mod with the base functions that Erlang
+// requires as part of every module (like module_info) placed in front. mod is not modified.
+//
+// The default functions are very simple: just call 'erlang':module_info/1 with the appropriate atom.
+func withBaseFuncs(mod *ast.Module, base []ast.Decl) []ast.Decl {
+	decls := make([]ast.Decl, 0, len(base)+len(mod.Decls))
+	decls = append(decls, base...)
+	return append(decls, mod.Decls...)
 }
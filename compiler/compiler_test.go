@@ -2,10 +2,16 @@ package compiler
 
 import (
 	"bytes"
+	"errors"
+	"math"
 	"testing"
 
+	"github.com/masp/garlang/ast"
 	"github.com/masp/garlang/core"
+	"github.com/masp/garlang/internal/bench"
+	"github.com/masp/garlang/internal/golden"
 	"github.com/masp/garlang/parser"
+	"github.com/masp/garlang/token"
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/require"
 )
@@ -19,6 +25,423 @@ func TestCompileModule(t *testing.T) {
 			input:    `module mod; func a() { return 1 }`,
 			expected: "mod.core",
 		},
+		{
+			input: `module consts
+const Pi = 3.14
+const Greeting = 'hello'
+func area(r) { return Pi * r * r }
+func greeting() { return Greeting }
+func shadow(Pi) { return Pi }`,
+			expected: "const.core",
+		},
+		{
+			input: `module divmod
+func divmod(a, b) { return a / b, a % b }
+func sum() {
+	q, r = divmod(10, 3)
+	s = q + r
+	return s
+}`,
+			expected: "divmod.core",
+		},
+		{
+			input: `module loop
+func count(n) {
+	i = 0
+	while i < n {
+		i = i + 1
+	}
+	return i
+}`,
+			expected: "while.core",
+		},
+		{
+			input: `module cond
+func clamp(t, n) {
+	if x := erlang.element(1, t); x > n {
+		n = x
+	}
+	if {^n, y} := t; y > 0 {
+		return y
+	}
+}
+func shadow(x) {
+	if x := erlang.abs(x); x > 5 {
+		x = 2
+	}
+	return x
+}`,
+			expected: "if.core",
+		},
+		{
+			input: `module chain
+func sign(n) {
+	s = 'zero'
+	if n < 0 {
+		s = 'negative'
+	} else if is_integer(n) and n > 0 {
+		s = 'positive'
+	} else {
+		erlang.display(n)
+	}
+	return s
+}
+func classify(n) {
+	if n < 0 {
+		return 'small'
+	} else if lists.member(n, [1, 2]) {
+		return 'listed'
+	} else if n > 100 {
+		return 'big'
+	}
+}
+func checked(n) {
+	if n + 1 > 0 {
+		return 'positive'
+	} else if n > 5 {
+		return 'big'
+	} else {
+		return 'other'
+	}
+}`,
+			expected: "if_chain.core",
+		},
+		{
+			input: `module compare
+func before(a, b) when a is atom, b is atom { return a < b }
+func order(x) {
+	return {x >= 'm', 'apple' < 'banana', 'b' <= 'ab', {x, 1} > {x, 0}, [x] < "abc"}
+}`,
+			expected: "compare.core",
+		},
+		{
+			// `_` matches anything without binding a variable
+			input: `module discard
+func y(point) {
+	{_, y} = point
+	return y
+}
+func z(t) {
+	_, _, z = t
+	_, w = {z, 1}
+	_ = erlang.display(w)
+	return z
+}`,
+			expected: "discard.core",
+		},
+		{
+			// raise, error and throw are always available
+			input: `module builtins
+func check(x) {
+	return case x {
+		0 -> raise('zero')
+		1 -> error({'bad', x})
+		_ -> throw(x)
+	}
+}
+func handlers(args) {
+	return {raise/1, throw/1, error(args...)}
+}`,
+			expected: "builtins.core",
+		},
+		{
+			input: `module spread
+import "lists" (max/1)
+func apply(f, x, args) {
+	return {f(x, args...), lists.append(args...), max(args...), add(x, args...)}
+}
+func add(a, b) { return a + b }`,
+			expected: "spread.core",
+		},
+		{
+			input: `module neg
+const Limit = 10
+func check(x) when not is_integer(x) { return 'other' }
+func check(x) when not x > Limit, not Limit is int or x == 0 { return 'small' }
+func check(x) { return not x is int }`,
+			expected: "not.core",
+		},
+		{
+			input: `module chain
+func f(fs, x) {
+	return {mod.fn(1).fn(2).fn(3), lists.last(fs)(x), (fn(y) { return y })(x)}
+}`,
+			expected: "chain.core",
+		},
+		{
+			input: `module alias
+func sum(t) {
+	return case t {
+		all = {x, y} when x > 0 -> {all, x + y}
+		_ -> 'none'
+	}
+}`,
+			expected: "case_alias.core",
+		},
+		{
+			input: `module test
+func find(x, t) {
+	{^x, y} := t
+	return case y {
+		[^x | _] -> 'first'
+		^x when x > 0 -> 'same'
+		_ -> y
+	}
+}`,
+			expected: "pin.core",
+		},
+		{
+			input: `module test
+func same({x, x}) { return x }
+func both(x, x) { return x }
+func head([x | x]) { return x }
+func pair(t) {
+	return case t {
+		{y, y} -> y
+		{a, b} -> a
+	}
+}`,
+			expected: "repeat.core",
+		},
+		{
+			input: `module test
+func push(x, xs) { return [x | xs] }
+func push2(a, b, xs) { return [a, b | xs] }
+func cons(x) { return [x | [1, 2]] }`,
+			expected: "prepend.core",
+		},
+		{
+			input: `module test
+import "lists" (sum/1)
+func double(x) { return x * 2 }
+func refs(n) {
+	return {double/1, sum/1, n/2, (n)/1}
+}`,
+			expected: "func_ref.core",
+		},
+		{
+			// a list sum with the empty list as the base case
+			input: `module test
+func sum([]) { return 0 }
+func sum([x | xs]) { return x + sum(xs) }
+func size({}) { return 0 }
+func size({_}) { return 1 }
+func empty(x) {
+	return case x {
+		[] -> 'true'
+		{} -> 'true'
+		_ -> 'false'
+	}
+}`,
+			expected: "empty_patterns.core",
+		},
+		{
+			// the deferred call runs after the body returns or raises
+			input: `module test
+func process(f) {
+	defer file.close(f)
+	return file.read(f)
+}`,
+			expected: "defer.core",
+		},
+		{
+			// defers run in reverse order, so b is closed before a
+			input: `module test
+func copy(a, b) {
+	defer file.close(a)
+	defer file.close(b)
+	file.copy(a, b)
+}`,
+			expected: "defer_order.core",
+		},
+		{
+			// a module without declarations only has module_info
+			input:    "module test",
+			expected: "empty.core",
+		},
+		{
+			input: `module test
+@inline func f() { return 1 }
+@deprecated("use f")
+func g(x) { return x }`,
+			expected: "annotation.core",
+		},
+		{
+			// switch on two values at once with tuple patterns
+			input: `module sw
+func classify(a, b) {
+	return case {a, b} {
+		{1, _} -> 'first'
+		{_, 2} -> 'second'
+		{_, _} -> 'neither'
+	}
+}`,
+			expected: "case_tuple.core",
+		},
+		{
+			input: `module fact
+func facts(ns) {
+	return lists.map(fn fact(n) {
+		return case n {
+			0 -> 1
+			_ -> n * fact(n - 1)
+		}
+	}, ns)
+}`,
+			expected: "fun_named.core",
+		},
+		{
+			input: `module greet
+func greet(name, n) {
+	return "hello #{name}, you have #{n + 1} messages"
+}
+func escaped() {
+	return "use \#{name} to interpolate"
+}`,
+			expected: "interp.core",
+		},
+		{
+			input: `module types
+func number(x) when x is int; x is float {
+	return x is string
+}`,
+			expected: "type_test.core",
+		},
+		{
+			input: `module guards
+const Max = 10
+guard even(x) = x % 2 == 0
+guard small(x) = x < Max
+func f(n) when even(n + 1) {
+	return case n {
+		m when small(m) -> 'small'
+		_ -> 'big'
+	}
+}`,
+			expected: "guard_decl.core",
+		},
+		{
+			// nested ternaries are right-associative
+			input: `module sign
+func sign(x) {
+	return x > 0 ? 'pos' : x < 0 ? 'neg' : 'zero'
+}`,
+			expected: "ternary.core",
+		},
+		{
+			// functions imported by name are called without their module
+			input: `module stats
+import "lists" (sum/1, reverse/1)
+func total(xs) {
+	return sum(reverse(xs))
+}`,
+			expected: "import_funcs.core",
+		},
+		{
+			input: `module safe
+func safe(x) {
+	return catch risky(x)
+}
+func risky(x) {
+	return erlang.error(x)
+}`,
+			expected: "catch.core",
+		},
+		{
+			// consecutive heads with the same name and arity are one function
+			input: `module colors
+func color('red') { return 1 }
+func color('green') { return 2 }
+func color(0) { return 'black' }
+func color(other) { return other }`,
+			expected: "multi_head.core",
+		},
+		{
+			// indexes start at 0, and element/2 at 1
+			input: `module pairs
+func first(p) { return p[0] }
+func nth(p, i) { return p[i] }`,
+			expected: "index.core",
+		},
+		{
+			input: `module echo
+func loop() {
+	return receive {
+		{'echo', from, msg} when msg != 'stop' -> erlang.send(from, msg)
+		'stop' -> 'ok'
+	}
+}`,
+			expected: "receive.core",
+		},
+		{
+			input: `module test
+const Tick = 100
+func wait(n) {
+	return receive {
+		'stop' -> 'stopped'
+		after Tick * n -> 'timeout'
+	}
+}
+func sleep(ms) { return receive { after ms -> 'ok' } }
+func forever() {
+	return receive {
+		{'msg', m} -> m
+		after 'infinity' -> 'never'
+	}
+}`,
+			expected: "receive_after.core",
+		},
+		{
+			input: `module test
+func both(a, b) { return a > 0 and b > 0 }
+func either(a, b) { return a or b }
+func safe(xs) { return xs != [] andalso erlang.hd(xs) > 0 }
+func default(x) { return x == nil orelse x }
+func guarded(x) when x is int andalso x > 0 orelse x == 'none' { return x }`,
+			expected: "bool_ops.core",
+		},
+		{
+			// guard BIFs can be called without the erlang module in a guard
+			input: `module test
+func first(x) when is_list(x) andalso length(x) > 0 { return erlang.hd(x) }
+func first(x) when erlang.is_tuple(x) andalso tuple_size(x) > 0 orelse is_map(x) { return x }`,
+			expected: "guard_bifs.core",
+		},
+		{
+			input: `module test
+func ` + "`weird name`(`my var`, x) {\n\t`the sum` = `my var` + x\n\treturn `receive`(`the sum`, `x`)\n}" + `
+func ` + "`receive`(a, b) { return {a, b} }",
+			expected: "quoted_ident.core",
+		},
+		{
+			input: `module test
+const Max = 10
+func digit(x) when x in 0..9 { return x }
+func other(x) when not x in 0..9 { return x }
+func grade(s) {
+	return case s {
+		n when n in Max - 5..Max; n == 0 -> 'ok'
+		_ -> 'bad'
+	}
+}`,
+			expected: "range_guard.core",
+		},
+		{
+			input: `module test
+func scale(xs, k) {
+	return lists.map(fn(x) { return let y = x * k in {x, y} }, xs)
+}
+func shadow(x) {
+	return {let x = x + 1 in x * 2, x}
+}`,
+			expected: "let.core",
+		},
+		{
+			input: `module test
+func without() { return [1, 2, 3] -- [2] }
+func without(xs, ys) { return xs -- ys -- [0] }`,
+			expected: "list_sub.core",
+		},
 	}
 
 	for _, tt := range tests {
@@ -30,6 +453,7 @@ func TestCompileModule(t *testing.T) {
 
 			compiled, err := New().CompileModule(mod)
 			require.NoError(t, err)
+			require.NoError(t, core.Validate(compiled))
 
 			var out bytes.Buffer
 			core.NewPrinter(&out).PrintModule(compiled)
@@ -40,6 +464,630 @@ func TestCompileModule(t *testing.T) {
 
 }
 
+func TestCompileModuleErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{
+			input:   "module m; const A = B; const B = A",
+			wantErr: "<test>:1:34: const A refers to itself",
+		},
+		{
+			input:   "module m; func f(a, b) { while a < b { a = a + 1; b = b - 1 } }",
+			wantErr: "<test>:1:26: while loop updates more than one variable (a, b), only one is supported",
+		},
+		{
+			input:   "module m; func f(x) { if x > 0 { return 1 }; return 2 }",
+			wantErr: "<test>:1:34: return inside an if statement is only supported in the last statement",
+		},
+		{
+			input:   "module m; func g(x) { return x }; func g(x, y) { return y }; func f(xs) { return g(xs...) }",
+			wantErr: "<test>:1:86: cannot spread arguments into g, which is declared as g/1 and g/2",
+		},
+		{
+			input:   "module m; func f(xs) { return g(xs...) }",
+			wantErr: "<test>:1:31: undefined function g",
+		},
+		{
+			input:   "module m; func f(x) { return case x { f() -> 1 } }",
+			wantErr: "<test>:1:39: invalid pattern",
+		},
+		{
+			input:   "module m; func f(x) { return case x { ^y -> 1 } }",
+			wantErr: "<test>:1:40: cannot pin y, which is not bound",
+		},
+		{
+			input:   "module m; @inline(1) func f() { return 1 }",
+			wantErr: "<test>:1:19: @inline takes no arguments",
+		},
+		{
+			input:   "module m; @deprecated('soon') func f() { return 1 }",
+			wantErr: "<test>:1:23: @deprecated takes no arguments or a string",
+		},
+		{
+			input:   "module m; func f(x) when is_list(x) andalso lists.member(1, x) { return x }",
+			wantErr: "<test>:1:45: call to lists.member/2 is not allowed in a guard",
+		},
+		{
+			input:   "module m; func g(x) { return x }; func f(x) { return case x { y when g(y) -> y } }",
+			wantErr: "<test>:1:70: call to g/1 is not allowed in a guard",
+		},
+		{
+			input:   "module m; func g(x) { return x }; func f(x) when x == g/1 { return x }",
+			wantErr: "<test>:1:55: reference to g/1 is not allowed in a guard",
+		},
+		{
+			input:   "module m; func f(x) when receive { after 1 -> 'true' } { return x }",
+			wantErr: "<test>:1:26: receive expression is not allowed in a guard",
+		},
+		{
+			input:   "module m; func f(x) when case x { _ -> 'true' } { return x }",
+			wantErr: "<test>:1:26: case expression is not allowed in a guard",
+		},
+		{
+			input:   "module m; func f(xs) when xs -- [1] == [] { return xs }",
+			wantErr: "<test>:1:30: '--' is not allowed in a guard",
+		},
+		{
+			input:   "module m; guard small(x) = erlang.display(x); func f(x) when small(x) { return x }",
+			wantErr: "<test>:1:28: call to erlang.display/1 is not allowed in a guard",
+		},
+		{
+			input:   "module m; func f(x) { while x > 0 { defer io.write(x); x = x - 1 } }",
+			wantErr: "<test>:1:37: defer inside a loop is not supported",
+		},
+		{
+			input:   "module m; func f(x) { if x > 0 { defer io.write(x) }; return x }",
+			wantErr: "<test>:1:34: defer inside an if statement is only supported in the last statement",
+		},
+		{
+			input:   "module m; func f(x) { if x > 0 { while x > 0 { defer io.write(x); x = x - 1 } }; return x }",
+			wantErr: "<test>:1:48: defer inside a loop is not supported",
+		},
+		{
+			input:   "module m; func g(x) { return x }; const F = g/1",
+			wantErr: "<test>:1:45: const value must be a constant expression",
+		},
+		{
+			input:   "module m; func f(x) { return ^x }",
+			wantErr: "<test>:1:30: '^' can only pin a variable in a pattern",
+		},
+		{
+			input:   "module m; func f(x) { return {a, b} = x }",
+			wantErr: "<test>:1:30: assignment can only be used as a statement",
+		},
+		{
+			input:   "module m; func f(x) { return g(y = x) }",
+			wantErr: "<test>:1:32: assignment can only be used as a statement",
+		},
+		{
+			input:   "module m; func f() { return receive { after 1.5 -> 'timeout' } }",
+			wantErr: "<test>:1:45: receive timeout must be an integer or 'infinity'",
+		},
+		{
+			input:   "module m; func f() { return receive { after 'never' -> 'timeout' } }",
+			wantErr: "<test>:1:45: receive timeout must be an integer or 'infinity'",
+		},
+		{
+			input:   "module m; func f(x) { return x is pid }",
+			wantErr: "<test>:1:35: type test needs a built-in type like int or atom",
+		},
+		{
+			input:   "module m; guard g(x) = x > 0; func f(x) when g(x, 1) { return x }",
+			wantErr: "<test>:1:46: guard g takes 1 arguments, got 2",
+		},
+		{
+			input:   "module m; guard g(x) = g(x); func f(x) when g(x) { return x }",
+			wantErr: "<test>:1:24: guard g refers to itself",
+		},
+		{
+			input:   "module m; guard g(x) = x > y; func f(x, y) when g(x) { return y }",
+			wantErr: "<test>:1:28: y is not a parameter of guard g",
+		},
+		{
+			input:   "module m; guard g(x) = x > 0; guard g(y) = y < 0",
+			wantErr: "<test>:1:37: guard g redeclared, previous declaration at <test>:1:17",
+		},
+		{
+			input:   "module m; const A = f()",
+			wantErr: "<test>:1:21: const value must be a constant expression",
+		},
+		{
+			input:   "module m; const A = x",
+			wantErr: "<test>:1:21: x is not a constant",
+		},
+		{
+			input:   "module m; const A = 1; const A = 2",
+			wantErr: "<test>:1:30: const A redeclared, previous declaration at <test>:1:17",
+		},
+		{
+			input:   `module m; import "lists" (sum/1); func sum(xs) { return 0 }`,
+			wantErr: "<test>:1:27: sum/1 is imported from lists and also defined in this module",
+		},
+		{
+			input:   `module m; import "lists" (sum/1); import "math" (sum/1)`,
+			wantErr: "<test>:1:50: sum/1 is imported from both lists and math",
+		},
+		{
+			input:   `module m; import foo "bar"; func foo() { return foo.f() }`,
+			wantErr: "<test>:1:18: import alias foo collides with local function foo declared at <test>:1:34",
+		},
+		{
+			input:   `module m; import even "bar"; guard even(x) = x % 2 == 0`,
+			wantErr: "<test>:1:18: import alias even collides with local function even declared at <test>:1:36",
+		},
+		{
+			input:   `module m; import foo "bar"; func f(foo) { return foo.g() }`,
+			wantErr: "<test>:1:36: variable foo collides with import alias declared at <test>:1:18",
+		},
+		{
+			input:   "module m; func f('a') { return 1 }; func g() { return 2 }; func f('b') { return 3 }",
+			wantErr: "<test>:1:65: function f/1 redeclared, previous declaration at <test>:1:16",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mod, err := parser.Module("<test>", []byte(tt.input))
+			require.NoError(t, err)
+
+			_, err = New().CompileModule(mod)
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestErrorPhase(t *testing.T) {
+	_, err := parser.Module("<test>", []byte("module m; func f( { return 1 }"))
+	require.ErrorAs(t, err, &parser.Error{})
+	require.False(t, errors.As(err, &Error{}), "parse error should not be a compile error")
+
+	mod, err := parser.Module("<test>", []byte("module m; const A = B; const B = A"))
+	require.NoError(t, err)
+	_, err = New().CompileModule(mod)
+	var compileErr Error
+	require.ErrorAs(t, err, &compileErr)
+	require.False(t, errors.As(err, &parser.Error{}), "compile error should not be a parse error")
+	require.EqualError(t, compileErr.Err, "<test>:1:34: const A refers to itself")
+}
+
+// unknownExpr is an expression the compiler doesn't know how to compile.
+type unknownExpr struct {
+	*ast.Identifier
+}
+
+func TestCompileModuleInternalError(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m; func f() { return 1 }"))
+	require.NoError(t, err)
+	ret := mod.Decls[0].(*ast.FuncDecl).Statements[0].(*ast.ReturnStatement)
+	ret.Expression = unknownExpr{&ast.Identifier{NamePos: ret.Expression.Pos(), Name: "x"}}
+
+	var compileErr Error
+	require.NotPanics(t, func() { _, err = New().CompileModule(mod) })
+	require.ErrorAs(t, err, &compileErr)
+	require.EqualError(t, err, "internal compiler error at <test>:1:29: unrecognized expression type: compiler.unknownExpr")
+}
+
+func TestCompileModuleBuiltinShadowed(t *testing.T) {
+	var plain Compiler // builds the expected trees without interning
+	mod, err := parser.Module("<test>", []byte(`module m
+import "logger" (error/1)
+func raise(x) { return x }
+func f() { return {raise(1), error(2), throw(3)} }`))
+	require.NoError(t, err)
+	compiled, err := New().CompileModule(mod)
+	require.NoError(t, err)
+
+	var body core.Expr
+	for _, fn := range compiled.Functions {
+		if fn.Name.Name == "f" {
+			body = fn.Body
+		}
+	}
+	// the module's own raise/1 and the imported error/1 take precedence over the builtins
+	require.Equal(t, core.Tuple{Elements: []core.Expr{
+		core.Application{Func: core.FuncName{Name: "raise", Arity: 1}, Args: []core.Expr{core.Integer{Value: 1}}},
+		core.InterModuleCall{Module: core.Atom{Value: "logger"}, Func: core.Atom{Value: "error"}, Args: []core.Expr{core.Integer{Value: 2}}},
+		plain.erlangCall("throw", core.Integer{Value: 3}),
+	}}, body)
+}
+
+func TestCompileModuleCallVariable(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module m
+func call(f) { return f(1) }
+func local() { return f(1) }`))
+	require.NoError(t, err)
+	compiled, err := New().CompileModule(mod)
+	require.NoError(t, err)
+
+	body := func(name string) core.Expr {
+		for _, fn := range compiled.Functions {
+			if fn.Name.Name == name {
+				return fn.Body
+			}
+		}
+		t.Fatalf("function %s not compiled", name)
+		return nil
+	}
+	// f is a parameter, so it holds a fun that is applied
+	require.Equal(t, core.Application{Func: core.Var{Name: "F"}, Args: []core.Expr{core.Integer{Value: 1}}}, body("call"))
+	// f is not bound, so it names a function of the module
+	require.Equal(t, core.Application{Func: core.FuncName{Name: "f", Arity: 1}, Args: []core.Expr{core.Integer{Value: 1}}}, body("local"))
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{
+			input: "module m\nfunc f(x, y) { return g(x) }\nfunc h() { a = 1; return 2 }",
+			want: []string{
+				"<test>:2:1: error: 'f'/2: undefined function 'g'/1",
+				"<test>:2:11: warning: y declared and not used",
+				"<test>:3:12: warning: a declared and not used",
+			},
+		},
+		{
+			input: "module m\nfunc f(x) when lists.member(x, [1]) { return x }",
+			want:  []string{"<test>:2:16: error: call to lists.member/2 is not allowed in a guard"},
+		},
+		{
+			input: "module m; func f(x) { return x }",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mod, err := parser.Module("<test>", []byte(tt.input))
+			require.NoError(t, err)
+			var got []string
+			for _, diag := range New().Check(mod) {
+				got = append(got, diag.String())
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	// a problem core.Validate finds is at the function it is in
+	mod, err := parser.Module("<test>", []byte("module m\n\n  func f() { return g(1) }"))
+	require.NoError(t, err)
+	diags := New().Check(mod)
+	require.Len(t, diags, 1)
+	require.Equal(t, 3, diags[0].Pos.Line)
+	require.Equal(t, 3, diags[0].Pos.Column)
+	require.Equal(t, "'f'/0: undefined function 'g'/1", diags[0].Msg)
+
+	mod, err = parser.Module("<test>", []byte("module m; func f(x, y) { return x }"))
+	require.NoError(t, err)
+	diags = New(WerrorMode()).Check(mod)
+	require.Len(t, diags, 1)
+	require.Equal(t, SeverityError, diags[0].Severity)
+}
+
+func TestCompileModuleEmptyBody(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m; func f() {}; func g() { return fn() {} }"))
+	require.NoError(t, err)
+
+	coreMod, err := New().CompileModule(mod)
+	require.NoError(t, err)
+	var bodies []core.Expr
+	for _, fn := range coreMod.Functions {
+		switch fn.Name.Name {
+		case "f":
+			bodies = append(bodies, fn.Body)
+		case "g":
+			bodies = append(bodies, fn.Body.(core.Func).Body)
+		}
+	}
+	require.Equal(t, []core.Expr{core.Atom{Value: "ok"}, core.Atom{Value: "ok"}}, bodies)
+}
+
+func TestCompileModuleEmpty(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m"))
+	require.NoError(t, err)
+
+	coreMod, err := New().CompileModule(mod)
+	require.NoError(t, err)
+	require.NoError(t, core.Validate(coreMod))
+	require.Equal(t, []core.FuncName{{Name: "module_info", Arity: 0}, {Name: "module_info", Arity: 1}}, coreMod.Exports)
+	require.Len(t, coreMod.Functions, 2)
+}
+
+func TestCompileModuleBadmatch(t *testing.T) {
+	var plain Compiler // builds the expected trees without interning
+	// like Erlang, a pattern on the left of '=' raises badmatch if the value doesn't match
+	mod, err := parser.Module("<test>", []byte("module m; func f() { {'ok', v} = g(); return v }; func g() { return 'error' }"))
+	require.NoError(t, err)
+
+	coreMod, err := New().CompileModule(mod)
+	require.NoError(t, err)
+	var body core.Expr
+	for _, fn := range coreMod.Functions {
+		if fn.Name.Name == "f" {
+			body = fn.Body
+		}
+	}
+	match, ok := body.(core.Case)
+	require.True(t, ok, "a pattern is matched with a case, got %T", body)
+	require.Len(t, match.Clauses, 2)
+	require.Equal(t, core.Tuple{Elements: []core.Expr{core.Atom{Value: "ok"}, core.Var{Name: "V"}}}, match.Clauses[0].Patterns[0])
+	other := match.Clauses[1].Patterns[0].(core.Var)
+	require.Equal(t, plain.matchFail("badmatch", []core.Var{other}), match.Clauses[1].Body)
+}
+
+func TestCompileModuleCoreVersion(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m"))
+	require.NoError(t, err)
+
+	coreMod, err := New().CompileModule(mod)
+	require.NoError(t, err)
+	require.Zero(t, coreMod.Version, "the latest version by default")
+
+	coreMod, err = New(WithCoreVersion(core.Version103)).CompileModule(mod)
+	require.NoError(t, err)
+	require.Equal(t, core.Version103, coreMod.Version)
+}
+
+func TestCompileModuleExportOrder(t *testing.T) {
+	exports := func(src string) []core.FuncName {
+		mod, err := parser.Module("<test>", []byte(src))
+		require.NoError(t, err)
+		coreMod, err := New().CompileModule(mod)
+		require.NoError(t, err)
+		return coreMod.Exports
+	}
+	a := exports("module m; func g(x) { return x }; func f() { return 1 }; func f(x) { return x }; func a() { return 0 }")
+	b := exports("module m; func a() { return 0 }; func f(x) { return x }; func g(x) { return x }; func f() { return 1 }")
+	require.Equal(t, a, b)
+	require.Equal(t, []core.FuncName{
+		{Name: "a", Arity: 0}, {Name: "f", Arity: 0}, {Name: "f", Arity: 1}, {Name: "g", Arity: 1},
+		{Name: "module_info", Arity: 0}, {Name: "module_info", Arity: 1},
+	}, a)
+}
+
+func TestCompileModuleExportPos(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m\nfunc f() { return 1 }\n\n  func g(x) { return x }\nfunc _h() { return 2 }"))
+	require.NoError(t, err)
+
+	coreMod, err := New().CompileModule(mod)
+	require.NoError(t, err)
+	require.Len(t, coreMod.ExportPos, 2)
+	require.Equal(t, "<test>:2:1", coreMod.ExportPos[core.FuncName{Name: "f", Arity: 0}].String())
+	require.Equal(t, "<test>:4:3", coreMod.ExportPos[core.FuncName{Name: "g", Arity: 1}].String())
+	require.NotContains(t, coreMod.ExportPos, core.FuncName{Name: "module_info", Arity: 0})
+}
+
+func TestCompileModuleTypeDecl(t *testing.T) {
+	// types are only checked by tooling, so they compile to nothing
+	print := func(src string) string {
+		mod, err := parser.Module("<test>", []byte(src))
+		require.NoError(t, err)
+		compiled, err := New().CompileModule(mod)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		core.NewPrinter(&out).PrintModule(compiled)
+		return out.String()
+	}
+	require.Equal(t,
+		print("module m\nfunc origin() { return {0, 0} }"),
+		print("module m\ntype Point tuple[int, int]\nfunc origin() { return {0, 0} }"))
+}
+
+func TestCompileModuleAnnotationWarnings(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m\n@memoize func f() { return 1 }\n@inline type T int"))
+	require.NoError(t, err)
+
+	c := New()
+	_, err = c.CompileModule(mod)
+	require.NoError(t, err)
+	require.Len(t, c.Warnings(), 2)
+	require.EqualError(t, c.Warnings()[0], "<test>:2:2: unknown annotation @memoize")
+	require.EqualError(t, c.Warnings()[1], "<test>:3:2: annotation @inline has no effect on a type")
+}
+
+func TestCompileModuleWarnings(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module m; func f(x, _y) { return 1 }"))
+	require.NoError(t, err)
+
+	c := New()
+	_, err = c.CompileModule(mod)
+	require.NoError(t, err)
+	require.Len(t, c.Warnings(), 1)
+	require.EqualError(t, c.Warnings()[0], "<test>:1:18: x declared and not used")
+
+	c = New(WerrorMode())
+	_, err = c.CompileModule(mod)
+	require.EqualError(t, err, "<test>:1:18: x declared and not used")
+	require.Len(t, c.Warnings(), 1)
+}
+
+func TestCompileModuleUnreachable(t *testing.T) {
+	tests := []struct {
+		input    string
+		warnings []string
+	}{
+		{
+			input:    "module m; func f() { return 1; a = 2 }",
+			warnings: []string{"<test>:1:32: unreachable statement after return"},
+		},
+		{
+			input:    "module m\nfunc f(x) {\n\treturn case x {\n\t\t_ -> 1\n\t\t0 -> 2\n\t}\n}",
+			warnings: []string{"<test>:5:3: clause cannot match because of earlier clause"},
+		},
+		{
+			input:    "module m\nfunc f([0, x]) { return x }\nfunc f([y, 1]) { return y }\nfunc f([0, z]) { return z }",
+			warnings: []string{"<test>:4:1: clause cannot match because of earlier clause"},
+		},
+		{
+			input:    "module m\nfunc f(x) {\n\treturn case x {\n\t\ty when y > 0 -> 1\n\t\ty -> 2\n\t\t[] -> 3\n\t}\n}",
+			warnings: []string{"<test>:6:3: clause cannot match because of earlier clause"},
+		},
+		{
+			input: "module m\nfunc f(x) {\n\treturn case x {\n\t\t{y, y} -> y\n\t\t{a, _} -> a\n\t}\n}",
+		},
+		{
+			input: "module m; func g() { return 1 }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mod, err := parser.Module("<test>", []byte(tt.input))
+			require.NoError(t, err)
+
+			c := New()
+			_, err = c.CompileModule(mod)
+			require.NoError(t, err)
+			var warnings []string
+			for _, w := range c.Warnings() {
+				warnings = append(warnings, w.Error())
+			}
+			require.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
+
+func TestCheckReachableRepeatedVar(t *testing.T) {
+	// {Y, Y} only matches pairs of equal values, so it doesn't cover {A, B}
+	y, a, b := core.Var{Name: "Y"}, core.Var{Name: "A"}, core.Var{Name: "B"}
+	c := New()
+	var earlier [][]core.Expr
+	c.checkReachable(token.NoPos, core.Clause{Patterns: []core.Expr{core.Tuple{Elements: []core.Expr{y, y}}}}, &earlier)
+	c.checkReachable(token.NoPos, core.Clause{Patterns: []core.Expr{core.Tuple{Elements: []core.Expr{a, b}}}}, &earlier)
+	require.Empty(t, c.Warnings())
+
+	c.checkReachable(token.NoPos, core.Clause{Patterns: []core.Expr{core.Tuple{Elements: []core.Expr{y, a}}}}, &earlier)
+	require.Len(t, c.Warnings(), 1)
+}
+
+func TestCompileModuleConstCondition(t *testing.T) {
+	tests := []struct {
+		input    string
+		warnings []string
+	}{
+		{
+			input:    "module m; func f() { while 1 == 1 {} }",
+			warnings: []string{"<test>:1:28: condition is always true"},
+		},
+		{
+			input:    "module m; const Debug = 'false'; func f(x) { return Debug ? x : 0 }",
+			warnings: []string{"<test>:1:53: condition is always false"},
+		},
+		{
+			input:    "module m; const Max = 10; func f() { return Max * 2 >= 20.0 ? 1 : 2 }",
+			warnings: []string{"<test>:1:45: condition is always true"},
+		},
+		{
+			input:    "module m; const Debug = 'false'; func f(x) { return Debug orelse 1 > 2 ? x : 0 }",
+			warnings: []string{"<test>:1:53: condition is always false"},
+		},
+		{
+			input: "module m; func f(x) { return x > 0 ? 1 : 2 }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mod, err := parser.Module("<test>", []byte(tt.input))
+			require.NoError(t, err)
+
+			c := New()
+			_, err = c.CompileModule(mod)
+			require.NoError(t, err)
+			var warnings []string
+			for _, w := range c.Warnings() {
+				warnings = append(warnings, w.Error())
+			}
+			require.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
+
+func TestCompileModuleBaseFuncs(t *testing.T) {
+	base := []byte(`module base
+func module_info() {
+	return erlang.module_info('{{mod}}')
+}
+
+func version() {
+	return '1.0'
+}`)
+
+	mod, err := parser.Module("<test>", []byte(`module mod; func a() { return 1 }`))
+	require.NoError(t, err)
+
+	compiled, err := New(WithBaseFuncs(base)).CompileModule(mod)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	core.NewPrinter(&out).PrintModule(compiled)
+	g := goldie.New(t)
+	g.Assert(t, "basefuncs.core", out.Bytes())
+}
+
+func TestCompileModuleInline(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module inline
+func double(x) { return x * 2 }
+func quadruple(n) { return double(double(n)) }
+func count(xs) { return case xs { [] -> 0; [_ | t] -> 1 + count(t) } }
+func ping(n) { return pong(n) }
+func pong(n) { return ping(n) }
+func twice(f, x) { return f(f(x)) }
+func apply() { return twice(fn(y) { return y }, 1) }`))
+	require.NoError(t, err)
+
+	compiled, err := New(WithInlineThreshold(8)).CompileModule(mod)
+	require.NoError(t, err)
+	require.NoError(t, core.Validate(compiled))
+
+	var out bytes.Buffer
+	core.NewPrinter(&out).PrintModule(compiled)
+	g := goldie.New(t)
+	g.Assert(t, "inline.core", out.Bytes())
+}
+
+func TestCompileModuleInternsAtoms(t *testing.T) {
+	mod, err := parser.Module("bench.gar", bench.Module(20))
+	require.NoError(t, err)
+
+	print := func(c *Compiler) string {
+		compiled, err := c.CompileModule(mod)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		core.NewPrinter(&out).PrintModule(compiled)
+		return out.String()
+	}
+	interned := New()
+	plain := New()
+	plain.atoms = nil
+	require.Equal(t, print(plain), print(interned))
+	require.Equal(t, print(plain), print(interned), "reusing the atom table")
+	require.Contains(t, interned.atoms, "true")
+}
+
+func TestCompileModuleDottedName(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte("module app.http.server; func f() { return 'ok' }"))
+	require.NoError(t, err)
+
+	compiled, err := New().CompileModule(mod)
+	require.NoError(t, err)
+	require.Equal(t, "app.http.server", compiled.Name)
+
+	var out bytes.Buffer
+	core.NewPrinter(&out).PrintModule(compiled)
+	require.Contains(t, out.String(), "module 'app.http.server' [")
+	require.Contains(t, out.String(), "('app.http.server')", "module_info should use the whole name")
+}
+
+func TestCompileModuleBadBaseFuncs(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module mod; func a() { return 1 }`))
+	require.NoError(t, err)
+
+	_, err = New(WithBaseFuncs([]byte("func"))).CompileModule(mod)
+	require.ErrorContains(t, err, "parse base funcs")
+}
+
 func TestCompileFunc(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -53,6 +1101,27 @@ func TestCompileFunc(t *testing.T) {
 			input:    `func call() { return erlang.module_info('b') }`,
 			expected: "call.core",
 		},
+		{
+			input:    `func sum([h | t]) { return h + sum(t) }`,
+			expected: "sum.core",
+		},
+		{
+			// nil is the empty list
+			input:    `func empty() { return nil }`,
+			expected: "nil.core",
+		},
+		{
+			input:    `func eq(a, b) { return [a == b, a != b, a === b, a !== b] }`,
+			expected: "equality.core",
+		},
+		{
+			input:    `func between(x) when x > 3, x < 10 { return x }`,
+			expected: "guard_and.core",
+		},
+		{
+			input:    `func outside(x) when x < 1; x > 10 { return x }`,
+			expected: "guard_or.core",
+		},
 	}
 
 	for _, test := range tests {
@@ -72,3 +1141,204 @@ func TestCompileFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestPropagateConsts(t *testing.T) {
+	a := core.Var{Name: "A"}
+	tests := []struct {
+		input string
+		body  core.Expr
+	}{
+		{
+			input: "func f() { a = 1; return a }",
+			body:  core.Integer{Value: 1},
+		},
+		{
+			// used twice
+			input: "func f() { a = 1; return {a, a} }",
+			body: core.Let{Vars: []core.Var{a}, Arg: core.Integer{Value: 1}, Body: core.Tuple{
+				Elements: []core.Expr{a, a},
+			}},
+		},
+		{
+			// not a literal, so the call must happen once before the return
+			input: "func f() { a = g(); return a }",
+			body: core.Let{Vars: []core.Var{a}, Arg: core.Application{
+				Func: core.FuncName{Name: "g", Arity: 0},
+			}, Body: a},
+		},
+		{
+			// the parameter of the fun is a different variable
+			input: "func f() { a = 'x'; return {a, fn(a) { return a }} }",
+			body: core.Tuple{Elements: []core.Expr{
+				core.Atom{Value: "x"},
+				core.Func{Parameters: []core.Var{a}, Body: a},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			fn, err := parser.Function([]byte(tt.input))
+			require.NoError(t, err)
+
+			compiled, err := New().CompileFunction(fn)
+			require.NoError(t, err)
+			require.Equal(t, tt.body, compiled.Body)
+		})
+	}
+}
+
+func TestNoOrphanFixtures(t *testing.T) {
+	golden.CheckOrphans(t)
+}
+
+func TestOperatorBIF(t *testing.T) {
+	// the names of Erlang's operators, which are the names of the BIFs in erlang
+	tests := []struct {
+		op   token.Type
+		name string
+	}{
+		{token.Plus, "+"},
+		{token.Minus, "-"},
+		{token.Star, "*"},
+		{token.Slash, "/"},
+		{token.Percent, "rem"},
+		{token.MinusMinus, "--"},
+		{token.EqualEqual, "=="},
+		{token.BangEqual, "/="},
+		{token.EqualEqualEqual, "=:="},
+		{token.BangEqualEqual, "=/="},
+		{token.Less, "<"},
+		{token.LessEqual, "=<"},
+		{token.Greater, ">"},
+		{token.GreaterEqual, ">="},
+		{token.And, "and"},
+		{token.Or, "or"},
+		{token.Not, "not"},
+	}
+	tested := make(map[token.Type]bool)
+	for _, test := range tests {
+		t.Run(test.op.String(), func(t *testing.T) {
+			module, name, ok := operatorBIF(test.op)
+			require.True(t, ok)
+			require.Equal(t, "erlang", module)
+			require.Equal(t, test.name, name)
+		})
+		tested[test.op] = true
+	}
+
+	// every binary operator is a BIF, except the ones that are compiled to a case
+	for op := token.Invalid; op <= token.EOF; op++ {
+		switch {
+		case op == token.AndAlso || op == token.OrElse || op == token.Is:
+			_, _, ok := operatorBIF(op)
+			require.False(t, ok, "%s is not a call", op)
+		case op.IsBinaryOp():
+			require.True(t, tested[op], "%s is missing from the test", op)
+		}
+	}
+}
+
+func TestCompileConstFold(t *testing.T) {
+	var plain Compiler // builds the expected trees without interning
+	tests := []struct {
+		input    string
+		folded   core.Expr
+		unfolded core.Expr
+	}{
+		{
+			input:    "2 + 3",
+			folded:   core.Integer{Value: 5},
+			unfolded: plain.erlangCall("+", core.Integer{Value: 2}, core.Integer{Value: 3}),
+		},
+		{
+			input:    "-(4 % 3)",
+			folded:   core.Integer{Value: -1},
+			unfolded: plain.erlangCall("-", plain.erlangCall("rem", core.Integer{Value: 4}, core.Integer{Value: 3})),
+		},
+		{
+			input:    "1 < 'a'",
+			folded:   core.Atom{Value: "true"},
+			unfolded: plain.erlangCall("<", core.Integer{Value: 1}, core.Atom{Value: "a"}),
+		},
+		{
+			// atoms are ordered alphabetically
+			input:    "'apple' < 'banana'",
+			folded:   core.Atom{Value: "true"},
+			unfolded: plain.erlangCall("<", core.Atom{Value: "apple"}, core.Atom{Value: "banana"}),
+		},
+		{
+			input:    "'b' <= 'ab'",
+			folded:   core.Atom{Value: "false"},
+			unfolded: plain.erlangCall("=<", core.Atom{Value: "b"}, core.Atom{Value: "ab"}),
+		},
+		{
+			// floats and values that can't be computed exactly are left to the runtime
+			input:    "1 / 3",
+			folded:   plain.erlangCall("/", core.Integer{Value: 1}, core.Integer{Value: 3}),
+			unfolded: plain.erlangCall("/", core.Integer{Value: 1}, core.Integer{Value: 3}),
+		},
+		{
+			input:    "9223372036854775807 + 1",
+			folded:   plain.erlangCall("+", core.Integer{Value: math.MaxInt64}, core.Integer{Value: 1}),
+			unfolded: plain.erlangCall("+", core.Integer{Value: math.MaxInt64}, core.Integer{Value: 1}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, file, err := parser.Expression([]byte(tt.input))
+			require.NoError(t, err)
+
+			folded, err := New().CompileExpression(file, expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.folded, folded)
+
+			unfolded, err := New(WithoutConstFold()).CompileExpression(file, expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.unfolded, unfolded)
+		})
+	}
+}
+
+func TestCompileExpression(t *testing.T) {
+	expr, err := Expression([]byte("1 + 2 * 3"))
+	require.NoError(t, err)
+	require.Equal(t, core.Integer{Value: 7}, expr)
+
+	expr, err = Expression([]byte("1 + 2 * n"))
+	require.NoError(t, err)
+	require.Equal(t, core.InterModuleCall{
+		Module: core.Atom{Value: "erlang"},
+		Func:   core.Atom{Value: "+"},
+		Args: []core.Expr{
+			core.Integer{Value: 1},
+			core.InterModuleCall{
+				Module: core.Atom{Value: "erlang"},
+				Func:   core.Atom{Value: "*"},
+				Args:   []core.Expr{core.Integer{Value: 2}, core.Var{Name: "N"}},
+			},
+		},
+	}, expr)
+
+	// free variables are bound by the shell
+	expr, err = Expression([]byte("lists.map(fn(x) { return x * n }, xs)\n"))
+	require.NoError(t, err)
+	require.IsType(t, core.InterModuleCall{}, expr)
+
+	_, err = Expression([]byte("1 + 2 3"))
+	require.EqualError(t, err, "<string>:1:7: unexpected 3 after expression")
+	var perr parser.Error
+	require.ErrorAs(t, err, &perr)
+
+	_, err = Expression([]byte("receive { after 1.5 -> 'ok' }"))
+	require.EqualError(t, err, "<string>:1:17: receive timeout must be an integer or 'infinity'")
+
+	// warnings have positions too
+	parsed, file, err := parser.Expression([]byte("fn(y) { return 1 }"))
+	require.NoError(t, err)
+	c := New()
+	_, err = c.CompileExpression(file, parsed)
+	require.NoError(t, err)
+	require.Len(t, c.Warnings(), 1)
+	require.EqualError(t, c.Warnings()[0], "<string>:1:4: y declared and not used")
+}
@@ -0,0 +1,295 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/core"
+	"github.com/masp/garlang/token"
+)
+
+// atom is the value of a folded atom, to tell it apart from a string.
+type atom string
+
+// checkCondition warns if cond always evaluates to the same boolean, which usually means
+// the condition is wrong.
+func (c *Compiler) checkCondition(cond ast.Expression) {
+	if v, ok := c.foldConst(cond, nil); ok && (v == atom("true") || v == atom("false")) {
+		c.warnf(cond.Pos(), "condition is always %s", v)
+	}
+}
+
+// foldLiteral compiles expr to its value if it is constant, like 5 for `2 + 3`, unless
+// folding is disabled with WithoutConstFold. Only integers and atoms are folded: floats
+// are printed rounded, so they are computed at run time to keep their precision.
+func (c *Compiler) foldLiteral(expr ast.Expression) (core.Expr, bool) {
+	if c.noFold || len(c.inlining) > 0 {
+		// the parameters of an inlined guard may have the names of constants
+		return nil, false
+	}
+	v, ok := c.foldConst(expr, nil)
+	if !ok {
+		return nil, false
+	}
+	switch v := v.(type) {
+	case int64:
+		return core.Integer{Value: v}, true
+	case atom:
+		return c.atom(string(v)), true
+	}
+	return nil, false
+}
+
+// foldConst evaluates expr if it only uses literals, constants, and operators and type
+// tests on them. The value is an int64, float64 or atom, and ok is false if expr is not
+// constant or can't be folded exactly, like an integer that overflows. seen holds the
+// constants being folded, so that a constant defined in terms of itself is not folded.
+func (c *Compiler) foldConst(expr ast.Expression, seen map[string]bool) (v any, ok bool) {
+	switch expr := expr.(type) {
+	case *ast.IntLiteral:
+		return expr.Value, true
+	case *ast.FloatLiteral:
+		return expr.Value, true
+	case *ast.AtomLiteral:
+		if expr.Value == moduleNameAtom {
+			return atom(c.module), true
+		}
+		return atom(expr.Value), true
+	case *ast.ParenExpr:
+		return c.foldConst(expr.Expression, seen)
+	case *ast.Identifier:
+		decl, ok := c.consts[expr.Name]
+		if !ok || c.bound[expr.Name] || seen[expr.Name] {
+			return nil, false
+		}
+		inner := map[string]bool{expr.Name: true}
+		for name := range seen {
+			inner[name] = true
+		}
+		return c.foldConst(decl.Value, inner)
+	case *ast.UnaryExpr:
+		x, ok := c.foldConst(expr.Right, seen)
+		if !ok {
+			return nil, false
+		}
+		switch x := x.(type) {
+		case int64:
+			switch expr.Op {
+			case token.Minus:
+				if x == math.MinInt64 {
+					return nil, false
+				}
+				return -x, true
+			case token.Plus:
+				return x, true
+			}
+		case float64:
+			switch expr.Op {
+			case token.Minus:
+				return -x, true
+			case token.Plus:
+				return x, true
+			}
+		case atom:
+			if expr.Op == token.Not && (x == "true" || x == "false") {
+				return boolAtom(x == "false"), true
+			}
+		}
+		return nil, false
+	case *ast.TypeTestExpr:
+		// a folded value is an integer, a float or an atom, so it is never a list or tuple
+		ident, ok := expr.Type.(*ast.Identifier)
+		if !ok || typeTests[ident.Name] == "" {
+			return nil, false
+		}
+		x, ok := c.foldConst(expr.X, seen)
+		if !ok {
+			return nil, false
+		}
+		switch x.(type) {
+		case int64:
+			return boolAtom(ident.Name == "int"), true
+		case float64:
+			return boolAtom(ident.Name == "float"), true
+		case atom:
+			return boolAtom(ident.Name == "atom"), true
+		}
+		return nil, false
+	case *ast.BinaryExpr:
+		x, ok := c.foldConst(expr.Left, seen)
+		if !ok {
+			return nil, false
+		}
+		y, ok := c.foldConst(expr.Right, seen)
+		if !ok {
+			return nil, false
+		}
+		return foldBinary(expr.Op, x, y)
+	}
+	return nil, false
+}
+
+// foldBinary applies op to the folded values x and y like Erlang would.
+func foldBinary(op token.Type, x, y any) (any, bool) {
+	switch op {
+	case token.EqualEqual, token.BangEqual, token.EqualEqualEqual, token.BangEqualEqual:
+		eq := equal(x, y, op == token.EqualEqualEqual || op == token.BangEqualEqual)
+		if op == token.BangEqual || op == token.BangEqualEqual {
+			eq = !eq
+		}
+		return boolAtom(eq), true
+	case token.Less, token.LessEqual, token.Greater, token.GreaterEqual:
+		cmp := compare(x, y)
+		switch op {
+		case token.Less:
+			return boolAtom(cmp < 0), true
+		case token.LessEqual:
+			return boolAtom(cmp <= 0), true
+		case token.Greater:
+			return boolAtom(cmp > 0), true
+		default:
+			return boolAtom(cmp >= 0), true
+		}
+	case token.And, token.AndAlso, token.Or, token.OrElse:
+		a, aok := x.(atom)
+		b, bok := y.(atom)
+		if !aok || !bok || (a != "true" && a != "false") || (b != "true" && b != "false") {
+			return nil, false
+		}
+		if op == token.And || op == token.AndAlso {
+			return boolAtom(a == "true" && b == "true"), true
+		}
+		return boolAtom(a == "true" || b == "true"), true
+	}
+
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok {
+			return foldInt(op, a, b)
+		}
+	}
+	a, aok := toFloat(x)
+	b, bok := toFloat(y)
+	if !aok || !bok {
+		return nil, false
+	}
+	switch op {
+	case token.Plus:
+		return a + b, true
+	case token.Minus:
+		return a - b, true
+	case token.Star:
+		return a * b, true
+	case token.Slash:
+		if b == 0 {
+			return nil, false
+		}
+		return a / b, true
+	}
+	return nil, false // rem is only defined on integers
+}
+
+// foldInt applies the arithmetic operator op to a and b. Erlang integers never
+// overflow, so results that don't fit in an int64 are not folded.
+func foldInt(op token.Type, a, b int64) (any, bool) {
+	switch op {
+	case token.Plus:
+		if r := a + b; (r > a) == (b > 0) {
+			return r, true
+		}
+	case token.Minus:
+		if r := a - b; (r < a) == (b > 0) {
+			return r, true
+		}
+	case token.Star:
+		if a == 0 || b == 0 {
+			return int64(0), true
+		}
+		if r := a * b; r/b == a && !(b == -1 && a == math.MinInt64) {
+			return r, true
+		}
+	case token.Slash:
+		if b != 0 {
+			return float64(a) / float64(b), true
+		}
+	case token.Percent:
+		if b != 0 && !(a == math.MinInt64 && b == -1) {
+			return a % b, true
+		}
+	}
+	return nil, false
+}
+
+// equal compares x and y with == or, if exact, with =:=, which doesn't treat an integer
+// and a float with the same value as equal.
+func equal(x, y any, exact bool) bool {
+	if exact {
+		return x == y
+	}
+	if _, ok := x.(int64); ok {
+		if _, ok := y.(int64); ok {
+			return x == y
+		}
+	}
+	if a, ok := toFloat(x); ok {
+		if b, ok := toFloat(y); ok {
+			return a == b
+		}
+	}
+	return x == y
+}
+
+// compare orders x and y like Erlang's term order, where numbers are smaller than atoms.
+func compare(x, y any) int {
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	}
+	a, aNum := toFloat(x)
+	b, bNum := toFloat(y)
+	switch {
+	case aNum && bNum:
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	s, t := x.(atom), y.(atom)
+	switch {
+	case s < t:
+		return -1
+	case s > t:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func boolAtom(b bool) atom {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,120 @@
+package compiler
+
+import "github.com/masp/garlang/core"
+
+// inlineCalls replaces the calls of small local functions in mod with their bodies,
+// binding the arguments to the parameters with let:
+//
+//	apply 'double'/1(N)  =>  let <X> = N in call 'erlang':'*'(X, 2)
+//
+// A function is small if its body has at most threshold expressions. Recursive
+// functions, including ones that call themselves through other functions, are never
+// inlined, and neither are bodies with letrec, since the functions they define could
+// shadow the caller's. The inlined functions are kept since they may be exported or
+// referenced with f/N.
+func inlineCalls(mod *core.Module, threshold int) {
+	if threshold <= 0 {
+		return
+	}
+	bodies := make(map[core.FuncName]core.Func)
+	calls := make(map[core.FuncName][]core.FuncName)
+	for _, fn := range mod.Functions {
+		bodies[fn.Name] = fn
+		calls[fn.Name] = funcRefs(fn.Body, nil)
+	}
+	small := make(map[core.FuncName]core.Func)
+	for _, fn := range mod.Functions {
+		if exprSize(fn.Body) <= threshold && !hasLetRec(fn.Body) && !recursive(fn.Name, calls) {
+			small[fn.Name] = fn
+		}
+	}
+	if len(small) == 0 {
+		return
+	}
+
+	var inline func(expr core.Expr) core.Expr
+	inline = func(expr core.Expr) core.Expr {
+		expr = mapExprs(expr, inline)
+		app, ok := expr.(core.Application)
+		if !ok {
+			return expr
+		}
+		name, ok := app.Func.(core.FuncName)
+		if !ok {
+			return expr
+		}
+		callee, ok := small[name]
+		if !ok || len(callee.Parameters) != len(app.Args) {
+			return expr
+		}
+		switch len(app.Args) {
+		case 0:
+			return callee.Body
+		case 1:
+			return core.Let{Vars: callee.Parameters, Arg: app.Args[0], Body: callee.Body}
+		default:
+			return core.Let{Vars: callee.Parameters, Arg: core.Values{Elements: app.Args}, Body: callee.Body}
+		}
+	}
+	for i, fn := range mod.Functions {
+		// the calls are replaced with the original bodies, so a body is inlined only once
+		// however the functions call each other
+		fn.Body = propagateConsts(inline(bodies[fn.Name].Body))
+		mod.Functions[i] = fn
+	}
+}
+
+// recursive reports whether fn can call itself through the local calls in calls.
+func recursive(fn core.FuncName, calls map[core.FuncName][]core.FuncName) bool {
+	seen := make(map[core.FuncName]bool)
+	var reaches func(from core.FuncName) bool
+	reaches = func(from core.FuncName) bool {
+		for _, to := range calls[from] {
+			if to == fn {
+				return true
+			}
+			if !seen[to] {
+				seen[to] = true
+				if reaches(to) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return reaches(fn)
+}
+
+// funcRefs appends the local functions expr calls or references to refs.
+func funcRefs(expr core.Expr, refs []core.FuncName) []core.FuncName {
+	if name, ok := expr.(core.FuncName); ok {
+		return append(refs, name)
+	}
+	mapExprs(expr, func(e core.Expr) core.Expr {
+		refs = funcRefs(e, refs)
+		return e
+	})
+	return refs
+}
+
+// exprSize returns the number of expressions in expr, not counting patterns.
+func exprSize(expr core.Expr) int {
+	size := 1
+	mapExprs(expr, func(e core.Expr) core.Expr {
+		size += exprSize(e)
+		return e
+	})
+	return size
+}
+
+func hasLetRec(expr core.Expr) bool {
+	if _, ok := expr.(core.LetRec); ok {
+		return true
+	}
+	found := false
+	mapExprs(expr, func(e core.Expr) core.Expr {
+		found = found || hasLetRec(e)
+		return e
+	})
+	return found
+}
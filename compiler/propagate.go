@@ -0,0 +1,224 @@
+package compiler
+
+import "github.com/masp/garlang/core"
+
+// propagateConsts substitutes literals for the variables bound to them with let when the
+// variable is used exactly once, dropping the let:
+//
+//	let <A> = 1 in call 'erlang':'+'(A, B)  =>  call 'erlang':'+'(1, B)
+//
+// Only literals are propagated since they have no side effects and evaluating them later
+// can't be observed. Variables used more than once are kept so the output doesn't grow.
+func propagateConsts(expr core.Expr) core.Expr {
+	if let, ok := expr.(core.Let); ok && len(let.Vars) == 1 {
+		if _, ok := let.Arg.(core.Literal); ok {
+			body := propagateConsts(let.Body)
+			s := substitution{v: let.Vars[0], lit: let.Arg}
+			if replaced := s.expr(body); s.uses == 1 && !s.callee {
+				return replaced
+			}
+			let.Body = body
+			return let
+		}
+	}
+	return mapExprs(expr, propagateConsts)
+}
+
+// substitution replaces the uses of a variable with a literal.
+type substitution struct {
+	v      core.Var
+	lit    core.Expr
+	uses   int  // number of uses of v replaced
+	callee bool // v is applied as a function, where a literal is not allowed
+}
+
+func (s *substitution) expr(expr core.Expr) core.Expr {
+	switch e := expr.(type) {
+	case core.Var:
+		if e == s.v {
+			s.uses++
+			return s.lit
+		}
+		return e
+	case core.Application:
+		if e.Func == s.v {
+			s.callee = true
+		}
+	case core.Let:
+		e.Arg = s.expr(e.Arg)
+		if !bindsVar(e.Vars, s.v) {
+			e.Body = s.expr(e.Body)
+		}
+		return e
+	case core.Func:
+		if bindsVar(e.Parameters, s.v) {
+			return e
+		}
+	case core.Try:
+		e.Arg = s.expr(e.Arg)
+		if !bindsVar(e.Vars, s.v) {
+			e.Body = s.expr(e.Body)
+		}
+		if !bindsVar(e.CatchVars, s.v) {
+			e.Handler = s.expr(e.Handler)
+		}
+		return e
+	case core.Case:
+		e.Arg = s.expr(e.Arg)
+		e.Clauses = s.clauses(e.Clauses)
+		return e
+	case core.Receive:
+		e.Clauses = s.clauses(e.Clauses)
+		e.Timeout = s.expr(e.Timeout)
+		e.Action = s.expr(e.Action)
+		return e
+	}
+	return mapExprs(expr, s.expr)
+}
+
+// clauses substitutes in the guards and bodies of the clauses whose patterns don't bind
+// the variable again.
+func (s *substitution) clauses(clauses []core.Clause) []core.Clause {
+	substituted := make([]core.Clause, len(clauses))
+	for i, clause := range clauses {
+		if !patternsBind(clause.Patterns, s.v) {
+			if clause.Guard != nil {
+				clause.Guard = s.expr(clause.Guard)
+			}
+			clause.Body = s.expr(clause.Body)
+		}
+		substituted[i] = clause
+	}
+	return substituted
+}
+
+// mapExprs returns a copy of expr with f applied to each of the expressions directly
+// inside it. Patterns are left as they are.
+func mapExprs(expr core.Expr, f func(core.Expr) core.Expr) core.Expr {
+	each := func(exprs []core.Expr) []core.Expr {
+		if exprs == nil {
+			return nil
+		}
+		mapped := make([]core.Expr, len(exprs))
+		for i, expr := range exprs {
+			mapped[i] = f(expr)
+		}
+		return mapped
+	}
+
+	switch e := expr.(type) {
+	case core.Application:
+		e.Func = f(e.Func)
+		e.Args = each(e.Args)
+		return e
+	case core.InterModuleCall:
+		e.Module = f(e.Module)
+		e.Func = f(e.Func)
+		e.Args = each(e.Args)
+		return e
+	case core.Let:
+		e.Arg = f(e.Arg)
+		e.Body = f(e.Body)
+		return e
+	case core.LetRec:
+		funcs := make([]core.Func, len(e.Funcs))
+		for i, fn := range e.Funcs {
+			funcs[i] = f(fn).(core.Func)
+		}
+		e.Funcs = funcs
+		e.Body = f(e.Body)
+		return e
+	case core.Seq:
+		e.First = f(e.First)
+		e.Second = f(e.Second)
+		return e
+	case core.Catch:
+		e.Body = f(e.Body)
+		return e
+	case core.Try:
+		e.Arg = f(e.Arg)
+		e.Body = f(e.Body)
+		e.Handler = f(e.Handler)
+		return e
+	case core.Case:
+		e.Arg = f(e.Arg)
+		e.Clauses = mapClauses(e.Clauses, f)
+		return e
+	case core.Receive:
+		e.Clauses = mapClauses(e.Clauses, f)
+		e.Timeout = f(e.Timeout)
+		e.Action = f(e.Action)
+		return e
+	case core.Func:
+		e.Body = f(e.Body)
+		return e
+	case core.PrimOp:
+		e.Args = each(e.Args)
+		return e
+	case core.Values:
+		e.Elements = each(e.Elements)
+		return e
+	case core.Tuple:
+		e.Elements = each(e.Elements)
+		return e
+	case core.Map:
+		pairs := make([]core.MapPair, len(e.Pairs))
+		for i, pair := range e.Pairs {
+			pairs[i] = core.MapPair{Key: f(pair.Key), Value: f(pair.Value)}
+		}
+		e.Pairs = pairs
+		return e
+	case core.Cons:
+		e.Head = f(e.Head)
+		e.Tail = f(e.Tail)
+		return e
+	}
+	return expr
+}
+
+// mapClauses returns a copy of clauses with f applied to each guard and body.
+func mapClauses(clauses []core.Clause, f func(core.Expr) core.Expr) []core.Clause {
+	mapped := make([]core.Clause, len(clauses))
+	for i, clause := range clauses {
+		if clause.Guard != nil {
+			clause.Guard = f(clause.Guard)
+		}
+		clause.Body = f(clause.Body)
+		mapped[i] = clause
+	}
+	return mapped
+}
+
+func bindsVar(vars []core.Var, v core.Var) bool {
+	for _, bound := range vars {
+		if bound == v {
+			return true
+		}
+	}
+	return false
+}
+
+// patternsBind reports whether any of the patterns binds v.
+func patternsBind(patterns []core.Expr, v core.Var) bool {
+	for _, pat := range patterns {
+		switch pat := pat.(type) {
+		case core.Var:
+			if pat == v {
+				return true
+			}
+		case core.Tuple:
+			if patternsBind(pat.Elements, v) {
+				return true
+			}
+		case core.Cons:
+			if patternsBind([]core.Expr{pat.Head, pat.Tail}, v) {
+				return true
+			}
+		case core.Alias:
+			if patternsBind([]core.Expr{pat.Var, pat.Pattern}, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
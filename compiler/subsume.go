@@ -0,0 +1,82 @@
+package compiler
+
+import (
+	"github.com/masp/garlang/core"
+	"github.com/masp/garlang/token"
+)
+
+// checkReachable warns if clause can never be selected because an earlier clause without
+// a guard matches every value it matches, like a clause after a catch-all or a second
+// clause with the same patterns. earlier holds the patterns of the earlier clauses that
+// have no guard; the patterns of clause are added to it if clause has no guard either.
+func (c *Compiler) checkReachable(pos token.Pos, clause core.Clause, earlier *[][]core.Expr) {
+	for _, patterns := range *earlier {
+		if subsumesAll(patterns, clause.Patterns, countVars(patterns, nil)) {
+			c.warnf(pos, "clause cannot match because of earlier clause")
+			break
+		}
+	}
+	if clause.Guard == nil {
+		*earlier = append(*earlier, clause.Patterns)
+	}
+}
+
+// countVars adds the number of times each variable occurs in patterns to counts, which
+// is allocated if nil, and returns it.
+func countVars(patterns []core.Expr, counts map[string]int) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	for _, p := range patterns {
+		switch p := p.(type) {
+		case core.Var:
+			counts[p.Name]++
+		case core.Alias:
+			counts[p.Var.Name]++
+			countVars([]core.Expr{p.Pattern}, counts)
+		case core.Tuple:
+			countVars(p.Elements, counts)
+		case core.Cons:
+			countVars([]core.Expr{p.Head, p.Tail}, counts)
+		}
+	}
+	return counts
+}
+
+func subsumesAll(as, bs []core.Expr, vars map[string]int) bool {
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if !subsumes(as[i], bs[i], vars) {
+			return false
+		}
+	}
+	return true
+}
+
+// subsumes reports whether pattern a matches every value that pattern b matches. vars
+// counts the variables of the patterns a is part of, since a variable that occurs more
+// than once must match the same value each time and so is not a catch-all. It is
+// conservative: false means a might not match everything b does.
+func subsumes(a, b core.Expr, vars map[string]int) bool {
+	if alias, ok := b.(core.Alias); ok {
+		b = alias.Pattern
+	}
+	switch a := a.(type) {
+	case core.Var:
+		return vars[a.Name] == 1
+	case core.Alias:
+		return subsumes(a.Pattern, b, vars)
+	case core.Tuple:
+		t, ok := b.(core.Tuple)
+		return ok && subsumesAll(a.Elements, t.Elements, vars)
+	case core.Cons:
+		cons, ok := b.(core.Cons)
+		return ok && subsumes(a.Head, cons.Head, vars) && subsumes(a.Tail, cons.Tail, vars)
+	case core.Atom, core.Integer, core.Float, core.Char, core.String, core.Nil:
+		return a == b
+	default:
+		return false
+	}
+}
@@ -1,7 +1,11 @@
 // Package core provides Go structs representing Erlang Core AST.
 package core
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/masp/garlang/token"
+)
 
 // The definition of the Erlang core is defined at https://www.it.uu.se/research/group/hipe/cerl/doc/core_erlang-1.0.3.pdf
 //
@@ -43,8 +47,35 @@ type Module struct {
 	Exports    []FuncName
 	Attributes []Attribute
 	Functions  []Func
+
+	// ExportPos is where each export is declared in the source, so diagnostics about an
+	// export can point back to it. It is nil or has no entry for exports with no source,
+	// like the functions injected into every module. It is not printed.
+	ExportPos map[FuncName]token.Position
+
+	// FuncPos is where each function is declared in the source, so Validate can say where
+	// a problem in a function is. Like ExportPos, it has no entry for functions with no
+	// source. It is not printed.
+	FuncPos map[FuncName]token.Position
+
+	// Version is the Core Erlang syntax the module is printed in, or the latest if zero.
+	Version Version
 }
 
+// Version is a version of the Core Erlang syntax, which grew with the features of Erlang.
+type Version int
+
+const (
+	// Version103 is Core Erlang 1.0.3 as specified, from before Erlang had maps. A map is
+	// built at run time with maps:from_list/1, so tools that only read the specified
+	// syntax can read the output.
+	Version103 Version = iota + 1
+
+	// VersionOTP17 is Core Erlang as of OTP 17, which writes maps as ~{K=>V}~. It is the
+	// latest version.
+	VersionOTP17
+)
+
 type FuncName struct {
 	Name  string
 	Arity int
@@ -53,7 +84,7 @@ type FuncName struct {
 func (FuncName) isConst() {}
 func (FuncName) isExpr()  {}
 func (f FuncName) String() string {
-	return fmt.Sprintf("'%s'/%d", f.Name, f.Arity)
+	return fmt.Sprintf("'%s'/%d", EscapeAtom(f.Name), f.Arity)
 }
 
 type Attribute struct {
@@ -81,6 +112,129 @@ type InterModuleCall struct {
 
 func (InterModuleCall) isExpr() {}
 
+// let vars = exprs1 in exprs2
+type Let struct {
+	Vars []Var
+	Arg  Expr
+	Body Expr
+}
+
+func (Let) isExpr() {}
+
+// letrec fname1 = fun1 · · · fnamen = funn in exprs
+type LetRec struct {
+	Funcs []Func // may call each other and themselves
+	Body  Expr
+}
+
+func (LetRec) isExpr() {}
+
+// do exprs1 exprs2
+type Seq struct {
+	First  Expr // evaluated only for its side effects
+	Second Expr
+}
+
+func (Seq) isExpr() {}
+
+// catch exprs
+type Catch struct {
+	Body Expr // an exception raised by Body is returned as a value
+}
+
+func (Catch) isExpr() {}
+
+// try exprs1 of <vars1> -> exprs2 catch <vars2> -> exprs3
+type Try struct {
+	Arg       Expr
+	Vars      []Var // bound to the value of Arg in Body
+	Body      Expr
+	CatchVars []Var // bound to the class, reason and stacktrace of an exception raised by Arg
+	Handler   Expr
+}
+
+func (Try) isExpr() {}
+
+// case exprs of clause1 · · · clausen end
+type Case struct {
+	Arg     Expr
+	Clauses []Clause
+}
+
+func (Case) isExpr() {}
+
+// receive clause1 · · · clausen after exprs1 -> exprs2
+type Receive struct {
+	Clauses []Clause // one pattern each, matched against the message
+	Timeout Expr     // milliseconds to wait for a message, or 'infinity'
+	Action  Expr     // evaluated if no message matched before the timeout
+}
+
+func (Receive) isExpr() {}
+
+// pats when exprs1 -> exprs2
+type Clause struct {
+	Patterns []Expr // one pattern per value in the case argument
+	Guard    Expr   // 'true' if nil
+	Body     Expr
+}
+
+// primop Atom(exprs1, . . ., exprsn)
+type PrimOp struct {
+	Name Atom
+	Args []Expr
+}
+
+func (PrimOp) isExpr() {}
+
+// ~{ key1 => value1, . . ., keyn => valuen }~
+type Map struct {
+	Pairs []MapPair
+}
+
+func (Map) isExpr() {}
+
+type MapPair struct {
+	Key, Value Expr
+}
+
+// < expr1, . . ., exprn >
+type Values struct {
+	Elements []Expr
+}
+
+func (Values) isExpr() {}
+
+// { exprs1, . . ., exprsn }
+type Tuple struct {
+	Elements []Expr
+}
+
+func (Tuple) isExpr() {}
+
+// [ exprs1 | exprs2 ]
+type Cons struct {
+	Head Expr
+	Tail Expr
+}
+
+func (Cons) isExpr() {}
+
+// var = pat, a pattern that binds Var to the whole value matched by Pattern
+type Alias struct {
+	Var     Var
+	Pattern Expr
+}
+
+func (Alias) isExpr() {}
+
+// Nil is the empty list [].
+type Nil struct{}
+
+func (Nil) isLiteral() {}
+func (Nil) isConst()   {}
+func (Nil) isExpr()    {}
+
 type Func struct {
 	Name       FuncName
 	Parameters []Var
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reserved are the Erlang keywords, which must be quoted to be used as atoms.
+var reserved = map[string]bool{
+	"after": true, "and": true, "andalso": true, "band": true, "begin": true, "bnot": true,
+	"bor": true, "bsl": true, "bsr": true, "bxor": true, "case": true, "catch": true,
+	"cond": true, "div": true, "else": true, "end": true, "fun": true, "if": true,
+	"let": true, "maybe": true, "not": true, "of": true, "or": true, "orelse": true,
+	"receive": true, "rem": true, "try": true, "when": true, "xor": true,
+}
+
+// QuoteAtom returns s written as an Erlang atom. Like in Erlang, atoms that start with a
+// lowercase letter and only contain letters, digits, '_' and '@' are left bare, and all
+// others are quoted and escaped: hello, 'hello world', 'it\'s'.
+//
+// Core Erlang always quotes atoms, so the printer uses EscapeAtom instead.
+func QuoteAtom(s string) string {
+	if isBareAtom(s) {
+		return s
+	}
+	return "'" + EscapeAtom(s) + "'"
+}
+
+func isBareAtom(s string) bool {
+	if s == "" || s[0] < 'a' || s[0] > 'z' || reserved[s] {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// EscapeAtom escapes s to be written between single quotes. Quotes and backslashes are
+// escaped with a backslash and control characters with their escape sequence.
+func EscapeAtom(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case 0x1b:
+			b.WriteString(`\e`)
+		case 0x7f:
+			b.WriteString(`\d`)
+		default:
+			if r < ' ' {
+				fmt.Fprintf(&b, `\%03o`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteAtom(t *testing.T) {
+	tests := []struct {
+		atom string
+		want string
+	}{
+		{atom: "hello", want: "hello"},
+		{atom: "node@host_1", want: "node@host_1"},
+		{atom: "hello world", want: "'hello world'"},
+		{atom: "Hello", want: "'Hello'"},
+		{atom: "_x", want: "'_x'"},
+		{atom: "", want: "''"},
+		{atom: "case", want: "'case'"},
+		{atom: "it's", want: `'it\'s'`},
+		{atom: `a\b`, want: `'a\\b'`},
+		{atom: "line\nbreak", want: `'line\nbreak'`},
+		{atom: "bell\a", want: `'bell\007'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.atom, func(t *testing.T) {
+			require.Equal(t, tt.want, QuoteAtom(tt.atom))
+		})
+	}
+}
+
+func TestPrintEscapedAtom(t *testing.T) {
+	var out bytes.Buffer
+	NewPrinter(&out).emitExpr(Atom{Value: "it's"})
+	require.Equal(t, `'it\'s'`, out.String())
+}
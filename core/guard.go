@@ -0,0 +1,20 @@
+package core
+
+// guardBIFs are the functions of the erlang module that may be called in a guard. Like
+// the other guard tests, they have no side effects and can't block.
+var guardBIFs = map[string]bool{
+	"abs": true, "bit_size": true, "byte_size": true, "ceil": true, "element": true,
+	"float": true, "floor": true, "hd": true, "is_atom": true, "is_binary": true,
+	"is_bitstring": true, "is_boolean": true, "is_float": true, "is_function": true,
+	"is_integer": true, "is_list": true, "is_map": true, "is_map_key": true,
+	"is_number": true, "is_pid": true, "is_port": true, "is_record": true,
+	"is_reference": true, "is_tuple": true, "length": true, "map_get": true,
+	"map_size": true, "max": true, "min": true, "node": true, "round": true, "self": true,
+	"size": true, "tl": true, "trunc": true, "tuple_size": true,
+}
+
+// IsGuardBIF reports whether the function of the erlang module called name may be
+// called in a guard, like is_list or length.
+func IsGuardBIF(name string) bool {
+	return guardBIFs[name]
+}
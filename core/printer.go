@@ -18,6 +18,7 @@ func NewPrinter(w io.Writer) *Printer {
 type Printer struct {
 	Output                 io.Writer
 	indentSize, currIndent int
+	version                Version // of the module being printed
 }
 
 func (c *Printer) indent() {
@@ -38,7 +39,9 @@ func (c *Printer) emitf(format string, args ...interface{}) {
 }
 
 func (c *Printer) PrintModule(mod *Module) {
-	c.emitf("module '%s' [", mod.Name)
+	c.version = mod.Version
+	defer func() { c.version = 0 }()
+	c.emitf("module '%s' [", EscapeAtom(mod.Name))
 	for i, fn := range mod.Exports {
 		if i > 0 {
 			c.emitf(",")
@@ -75,7 +78,7 @@ func (c *Printer) emitAttrs(attrs []Attribute) {
 }
 
 func (c *Printer) emitAttr(attr Attribute) {
-	c.emitf("'%s' =", attr.Key.Value)
+	c.emitf("'%s' =", EscapeAtom(attr.Key.Value))
 	c.indent()
 	c.emitln()
 	c.emitConst(attr.Value)
@@ -171,11 +174,60 @@ func (c *Printer) emitExpr(expr Expr) {
 		c.emitInterModuleCall(expr)
 	case Application:
 		c.emitApplication(expr)
+	case PrimOp:
+		c.emitPrimOp(expr)
+	case Case:
+		c.emitCase(expr)
+	case Receive:
+		c.emitReceive(expr)
+	case Let:
+		c.emitLet(expr)
+	case LetRec:
+		c.emitLetRec(expr)
+	case Seq:
+		c.emitSeq(expr)
+	case Catch:
+		c.emitf("catch")
+		c.indent()
+		c.emitln()
+		c.emitExpr(expr.Body)
+		c.dedent()
+	case Try:
+		c.emitTry(expr)
+	case Map:
+		c.emitMap(expr)
+	case Values:
+		c.emitf("<")
+		c.emitExprList(expr.Elements)
+		c.emitf(">")
+	case Tuple:
+		c.emitf("{")
+		c.emitExprList(expr.Elements)
+		c.emitf("}")
+	case Cons:
+		c.emitf("[")
+		c.emitExpr(expr.Head)
+		c.emitf("|")
+		c.emitExpr(expr.Tail)
+		c.emitf("]")
+	case Alias:
+		c.emitExpr(expr.Var)
+		c.emitf(" = ")
+		c.emitExpr(expr.Pattern)
 	default:
 		panic(fmt.Sprintf("unknown expression type %T", expr))
 	}
 }
 
+func (c *Printer) emitExprList(exprs []Expr) {
+	for i, expr := range exprs {
+		if i > 0 {
+			c.emitf(",")
+		}
+		c.emitExpr(expr)
+	}
+}
+
 func (c *Printer) emitLiteral(lit Literal) {
 	switch lit := lit.(type) {
 	case Integer:
@@ -183,9 +235,11 @@ func (c *Printer) emitLiteral(lit Literal) {
 	case Float:
 		c.emitf("%f", lit.Value)
 	case Atom:
-		c.emitf("'%s'", lit.Value)
+		c.emitf("'%s'", EscapeAtom(lit.Value))
 	case String:
 		c.emitf("\"%s\"", lit.Value)
+	case Nil:
+		c.emitf("[]")
 	default:
 		panic(fmt.Sprintf("unknown literal type %T", lit))
 	}
@@ -224,3 +278,162 @@ func (c *Printer) emitApplication(app Application) {
 	c.emitf(")")
 	c.dedent()
 }
+
+func (c *Printer) emitPrimOp(op PrimOp) {
+	c.emitf("primop ")
+	c.emitLiteral(op.Name)
+	c.emitf("(")
+	c.emitExprList(op.Args)
+	c.emitf(")")
+}
+
+func (c *Printer) emitLet(let Let) {
+	c.emitf("let <")
+	for i, v := range let.Vars {
+		if i > 0 {
+			c.emitf(",")
+		}
+		c.emitf("%s", v.Name)
+	}
+	c.emitf("> =")
+	c.indent()
+	c.emitln()
+	c.emitExpr(let.Arg)
+	c.dedent()
+	c.emitln()
+	c.emitf("in ")
+	c.emitExpr(let.Body)
+}
+
+func (c *Printer) emitLetRec(letrec LetRec) {
+	c.emitf("letrec")
+	c.indent()
+	for _, fn := range letrec.Funcs {
+		c.emitln()
+		c.emitFnHeader(fn)
+		c.emitFn(fn)
+		c.dedent()
+	}
+	c.dedent()
+	c.emitln()
+	c.emitf("in ")
+	c.emitExpr(letrec.Body)
+}
+
+func (c *Printer) emitSeq(seq Seq) {
+	c.emitf("do")
+	c.indent()
+	c.emitln()
+	c.emitExpr(seq.First)
+	c.dedent()
+	c.emitln()
+	c.emitExpr(seq.Second)
+}
+
+func (c *Printer) emitTry(try Try) {
+	c.emitf("try")
+	c.indent()
+	c.emitln()
+	c.emitExpr(try.Arg)
+	c.dedent()
+	c.emitln()
+	c.emitf("of ")
+	c.emitVars(try.Vars)
+	c.emitf(" ->")
+	c.indent()
+	c.emitln()
+	c.emitExpr(try.Body)
+	c.dedent()
+	c.emitln()
+	c.emitf("catch ")
+	c.emitVars(try.CatchVars)
+	c.emitf(" ->")
+	c.indent()
+	c.emitln()
+	c.emitExpr(try.Handler)
+	c.dedent()
+}
+
+// emitVars emits vars as the values <V1,...,Vn>.
+func (c *Printer) emitVars(vars []Var) {
+	c.emitf("<")
+	for i, v := range vars {
+		if i > 0 {
+			c.emitf(",")
+		}
+		c.emitf("%s", v.Name)
+	}
+	c.emitf(">")
+}
+
+// emitMap emits a map as ~{K=>V}~, or for Version103, which has no maps, as a call of
+// maps:from_list/1 with a list of {K,V} tuples.
+func (c *Printer) emitMap(m Map) {
+	if c.version == Version103 {
+		var list Expr = Nil{}
+		for i := len(m.Pairs) - 1; i >= 0; i-- {
+			pair := Tuple{Elements: []Expr{m.Pairs[i].Key, m.Pairs[i].Value}}
+			list = Cons{Head: pair, Tail: list}
+		}
+		c.emitInterModuleCall(InterModuleCall{Module: Atom{Value: "maps"}, Func: Atom{Value: "from_list"}, Args: []Expr{list}})
+		return
+	}
+	c.emitf("~{")
+	for i, pair := range m.Pairs {
+		if i > 0 {
+			c.emitf(",")
+		}
+		c.emitExpr(pair.Key)
+		c.emitf("=>")
+		c.emitExpr(pair.Value)
+	}
+	c.emitf("}~")
+}
+
+func (c *Printer) emitCase(cs Case) {
+	c.emitf("case ")
+	c.emitExpr(cs.Arg)
+	c.emitf(" of")
+	c.indent()
+	for _, clause := range cs.Clauses {
+		c.emitln()
+		c.emitClause(clause)
+	}
+	c.dedent()
+	c.emitln()
+	c.emitf("end")
+}
+
+func (c *Printer) emitReceive(r Receive) {
+	c.emitf("receive")
+	c.indent()
+	for _, clause := range r.Clauses {
+		c.emitln()
+		c.emitClause(clause)
+	}
+	c.dedent()
+	c.emitln()
+	c.emitf("after ")
+	c.emitExpr(r.Timeout)
+	c.emitf(" ->")
+	c.indent()
+	c.emitln()
+	c.emitExpr(r.Action)
+	c.dedent()
+}
+
+func (c *Printer) emitClause(clause Clause) {
+	c.emitf("<")
+	c.emitExprList(clause.Patterns)
+	c.emitf("> when ")
+	if clause.Guard == nil {
+		c.emitLiteral(Atom{Value: "true"})
+	} else {
+		c.emitExpr(clause.Guard)
+	}
+	c.emitf(" ->")
+	c.indent()
+	c.emitln()
+	c.emitExpr(clause.Body)
+	c.dedent()
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/masp/garlang/internal/golden"
 	"github.com/sebdah/goldie/v2"
 )
 
@@ -100,6 +101,17 @@ func TestPrintModule(t *testing.T) {
 			},
 			expected: "intermodule.core",
 		},
+		{
+			name:     "map",
+			input:    mapModule("map", 0),
+			expected: "map.core",
+		},
+		{
+			// Core Erlang 1.0.3 has no maps, so they are built with maps:from_list/1
+			name:     "map_v103",
+			input:    mapModule("map_v103", Version103),
+			expected: "map_v103.core",
+		},
 	}
 
 	for _, tt := range tests {
@@ -112,6 +124,25 @@ func TestPrintModule(t *testing.T) {
 	}
 }
 
+// mapModule returns a module named name with a function that returns the map
+// #{a => 1, b => X}, printed in Core Erlang version.
+func mapModule(name string, version Version) *Module {
+	return &Module{
+		Name:    name,
+		Version: version,
+		Functions: []Func{
+			{
+				Name:       FuncName{Name: "m", Arity: 1},
+				Parameters: []Var{{Name: "X"}},
+				Body: Map{Pairs: []MapPair{
+					{Key: Atom{Value: "a"}, Value: Integer{Value: 1}},
+					{Key: Atom{Value: "b"}, Value: Var{Name: "X"}},
+				}},
+			},
+		},
+	}
+}
+
 func TestErlcCompiles(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping test in short mode")
@@ -123,7 +154,7 @@ func TestErlcCompiles(t *testing.T) {
 	}
 
 	tmp := t.TempDir()
-	tests := []string{"attributes.core", "exports.core", "one_func_annotated.core", "intermodule.core"}
+	tests := []string{"attributes.core", "exports.core", "one_func_annotated.core", "intermodule.core", "map.core", "map_v103.core"}
 	for _, test := range tests {
 		t.Run(test, func(t *testing.T) {
 			copyFile(t, filepath.Join("testdata", test+".golden"), filepath.Join(tmp, test))
@@ -157,3 +188,7 @@ func copyFile(t *testing.T, src, dst string) {
 		t.Fatalf("copy file: %v", err)
 	}
 }
+
+func TestNoOrphanFixtures(t *testing.T) {
+	golden.CheckOrphans(t)
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DebugSExpr returns mod as nested s-expressions like `(call 'erlang' '+' X 1)`, one
+// list per node of the tree. Unlike the printer it doesn't follow Core Erlang's syntax,
+// so it is easier to read and diff when debugging the compiler and in tests.
+func DebugSExpr(mod *Module) string {
+	var b strings.Builder
+	sexprModule(mod).write(&b, 0)
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// sexpr is a list of atoms (strings) and other lists, headed by the kind of node.
+type sexpr struct {
+	head string // or "" for a plain list, like the parameters of a fun
+	args []any  // string or sexpr
+}
+
+func list(head string, args ...any) sexpr {
+	return sexpr{head: head, args: args}
+}
+
+// write writes s on one line if its arguments are all atoms. Otherwise the atoms before
+// the first list stay on the line of the head, and every argument after them is on a
+// line of its own, indented under the head.
+func (s sexpr) write(b *strings.Builder, indent int) {
+	b.WriteByte('(')
+	b.WriteString(s.head)
+	i := 0
+	for ; i < len(s.args); i++ {
+		atom, ok := s.args[i].(string)
+		if !ok {
+			break
+		}
+		if i > 0 || s.head != "" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(atom)
+	}
+	for ; i < len(s.args); i++ {
+		b.WriteByte('\n')
+		b.WriteString(strings.Repeat("  ", indent+1))
+		switch arg := s.args[i].(type) {
+		case string:
+			b.WriteString(arg)
+		case sexpr:
+			arg.write(b, indent+1)
+		}
+	}
+	b.WriteByte(')')
+}
+
+func sexprModule(mod *Module) sexpr {
+	exports := list("exports")
+	for _, name := range mod.Exports {
+		exports.args = append(exports.args, name.String())
+	}
+	attrs := list("attributes")
+	for _, attr := range mod.Attributes {
+		attrs.args = append(attrs.args, list("", sexprConst(attr.Key), sexprConst(attr.Value)))
+	}
+	s := list("module", "'"+EscapeAtom(mod.Name)+"'", exports, attrs)
+	for _, fn := range mod.Functions {
+		s.args = append(s.args, list("define", fn.Name.String(), sexprFunc(fn)))
+	}
+	return s
+}
+
+func sexprFunc(fn Func) sexpr {
+	params := list("")
+	for _, param := range fn.Parameters {
+		params.args = append(params.args, param.Name)
+	}
+	s := list("fun", params, sexprExpr(fn.Body))
+	if len(fn.Annotation.Attrs) > 0 {
+		ann := list("annotation")
+		for _, attr := range fn.Annotation.Attrs {
+			ann.args = append(ann.args, sexprConst(attr))
+		}
+		s.args = append(s.args, ann)
+	}
+	return s
+}
+
+func sexprExpr(expr Expr) any {
+	switch expr := expr.(type) {
+	case Literal:
+		return sexprConst(expr)
+	case FuncName:
+		return expr.String()
+	case Var:
+		return expr.Name
+	case Func:
+		return sexprFunc(expr)
+	case Application:
+		return list("apply", append([]any{sexprExpr(expr.Func)}, sexprExprs(expr.Args)...)...)
+	case InterModuleCall:
+		return list("call", append([]any{sexprExpr(expr.Module), sexprExpr(expr.Func)}, sexprExprs(expr.Args)...)...)
+	case Let:
+		vars := list("")
+		for _, v := range expr.Vars {
+			vars.args = append(vars.args, v.Name)
+		}
+		return list("let", vars, sexprExpr(expr.Arg), sexprExpr(expr.Body))
+	case LetRec:
+		s := list("letrec")
+		for _, fn := range expr.Funcs {
+			s.args = append(s.args, list("define", fn.Name.String(), sexprFunc(fn)))
+		}
+		s.args = append(s.args, sexprExpr(expr.Body))
+		return s
+	case Seq:
+		return list("seq", sexprExpr(expr.First), sexprExpr(expr.Second))
+	case Catch:
+		return list("catch", sexprExpr(expr.Body))
+	case Try:
+		vars, catchVars := list(""), list("")
+		for _, v := range expr.Vars {
+			vars.args = append(vars.args, v.Name)
+		}
+		for _, v := range expr.CatchVars {
+			catchVars.args = append(catchVars.args, v.Name)
+		}
+		return list("try", sexprExpr(expr.Arg), vars, sexprExpr(expr.Body), catchVars, sexprExpr(expr.Handler))
+	case Case:
+		return list("case", append([]any{sexprExpr(expr.Arg)}, sexprClauses(expr.Clauses)...)...)
+	case Receive:
+		s := list("receive", sexprClauses(expr.Clauses)...)
+		s.args = append(s.args, list("after", sexprExpr(expr.Timeout), sexprExpr(expr.Action)))
+		return s
+	case PrimOp:
+		return list("primop", append([]any{sexprConst(expr.Name)}, sexprExprs(expr.Args)...)...)
+	case Values:
+		return list("values", sexprExprs(expr.Elements)...)
+	case Tuple:
+		return list("tuple", sexprExprs(expr.Elements)...)
+	case Map:
+		s := list("map")
+		for _, pair := range expr.Pairs {
+			s.args = append(s.args, list("=>", sexprExpr(pair.Key), sexprExpr(pair.Value)))
+		}
+		return s
+	case Cons:
+		return list("cons", sexprExpr(expr.Head), sexprExpr(expr.Tail))
+	case Alias:
+		return list("alias", expr.Var.Name, sexprExpr(expr.Pattern))
+	default:
+		panic(fmt.Sprintf("unknown expression type %T", expr))
+	}
+}
+
+func sexprExprs(exprs []Expr) []any {
+	args := make([]any, len(exprs))
+	for i, expr := range exprs {
+		args[i] = sexprExpr(expr)
+	}
+	return args
+}
+
+func sexprClauses(clauses []Clause) []any {
+	args := make([]any, len(clauses))
+	for i, clause := range clauses {
+		var guard any = "'true'"
+		if clause.Guard != nil {
+			guard = sexprExpr(clause.Guard)
+		}
+		args[i] = list("clause", list("", sexprExprs(clause.Patterns)...), guard, sexprExpr(clause.Body))
+	}
+	return args
+}
+
+func sexprConst(c Const) any {
+	switch c := c.(type) {
+	case Atom:
+		return "'" + EscapeAtom(c.Value) + "'"
+	case Integer:
+		return strconv.FormatInt(c.Value, 10)
+	case Float:
+		return strconv.FormatFloat(c.Value, 'g', -1, 64)
+	case Char:
+		return "$" + strconv.QuoteRune(c.Value)
+	case String:
+		return strconv.Quote(c.Value)
+	case Nil:
+		return "[]"
+	case FuncName:
+		return c.String()
+	case ConstList:
+		s := list("list")
+		for _, elem := range c.Elements {
+			s.args = append(s.args, sexprConst(elem))
+		}
+		return s
+	case ConstTuple:
+		s := list("tuple")
+		for _, elem := range c.Elements {
+			s.args = append(s.args, sexprConst(elem))
+		}
+		return s
+	default:
+		panic(fmt.Sprintf("unknown constant type %T", c))
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/sebdah/goldie/v2"
+)
+
+func TestDebugSExpr(t *testing.T) {
+	// sign(x) -> case x < 0 of true -> -1; _ -> lists:max([x, 0]) end, with a fun
+	mod := &Module{
+		Name:    "small",
+		Exports: []FuncName{{Name: "sign", Arity: 1}},
+		Attributes: []Attribute{
+			{Key: Atom{Value: "vsn"}, Value: ConstList{Elements: []Const{Integer{Value: 1}}}},
+		},
+		Functions: []Func{
+			{
+				Name:       FuncName{Name: "sign", Arity: 1},
+				Parameters: []Var{{Name: "X"}},
+				Body: Let{
+					Vars: []Var{{Name: "Neg"}},
+					Arg:  InterModuleCall{Module: Atom{Value: "erlang"}, Func: Atom{Value: "<"}, Args: []Expr{Var{Name: "X"}, Integer{Value: 0}}},
+					Body: Case{
+						Arg: Var{Name: "Neg"},
+						Clauses: []Clause{
+							{Patterns: []Expr{Atom{Value: "true"}}, Body: Integer{Value: -1}},
+							{
+								Patterns: []Expr{Var{Name: "_0"}},
+								Guard:    InterModuleCall{Module: Atom{Value: "erlang"}, Func: Atom{Value: "is_atom"}, Args: []Expr{Var{Name: "_0"}}},
+								Body: Application{
+									Func: Func{Parameters: []Var{{Name: "Y"}}, Body: Tuple{Elements: []Expr{Var{Name: "Y"}, String{Value: "it's \"ok\""}}}},
+									Args: []Expr{Cons{Head: Float{Value: 0.5}, Tail: Nil{}}},
+								},
+							},
+						},
+					},
+				},
+				Annotation: Annotation{Attrs: []Const{ConstTuple{Elements: []Const{
+					Atom{Value: "function"}, ConstTuple{Elements: []Const{Atom{Value: "sign"}, Integer{Value: 1}}},
+				}}}},
+			},
+		},
+	}
+	g := goldie.New(t)
+	g.Assert(t, "small.sexpr", []byte(DebugSExpr(mod)))
+}
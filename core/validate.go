@@ -0,0 +1,248 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/masp/garlang/token"
+)
+
+// Validate checks that mod is well formed Core Erlang, catching trees that would print
+// but fail to load, like calls with the wrong number of arguments or variables that are
+// never bound. All problems found are returned joined together. A problem in a function
+// listed in mod.FuncPos is a *token.Error at the function's declaration.
+func Validate(mod *Module) error {
+	v := validator{funcs: make(map[FuncName]bool), pos: mod.FuncPos}
+	for _, fn := range mod.Functions {
+		if v.funcs[fn.Name] {
+			v.errorf("function %s defined more than once", fn.Name)
+		}
+		v.funcs[fn.Name] = true
+	}
+	for _, export := range mod.Exports {
+		if !v.funcs[export] {
+			v.errorf("exported function %s is not defined", export)
+		}
+	}
+	for _, fn := range mod.Functions {
+		v.fn = fn.Name
+		if fn.Name.Arity != len(fn.Parameters) {
+			v.errorf("arity is %d but function has %d parameters", fn.Name.Arity, len(fn.Parameters))
+		}
+		v.fun(fn, nil)
+	}
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	funcs map[FuncName]bool // functions defined in the module
+	pos   map[FuncName]token.Position
+	fn    FuncName // function being validated
+	errs  []error
+}
+
+func (v *validator) errorf(format string, args ...any) {
+	if v.fn.Name != "" {
+		format = "%s: " + format
+		args = append([]any{v.fn}, args...)
+	}
+	err := fmt.Errorf(format, args...)
+	if pos, ok := v.pos[v.fn]; ok {
+		err = &token.Error{Pos: pos, Msg: err}
+	}
+	v.errs = append(v.errs, err)
+}
+
+// scope is the set of variables bound where an expression is evaluated.
+type scope map[string]bool
+
+// with returns a copy of s that also binds vars.
+func (s scope) with(vars ...string) scope {
+	inner := make(scope, len(s)+len(vars))
+	for name := range s {
+		inner[name] = true
+	}
+	for _, name := range vars {
+		inner[name] = true
+	}
+	return inner
+}
+
+func (v *validator) fun(fn Func, s scope) {
+	var params []string
+	seen := make(map[string]bool)
+	for _, param := range fn.Parameters {
+		if seen[param.Name] {
+			v.errorf("parameter %s is repeated", param.Name)
+		}
+		seen[param.Name] = true
+		params = append(params, param.Name)
+	}
+	v.expr(fn.Body, s.with(params...))
+}
+
+func (v *validator) exprs(exprs []Expr, s scope) {
+	for _, expr := range exprs {
+		v.expr(expr, s)
+	}
+}
+
+func (v *validator) expr(expr Expr, s scope) {
+	switch expr := expr.(type) {
+	case nil:
+		v.errorf("missing expression")
+	case Literal:
+	case FuncName:
+		if !v.funcs[expr] {
+			v.errorf("undefined function %s", expr)
+		}
+	case Var:
+		if !s[expr.Name] {
+			v.errorf("variable %s used before it is bound", expr.Name)
+		}
+	case Func:
+		v.fun(expr, s)
+	case Application:
+		switch fn := expr.Func.(type) {
+		case FuncName:
+			if fn.Arity != len(expr.Args) {
+				v.errorf("apply of %s with %d arguments", fn, len(expr.Args))
+			}
+		case Var, Func:
+		default:
+			v.errorf("apply of %T, must be a function name or variable", expr.Func)
+		}
+		v.expr(expr.Func, s)
+		v.exprs(expr.Args, s)
+	case InterModuleCall:
+		v.callee(expr.Module, s)
+		v.callee(expr.Func, s)
+		v.exprs(expr.Args, s)
+	case PrimOp:
+		v.exprs(expr.Args, s)
+	case Case:
+		v.expr(expr.Arg, s)
+		n := 1
+		if values, ok := expr.Arg.(Values); ok {
+			n = len(values.Elements)
+		}
+		for _, clause := range expr.Clauses {
+			v.clause(clause, n, s)
+		}
+	case Receive:
+		for _, clause := range expr.Clauses {
+			v.clause(clause, 1, s)
+		}
+		v.expr(expr.Timeout, s)
+		v.expr(expr.Action, s)
+	case Let:
+		v.expr(expr.Arg, s)
+		var vars []string
+		for _, bound := range expr.Vars {
+			vars = append(vars, bound.Name)
+		}
+		v.expr(expr.Body, s.with(vars...))
+	case LetRec:
+		defined := make([]FuncName, 0, len(expr.Funcs))
+		for _, fn := range expr.Funcs {
+			if !v.funcs[fn.Name] {
+				v.funcs[fn.Name] = true
+				defined = append(defined, fn.Name)
+			}
+		}
+		for _, fn := range expr.Funcs {
+			if fn.Name.Arity != len(fn.Parameters) {
+				v.errorf("letrec %s has %d parameters", fn.Name, len(fn.Parameters))
+			}
+			v.fun(fn, s)
+		}
+		v.expr(expr.Body, s)
+		for _, name := range defined {
+			delete(v.funcs, name) // only visible in the letrec
+		}
+	case Seq:
+		v.expr(expr.First, s)
+		v.expr(expr.Second, s)
+	case Catch:
+		v.expr(expr.Body, s)
+	case Try:
+		v.expr(expr.Arg, s)
+		var vars, catchVars []string
+		for _, bound := range expr.Vars {
+			vars = append(vars, bound.Name)
+		}
+		for _, bound := range expr.CatchVars {
+			catchVars = append(catchVars, bound.Name)
+		}
+		v.expr(expr.Body, s.with(vars...))
+		v.expr(expr.Handler, s.with(catchVars...))
+	case Values:
+		v.exprs(expr.Elements, s)
+	case Tuple:
+		v.exprs(expr.Elements, s)
+	case Map:
+		for _, pair := range expr.Pairs {
+			v.expr(pair.Key, s)
+			v.expr(pair.Value, s)
+		}
+	case Cons:
+		v.expr(expr.Head, s)
+		v.expr(expr.Tail, s)
+	default:
+		v.errorf("unknown expression %T", expr)
+	}
+}
+
+// callee checks the module or function of a call, which must be an atom or a variable.
+func (v *validator) callee(expr Expr, s scope) {
+	switch expr.(type) {
+	case Atom, Var:
+		v.expr(expr, s)
+	default:
+		v.errorf("call of %T, must be an atom or variable", expr)
+	}
+}
+
+func (v *validator) clause(clause Clause, n int, s scope) {
+	if len(clause.Patterns) != n {
+		v.errorf("clause has %d patterns but the case has %d values", len(clause.Patterns), n)
+	}
+	var bound []string
+	for _, pat := range clause.Patterns {
+		bound = v.pattern(pat, bound)
+	}
+	inner := s.with(bound...)
+	if clause.Guard != nil {
+		v.expr(clause.Guard, inner)
+	}
+	v.expr(clause.Body, inner)
+}
+
+// pattern checks pat and returns bound with the variables pat binds appended.
+func (v *validator) pattern(pat Expr, bound []string) []string {
+	switch pat := pat.(type) {
+	case Var:
+		for _, name := range bound {
+			if name == pat.Name {
+				v.errorf("variable %s is bound twice in a pattern", pat.Name)
+			}
+		}
+		return append(bound, pat.Name)
+	case Literal:
+		return bound
+	case Tuple:
+		for _, elem := range pat.Elements {
+			bound = v.pattern(elem, bound)
+		}
+		return bound
+	case Cons:
+		bound = v.pattern(pat.Head, bound)
+		return v.pattern(pat.Tail, bound)
+	case Alias:
+		bound = v.pattern(pat.Var, bound)
+		return v.pattern(pat.Pattern, bound)
+	default:
+		v.errorf("%T is not a valid pattern", pat)
+		return bound
+	}
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := &Module{
+		Name:    "valid",
+		Exports: []FuncName{{Name: "head", Arity: 1}},
+		Functions: []Func{
+			{
+				Name:       FuncName{Name: "head", Arity: 1},
+				Parameters: []Var{{Name: "_0"}},
+				Body: Case{
+					Arg: Var{Name: "_0"},
+					Clauses: []Clause{
+						{Patterns: []Expr{Cons{Head: Var{Name: "H"}, Tail: Var{Name: "_"}}}, Body: Var{Name: "H"}},
+						{Patterns: []Expr{Var{Name: "_1"}}, Body: Application{
+							Func: FuncName{Name: "head", Arity: 1},
+							Args: []Expr{Cons{Head: Var{Name: "_1"}, Tail: Nil{}}},
+						}},
+					},
+				},
+			},
+		},
+	}
+	require.NoError(t, Validate(valid))
+
+	malformed := &Module{
+		Name:    "malformed",
+		Exports: []FuncName{{Name: "missing", Arity: 0}},
+		Functions: []Func{
+			{
+				Name:       FuncName{Name: "f", Arity: 2},
+				Parameters: []Var{{Name: "X"}},
+				Body: Application{
+					Func: Atom{Value: "f"},
+					Args: []Expr{Var{Name: "Y"}},
+				},
+			},
+		},
+	}
+	require.EqualError(t, Validate(malformed), `exported function 'missing'/0 is not defined
+'f'/2: arity is 2 but function has 1 parameters
+'f'/2: apply of core.Atom, must be a function name or variable
+'f'/2: variable Y used before it is bound`)
+
+	// a problem in a function with a source position is reported there
+	malformed.FuncPos = map[FuncName]token.Position{{Name: "f", Arity: 2}: {Filename: "m.gar", Line: 3, Column: 1}}
+	err := Validate(malformed)
+	var tokErr *token.Error
+	require.ErrorAs(t, err, &tokErr)
+	require.Equal(t, 3, tokErr.Pos.Line)
+	require.Contains(t, err.Error(), "m.gar:3:1: 'f'/2: arity is 2 but function has 1 parameters")
+}
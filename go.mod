@@ -2,12 +2,15 @@ module github.com/masp/garlang
 
 go 1.20
 
+require (
+	github.com/sebdah/goldie/v2 v2.5.3
+	github.com/stretchr/testify v1.8.2
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/sebdah/goldie/v2 v2.5.3 // indirect
 	github.com/sergi/go-diff v1.3.1 // indirect
 	github.com/stretchr/objx v0.5.0 // indirect
-	github.com/stretchr/testify v1.8.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
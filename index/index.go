@@ -0,0 +1,53 @@
+// Package index finds declarations across the modules of a project, like the function a
+// call into another module refers to. It is the backend for project-wide
+// goto-definition.
+package index
+
+import (
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/token"
+)
+
+// Location is where a declaration is in the source.
+type Location struct {
+	Module string         // name of the module the declaration is in
+	Pos    token.Position // position of the declaration's name
+}
+
+// key identifies a function by its fully qualified name, module:name/arity.
+type key struct {
+	module string
+	name   string
+	arity  int
+}
+
+// Index maps the functions of a set of modules to where they are declared.
+type Index struct {
+	funcs map[key]Location
+}
+
+// Build indexes every function in mods, which maps module names to their parsed
+// modules. A function with several heads is located at its first head.
+func Build(mods map[string]*ast.Module) *Index {
+	idx := &Index{funcs: make(map[key]Location)}
+	for module, mod := range mods {
+		for _, decl := range mod.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			k := key{module: module, name: fn.Name.Name, arity: len(fn.Parameters)}
+			if _, ok := idx.funcs[k]; ok {
+				continue
+			}
+			idx.funcs[k] = Location{Module: module, Pos: mod.File.Position(fn.Name.Pos())}
+		}
+	}
+	return idx
+}
+
+// Lookup returns where module:name/arity is declared, if it is in the index.
+func (idx *Index) Lookup(module, name string, arity int) (Location, bool) {
+	loc, ok := idx.funcs[key{module: module, name: name, arity: arity}]
+	return loc, ok
+}
@@ -0,0 +1,50 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupCrossModule(t *testing.T) {
+	app, err := parser.Module("app.gar", []byte(`module app
+func main() {
+	return util.double(21)
+}`))
+	require.NoError(t, err)
+	util, err := parser.Module("util.gar", []byte(`module util
+
+func double(x) { return x * 2 }
+func double(x, y) { return {x * 2, y * 2} }`))
+	require.NoError(t, err)
+
+	idx := Build(map[string]*ast.Module{"app": app, "util": util})
+
+	// resolve the call in app to its declaration in util
+	var call *ast.CallExpr
+	ast.Inspect(app, func(node ast.Node) bool {
+		if c, ok := node.(*ast.CallExpr); ok {
+			call = c
+		}
+		return call == nil
+	})
+	require.NotNil(t, call)
+	dot := call.Callee.(*ast.DotExpr)
+	module := dot.Target.(*ast.Identifier).Name
+
+	loc, ok := idx.Lookup(module, dot.Attribute.Name, len(call.Arguments))
+	require.True(t, ok)
+	require.Equal(t, "util", loc.Module)
+	require.Equal(t, "util.gar:3:6", loc.Pos.String())
+
+	loc, ok = idx.Lookup("util", "double", 2)
+	require.True(t, ok)
+	require.Equal(t, "util.gar:4:6", loc.Pos.String())
+
+	_, ok = idx.Lookup("util", "double", 3)
+	require.False(t, ok)
+	_, ok = idx.Lookup("lists", "map", 2)
+	require.False(t, ok, "modules outside the index are not found")
+}
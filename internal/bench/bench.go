@@ -0,0 +1,62 @@
+// Package bench generates synthetic source for the lexer and parser benchmarks.
+package bench
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// funcs are the templates for the functions of a generated module, which together use
+// most of the language. %[1]d is replaced with the number of the function so every
+// function has a different name.
+var funcs = []string{
+	`// add%[1]d returns the sum of its arguments.
+func add%[1]d(a, b) {
+	c = a + b * %[1]d
+	return c
+}
+`,
+	`func classify%[1]d(x) when x > 0, x < 100; x == -1 {
+	return case x {
+		0 -> 'zero'
+		{ok, v} when v > %[1]d -> {'big', v}
+		[h | t] -> [h, t]
+		_ -> 'other'
+	}
+}
+`,
+	`func count%[1]d(n) {
+	i = 0
+	while i < n {
+		i = i + 1
+	}
+	return i
+}
+`,
+	`func greet%[1]d(name, n) {
+	s = "hello #{name}, you have #{n + %[1]d} messages"
+	return lists.map(fn(x) { return {s, x} }, [1, 2, 3, 16#ff, 2.5e-3])
+}
+`,
+	`func divmod%[1]d(a, b) {
+	q, r = {erlang.div(a, b), a %% b}
+	{x, y} := {q, r}
+	return x is int == (y is float)
+}
+`,
+}
+
+// Module returns a module with n functions and a few constants and types, in the style
+// of a large hand written module.
+func Module(n int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "module bench\n\n")
+	fmt.Fprintf(&buf, "import \"lists\"\n\n")
+	fmt.Fprintf(&buf, "const Limit = 100\n")
+	fmt.Fprintf(&buf, "type Pair tuple[int, int]\n\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, funcs[i%len(funcs)], i)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,15 @@
+package bench_test
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/internal/bench"
+	"github.com/masp/garlang/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleParses(t *testing.T) {
+	mod, err := parser.Module("bench.gar", bench.Module(20))
+	require.NoError(t, err)
+	require.Len(t, mod.Decls, 1+2+20) // import, const and type, functions
+}
@@ -0,0 +1,90 @@
+// Package golden has helpers for the golden file tests, which compare their output with
+// the fixtures in each package's testdata directory. After a change to the output, the
+// fixtures are regenerated with
+//
+//	go test ./... -update
+//
+// (or make update) and the changes are reviewed in the diff like any other code.
+package golden
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const ext = ".golden"
+
+// CheckOrphans fails t for every fixture under testdata in the current directory that no
+// test refers to, which usually means a test was renamed or removed without its fixture.
+func CheckOrphans(t *testing.T) {
+	t.Helper()
+	orphans, err := Orphans(".")
+	if err != nil {
+		t.Fatalf("find orphan fixtures: %v", err)
+	}
+	for _, path := range orphans {
+		t.Errorf("fixture %s is not used by any test, remove it or regenerate the fixtures with -update", path)
+	}
+}
+
+// Orphans returns the fixtures under dir/testdata that the tests in dir do not refer to,
+// in sorted order. A fixture is referred to if its name without the .golden extension is
+// a string literal in one of the _test.go files, like "while.ast" for
+// testdata/while.ast.golden.
+func Orphans(dir string) ([]string, error) {
+	names, err := testStrings(dir)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	err = filepath.WalkDir(filepath.Join(dir, "testdata"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == filepath.Join(dir, "testdata") {
+				return nil // no fixtures
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ext) {
+			return nil
+		}
+		if !names[strings.TrimSuffix(d.Name(), ext)] {
+			orphans = append(orphans, path)
+		}
+		return nil
+	})
+	sort.Strings(orphans)
+	return orphans, err
+}
+
+// testStrings returns every string literal in the _test.go files of dir.
+func testStrings(dir string) (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+	strs := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		ast.Inspect(f, func(node ast.Node) bool {
+			if lit, ok := node.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					strs[s] = true
+				}
+			}
+			return true
+		})
+	}
+	return strs, nil
+}
@@ -0,0 +1,38 @@
+package golden
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrphans(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a_test.go":                     "package a\nvar fixtures = []string{\"used.ast\", `errors/raw`}\n",
+		"testdata/used.ast.golden":      "",
+		"testdata/unused.ast.golden":    "",
+		"testdata/errors/old.golden":    "",
+		"testdata/fuzz/FuzzLex/corpus1": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	orphans, err := Orphans(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "testdata/errors/old.golden"),
+		filepath.Join(dir, "testdata/unused.ast.golden"),
+	}, orphans)
+}
+
+func TestOrphansNoTestdata(t *testing.T) {
+	orphans, err := Orphans(t.TempDir())
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+}
@@ -0,0 +1,34 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/internal/bench"
+)
+
+func BenchmarkLex(b *testing.B) {
+	src := bench.Module(500)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lex := NewLexer("bench.gar", src)
+		lex.All()
+		if errs := lex.Errors(); len(errs) > 0 {
+			b.Fatalf("lex: %v", errs)
+		}
+	}
+}
+
+// TestLexAllocs checks that literals are not copied from the source, so lexing allocates
+// a few times to grow the token and line slices but not for every token.
+func TestLexAllocs(t *testing.T) {
+	src := bench.Module(500)
+	allocs := testing.AllocsPerRun(10, func() {
+		NewLexer("bench.gar", src).All()
+	})
+	if allocs > 100 {
+		t.Errorf("lexing allocated %.0f times, want at most 100", allocs)
+	}
+}
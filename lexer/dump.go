@@ -0,0 +1,29 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/masp/garlang/token"
+)
+
+// Dump lexes src and writes every token to w, one per line, as its position, type and
+// literal. Comments and the final EOF are included. If src has lexing errors, they are
+// returned after all the tokens are written.
+func Dump(w io.Writer, src []byte) error {
+	lex := NewLexer("<string>", src)
+	for {
+		tok := lex.NextToken()
+		pos := lex.File().Position(tok.Pos)
+		if _, err := fmt.Fprintf(w, "%d:%d\t%s\t%q\n", pos.Line, pos.Column, tok.Type, tok.Lit); err != nil {
+			return err
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if lex.HasErrors() {
+		return lex.Errors()
+	}
+	return nil
+}
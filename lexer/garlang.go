@@ -2,7 +2,8 @@
 package lexer
 
 import (
-    "bytes"
+    "unicode/utf8"
+
     "github.com/masp/garlang/token"
 )
 
@@ -15,7 +16,6 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 
 {
 	var yych byte
-	yyaccept := 0
 	yych = l.input[l.cursor]
 	switch (yych) {
 	case 0x00:
@@ -32,6 +32,8 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 		goto yy12
 	case '"':
 		goto yy13
+	case '%':
+		goto yy219
 	case '\'':
 		goto yy15
 	case '(':
@@ -51,7 +53,7 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 	case '/':
 		goto yy31
 	case '0':
-		goto yy33
+		fallthrough
 	case '1':
 		fallthrough
 	case '2':
@@ -69,7 +71,7 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 	case '8':
 		fallthrough
 	case '9':
-		goto yy34
+		goto yy33
 	case ':':
 		goto yy37
 	case ';':
@@ -80,6 +82,10 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 		goto yy43
 	case '>':
 		goto yy45
+	case '?':
+		goto yy242
+	case '@':
+		goto yy283
 	case 'A':
 		fallthrough
 	case 'B':
@@ -134,30 +140,14 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 		fallthrough
 	case '_':
 		fallthrough
-	case 'a':
-		fallthrough
 	case 'b':
 		fallthrough
-	case 'c':
-		fallthrough
-	case 'd':
-		fallthrough
-	case 'e':
-		fallthrough
-	case 'g':
-		fallthrough
 	case 'h':
 		fallthrough
 	case 'j':
 		fallthrough
 	case 'k':
 		fallthrough
-	case 'l':
-		fallthrough
-	case 'n':
-		fallthrough
-	case 'o':
-		fallthrough
 	case 'p':
 		fallthrough
 	case 'q':
@@ -168,32 +158,52 @@ func (l *Lexer) lex() (pos token.Pos, tok token.Type, lit string, err error) {
 		fallthrough
 	case 'v':
 		fallthrough
-	case 'w':
-		fallthrough
 	case 'x':
 		fallthrough
 	case 'y':
 		fallthrough
 	case 'z':
 		goto yy47
+	case 'w':
+		goto yy211
 	case '[':
 		goto yy50
 	case ']':
 		goto yy52
+	case '^':
+		goto yy282
 	case '`':
 		goto yy54
+	case 'a':
+		goto yy260
+	case 'c':
+		goto yy205
+	case 'd':
+		goto yy284
+	case 'e':
+		goto yy297
 	case 'f':
 		goto yy56
+	case 'g':
+		goto yy236
 	case 'i':
 		goto yy57
+	case 'l':
+		goto yy255
 	case 'm':
 		goto yy58
+	case 'n':
+		goto yy201
+	case 'o':
+		goto yy274
 	case 'r':
 		goto yy59
 	case 't':
 		goto yy60
 	case '{':
 		goto yy61
+	case '|':
+		goto yy200
 	case '}':
 		goto yy63
 	default:
@@ -205,7 +215,13 @@ yy2:
 yy4:
 	l.cursor += 1
 yy5:
-	{ err = ErrUnrecognizedToken; return }
+	{
+			if l.input[l.token] >= utf8.RuneSelf {
+				// identifiers that start with a Unicode letter like `ñame`
+				return l.lexIdent()
+			}
+			err = ErrUnrecognizedToken; return
+		}
 yy6:
 	l.cursor += 1
 	yych = l.input[l.cursor]
@@ -255,6 +271,11 @@ yy15:
             if tok == token.String {
                 tok = token.Atom
             }
+            if err == ErrUnterminatedString {
+                err = ErrUnterminatedAtom
+            } else if err == nil && !utf8.ValidString(lit) {
+                err = ErrInvalidUTF8
+            }
             return
         }
 yy17:
@@ -274,10 +295,20 @@ yy25:
 	{ tok = token.Comma; lit = ","; return }
 yy27:
 	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == '-') {
+		goto yy290
+	}
+	if (yych == '>') {
+		goto yy228
+	}
 	{ tok = token.Minus; lit = "-"; return }
 yy29:
 	l.cursor += 1
 	yych = l.input[l.cursor]
+	if (yych == '.') {
+		goto yy259
+	}
 	if (yych <= '/') {
 		goto yy30
 	}
@@ -297,56 +328,8 @@ yy31:
 	}
 	{ tok = token.Slash; lit = "/"; return }
 yy33:
-	yyaccept = 0
-	l.cursor += 1
-	l.marker = l.cursor
-	yych = l.input[l.cursor]
-	if (yych <= '9') {
-		if (yych == '.') {
-			goto yy67
-		}
-		if (yych <= '/') {
-			goto yy5
-		}
-		goto yy75
-	} else {
-		if (yych <= 'E') {
-			if (yych <= 'D') {
-				goto yy5
-			}
-			goto yy78
-		} else {
-			if (yych == 'e') {
-				goto yy78
-			}
-			goto yy5
-		}
-	}
-yy34:
-	yyaccept = 1
 	l.cursor += 1
-	l.marker = l.cursor
-	yych = l.input[l.cursor]
-	if (yych <= '9') {
-		if (yych == '.') {
-			goto yy67
-		}
-		if (yych >= '0') {
-			goto yy34
-		}
-	} else {
-		if (yych <= 'E') {
-			if (yych >= 'E') {
-				goto yy78
-			}
-		} else {
-			if (yych == 'e') {
-				goto yy78
-			}
-		}
-	}
-yy36:
-	{ tok = token.Integer; lit = l.literal(); return }
+	{ return l.lexNumber() }
 yy37:
 	l.cursor += 1
 	yych = l.input[l.cursor]
@@ -378,6 +361,15 @@ yy45:
 		goto yy85
 	}
 	{ tok = token.Greater; lit = ">"; return }
+yy242:
+	l.cursor += 1
+	{ tok = token.Question; lit = "?"; return }
+yy282:
+	l.cursor += 1
+	{ tok = token.Caret; lit = "^"; return }
+yy283:
+	l.cursor += 1
+	{ tok = token.At; lit = "@"; return }
 yy47:
 	l.cursor += 1
 	yych = l.input[l.cursor]
@@ -416,10 +408,23 @@ yy52:
 	{ tok = token.RSquareBracket; lit = "]"; return }
 yy54:
 	l.cursor += 1
-	{ return l.lexRawString('`') }
+	{
+            // a quoted identifier like `weird name`, which can be any name Erlang allows.
+            // Backticks used to start raw strings, which are written with escapes now.
+            pos, tok, lit, err = l.lexStringPart('`', token.Identifier, token.Identifier)
+            if err == ErrUnterminatedString {
+                err = ErrUnterminatedIdent
+            } else if err == nil && lit == "" {
+                err = ErrEmptyIdent
+            }
+            return
+        }
 yy56:
 	l.cursor += 1
 	yych = l.input[l.cursor]
+	if (yych == 'n') {
+		goto yy229
+	}
 	if (yych == 'u') {
 		goto yy87
 	}
@@ -427,9 +432,18 @@ yy56:
 yy57:
 	l.cursor += 1
 	yych = l.input[l.cursor]
+	if (yych == 'f') {
+		goto yy291
+	}
 	if (yych == 'm') {
 		goto yy88
 	}
+	if (yych == 'n') {
+		goto yy253
+	}
+	if (yych == 's') {
+		goto yy234
+	}
 	goto yy48
 yy58:
 	l.cursor += 1
@@ -460,37 +474,26 @@ yy60:
 	goto yy48
 yy61:
 	l.cursor += 1
-	{ tok = token.LCurlyBracket; lit = "{"; return }
+	{ l.openBrace(); tok = token.LCurlyBracket; lit = "{"; return }
 yy63:
 	l.cursor += 1
-	{ tok = token.RCurlyBracket; lit = "}"; return }
+	{
+			if l.closeBrace() {
+				return l.lexStringPart('"', token.InterpTail, token.InterpMid)
+			}
+			tok = token.RCurlyBracket; lit = "}"; return
+		}
 yy65:
 	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == '=') {
+		goto yy216
+	}
 	{ tok = token.BangEqual; lit = "!="; return }
 yy67:
-	yyaccept = 2
 	l.cursor += 1
-	l.marker = l.cursor
-	yych = l.input[l.cursor]
-	if (yych <= 'D') {
-		if (yych <= '/') {
-			goto yy69
-		}
-		if (yych <= '9') {
-			goto yy67
-		}
-	} else {
-		if (yych <= 'E') {
-			goto yy78
-		}
-		if (yych == 'e') {
-			goto yy78
-		}
-	}
-yy69:
-	{ tok = token.Float; lit = l.literal(); return }
+	{ return l.lexNumber() }
 yy70:
-	yyaccept = 3
 	l.cursor += 1
 	l.marker = l.cursor
 	yych = l.input[l.cursor]
@@ -516,62 +519,9 @@ yy72:
 	}
 yy74:
 	{ tok = token.Comment; lit = l.literal(); return }
-yy75:
-	l.cursor += 1
-	yych = l.input[l.cursor]
-	if (yych <= '9') {
-		if (yych == '.') {
-			goto yy67
-		}
-		if (yych >= '0') {
-			goto yy75
-		}
-	} else {
-		if (yych <= 'E') {
-			if (yych >= 'E') {
-				goto yy78
-			}
-		} else {
-			if (yych == 'e') {
-				goto yy78
-			}
-		}
-	}
 yy77:
 	l.cursor = l.marker
-	if (yyaccept <= 1) {
-		if (yyaccept == 0) {
-			goto yy5
-		} else {
-			goto yy36
-		}
-	} else {
-		if (yyaccept == 2) {
-			goto yy69
-		} else {
-			goto yy71
-		}
-	}
-yy78:
-	l.cursor += 1
-	yych = l.input[l.cursor]
-	if (yych <= ',') {
-		if (yych == '+') {
-			goto yy97
-		}
-		goto yy77
-	} else {
-		if (yych <= '-') {
-			goto yy97
-		}
-		if (yych <= '/') {
-			goto yy77
-		}
-		if (yych <= '9') {
-			goto yy98
-		}
-		goto yy77
-	}
+	goto yy71
 yy79:
 	l.cursor += 1
 	{ tok = token.ColonEqual; lit = ":="; return }
@@ -580,6 +530,10 @@ yy81:
 	{ tok = token.LessEqual; lit = "<="; return }
 yy83:
 	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == '=') {
+		goto yy218
+	}
 	{ tok = token.EqualEqual; lit = "=="; return }
 yy85:
 	l.cursor += 1
@@ -615,6 +569,9 @@ yy90:
 yy91:
 	l.cursor += 1
 	yych = l.input[l.cursor]
+	if (yych == 'c') {
+		goto yy247
+	}
 	if (yych == 't') {
 		goto yy105
 	}
@@ -649,25 +606,6 @@ yy95:
 		goto yy108
 	}
 	goto yy94
-yy97:
-	l.cursor += 1
-	yych = l.input[l.cursor]
-	if (yych <= '/') {
-		goto yy77
-	}
-	if (yych >= ':') {
-		goto yy77
-	}
-yy98:
-	l.cursor += 1
-	yych = l.input[l.cursor]
-	if (yych <= '/') {
-		goto yy69
-	}
-	if (yych <= '9') {
-		goto yy98
-	}
-	goto yy69
 yy100:
 	l.cursor += 1
 	yych = l.input[l.cursor]
@@ -965,82 +903,1065 @@ yy127:
 	}
 yy128:
 	{ tok = token.Return; lit = "return"; return }
-}
-
-    }
-}
-
-func (l *Lexer) lexString(quote byte) (pos token.Pos, tok token.Type, lit string, err error) {
-	var buf bytes.Buffer
-	for {
-		var u byte
-
-{
-	var yych byte
+yy200:
+	l.cursor += 1
+	{ tok = token.Pipe; lit = "|"; return }
+yy201:
+	l.cursor += 1
 	yych = l.input[l.cursor]
-	if (yych <= '\n') {
-		if (yych <= 0x00) {
-			goto yy131
+	if (yych == 'i') {
+		goto yy202
+	}
+	if (yych == 'o') {
+		goto yy294
+	}
+	goto yy48
+yy202:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'l') {
+		goto yy203
+	}
+	goto yy48
+yy203:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy204
 		}
-		if (yych <= '\t') {
-			goto yy133
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
 		}
-		goto yy135
 	} else {
-		if (yych == '\\') {
-			goto yy137
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy204
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
 		}
-		goto yy133
 	}
-yy131:
+yy204:
+	{ tok = token.Nil; lit = "nil"; return }
+yy205:
 	l.cursor += 1
-	{
-			err = ErrUnterminatedString
-			tok = token.EOF
-            pos = l.file.Pos(l.token)
-			return
-		}
-yy133:
+	yych = l.input[l.cursor]
+	if (yych == 'a') {
+		goto yy224
+	}
+	if (yych == 'o') {
+		goto yy206
+	}
+	goto yy48
+yy206:
 	l.cursor += 1
-	{
-			u = yych
-			if u == quote {
-				tok = token.String
-				pos = l.file.Pos(l.token)
-				lit = string(buf.Bytes())
-				return
-			}
-			buf.WriteByte(u)
-			continue
-		}
-yy135:
+	yych = l.input[l.cursor]
+	if (yych == 'n') {
+		goto yy207
+	}
+	goto yy48
+yy207:
 	l.cursor += 1
-yy136:
-	{ err = ErrInvalidString; return }
-yy137:
+	yych = l.input[l.cursor]
+	if (yych == 's') {
+		goto yy208
+	}
+	goto yy48
+yy208:
 	l.cursor += 1
 	yych = l.input[l.cursor]
-	if (yych <= 'b') {
-		if (yych <= '>') {
-			if (yych <= '"') {
-				if (yych <= '!') {
-					goto yy136
-				}
-			} else {
-				if (yych == '\'') {
-					goto yy140
-				}
-				goto yy136
+	if (yych == 't') {
+		goto yy209
+	}
+	goto yy48
+yy209:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy210
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
 			}
 		} else {
-			if (yych <= '\\') {
-				if (yych <= '?') {
-					goto yy142
-				}
-				if (yych <= '[') {
-					goto yy136
-				}
-				goto yy144
+			if (yych <= '`') {
+				goto yy210
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy210:
+	{ tok = token.Const; lit = "const"; return }
+yy211:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'h') {
+		goto yy212
+	}
+	goto yy48
+yy212:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy213
+	}
+	if (yych == 'i') {
+		goto yy220
+	}
+	goto yy48
+yy213:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'n') {
+		goto yy214
+	}
+	goto yy48
+yy214:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy215
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy215
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy215:
+	{ tok = token.When; lit = "when"; return }
+yy216:
+	l.cursor += 1
+	{ tok = token.BangEqualEqual; lit = "!=="; return }
+yy218:
+	l.cursor += 1
+	{ tok = token.EqualEqualEqual; lit = "==="; return }
+yy219:
+	l.cursor += 1
+	{ tok = token.Percent; lit = "%"; return }
+yy220:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'l') {
+		goto yy221
+	}
+	goto yy48
+yy221:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy222
+	}
+	goto yy48
+yy222:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy223
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy223
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy223:
+	{ tok = token.While; lit = "while"; return }
+yy224:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 's') {
+		goto yy225
+	}
+	if (yych == 't') {
+		goto yy243
+	}
+	goto yy48
+yy225:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy226
+	}
+	goto yy48
+yy226:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy227
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy227
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy227:
+	{ tok = token.Case; lit = "case"; return }
+yy228:
+	l.cursor += 1
+	{ tok = token.Arrow; lit = "->"; return }
+yy229:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy230
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy230
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy230:
+	{ tok = token.Fn; lit = "fn"; return }
+yy234:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy235
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy235
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy235:
+	{ tok = token.Is; lit = "is"; return }
+yy236:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'u') {
+		goto yy237
+	}
+	goto yy48
+yy237:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'a') {
+		goto yy238
+	}
+	goto yy48
+yy238:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'r') {
+		goto yy239
+	}
+	goto yy48
+yy239:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'd') {
+		goto yy240
+	}
+	goto yy48
+yy240:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy241
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy241
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy241:
+	{ tok = token.Guard; lit = "guard"; return }
+yy243:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'c') {
+		goto yy244
+	}
+	goto yy48
+yy244:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'h') {
+		goto yy245
+	}
+	goto yy48
+yy245:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy246
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy246
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy246:
+	{ tok = token.CatchKeyword; lit = "catch"; return }
+yy247:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy248
+	}
+	goto yy48
+yy248:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'i') {
+		goto yy249
+	}
+	goto yy48
+yy249:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'v') {
+		goto yy250
+	}
+	goto yy48
+yy250:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy251
+	}
+	goto yy48
+yy251:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy252
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy252
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy252:
+	{ tok = token.Receive; lit = "receive"; return }
+yy253:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy254
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy254
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy254:
+	{ tok = token.In; lit = "in"; return }
+yy255:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy256
+	}
+	goto yy48
+yy256:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 't') {
+		goto yy257
+	}
+	goto yy48
+yy257:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy258
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy258
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy258:
+	{ tok = token.Let; lit = "let"; return }
+yy259:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == '.') {
+		goto yy293
+	}
+	{ tok = token.DotDot; lit = ".."; return }
+yy260:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'f') {
+		goto yy261
+	}
+	if (yych == 'n') {
+		goto yy266
+	}
+	goto yy48
+yy261:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 't') {
+		goto yy262
+	}
+	goto yy48
+yy262:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy263
+	}
+	goto yy48
+yy263:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'r') {
+		goto yy264
+	}
+	goto yy48
+yy264:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy265
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy265
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy265:
+	{ tok = token.After; lit = "after"; return }
+yy266:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'd') {
+		goto yy267
+	}
+	goto yy48
+yy267:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'a') {
+		goto yy269
+	}
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy268
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy268
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy268:
+	{ tok = token.And; lit = "and"; return }
+yy269:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'l') {
+		goto yy270
+	}
+	goto yy48
+yy270:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 's') {
+		goto yy271
+	}
+	goto yy48
+yy271:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'o') {
+		goto yy272
+	}
+	goto yy48
+yy272:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy273
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy273
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy273:
+	{ tok = token.AndAlso; lit = "andalso"; return }
+yy274:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'r') {
+		goto yy275
+	}
+	goto yy48
+yy275:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy277
+	}
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy276
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy276
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy276:
+	{ tok = token.Or; lit = "or"; return }
+yy277:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'l') {
+		goto yy278
+	}
+	goto yy48
+yy278:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 's') {
+		goto yy279
+	}
+	goto yy48
+yy279:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy280
+	}
+	goto yy48
+yy280:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy281
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy281
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy281:
+	{ tok = token.OrElse; lit = "orelse"; return }
+yy284:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy285
+	}
+	goto yy48
+yy285:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'f') {
+		goto yy286
+	}
+	goto yy48
+yy286:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy287
+	}
+	goto yy48
+yy287:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'r') {
+		goto yy288
+	}
+	goto yy48
+yy288:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy289
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy289
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy289:
+	{ tok = token.Defer; lit = "defer"; return }
+yy290:
+	l.cursor += 1
+	{ tok = token.MinusMinus; lit = "--"; return }
+yy291:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy292
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy292
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy292:
+	{ tok = token.If; lit = "if"; return }
+yy293:
+	l.cursor += 1
+	{ tok = token.Ellipsis; lit = "..."; return }
+yy294:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 't') {
+		goto yy295
+	}
+	goto yy48
+yy295:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy296
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy296
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy296:
+	{ tok = token.Not; lit = "not"; return }
+yy297:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'l') {
+		goto yy298
+	}
+	goto yy48
+yy298:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 's') {
+		goto yy299
+	}
+	goto yy48
+yy299:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych == 'e') {
+		goto yy300
+	}
+	goto yy48
+yy300:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'Z') {
+		if (yych <= '/') {
+			goto yy301
+		}
+		if (yych <= '9') {
+			goto yy47
+		}
+		if (yych >= 'A') {
+			goto yy47
+		}
+	} else {
+		if (yych <= '_') {
+			if (yych >= '_') {
+				goto yy47
+			}
+		} else {
+			if (yych <= '`') {
+				goto yy301
+			}
+			if (yych <= 'z') {
+				goto yy47
+			}
+		}
+	}
+yy301:
+	{ tok = token.Else; lit = "else"; return }
+}
+
+    }
+}
+
+// lexStringPart lexes a string up to the closing quote, returning end, or up to the start
+// of an interpolation, returning interp. Only double quoted strings are interpolated.
+func (l *Lexer) lexStringPart(quote byte, end, interp token.Type) (pos token.Pos, tok token.Type, lit string, err error) {
+	s := strValue{src: l.src, from: l.token + 1}
+	for {
+		mark := l.cursor
+		var u byte
+
+{
+	var yych byte
+	yych = l.input[l.cursor]
+	if (yych <= '\n') {
+		if (yych <= 0x00) {
+			goto yy131
+		}
+		if (yych <= '\t') {
+			goto yy133
+		}
+		goto yy131
+	} else {
+		if (yych == '#') {
+			goto yy231
+		}
+		if (yych == '\\') {
+			goto yy137
+		}
+		goto yy133
+	}
+yy131:
+	l.cursor += 1
+	{
+			// strings cannot span lines, so the string ends at the end of the line or input,
+			// which are left for the next token
+			l.cursor -= 1
+			err = ErrUnterminatedString
+			tok = end
+			pos = l.file.Pos(l.token)
+			lit = s.value(mark)
+			return
+		}
+yy133:
+	l.cursor += 1
+	{
+			u = yych
+			if u == quote {
+				tok = end
+				pos = l.file.Pos(l.token)
+				lit = s.value(mark)
+				return
+			}
+			continue
+		}
+yy136:
+	{ err = ErrInvalidString; return }
+yy137:
+	l.cursor += 1
+	yych = l.input[l.cursor]
+	if (yych <= 'b') {
+		if (yych <= '>') {
+			if (yych <= '"') {
+				if (yych <= '!') {
+					goto yy136
+				}
+			} else {
+				if (yych == '#') {
+					goto yy233
+				}
+				if (yych == '\'') {
+					goto yy140
+				}
+				goto yy136
+			}
+		} else {
+			if (yych <= '\\') {
+				if (yych <= '?') {
+					goto yy142
+				}
+				if (yych <= '[') {
+					goto yy136
+				}
+				goto yy144
 			} else {
 				if (yych <= '`') {
 					goto yy136
@@ -1082,69 +2003,59 @@ yy137:
 		}
 	}
 	l.cursor += 1
-	{ buf.WriteByte('"'); continue }
+	{ s.escape(mark, l.cursor, '"'); continue }
 yy140:
 	l.cursor += 1
-	{ buf.WriteByte('\''); continue }
+	{ s.escape(mark, l.cursor, '\''); continue }
 yy142:
 	l.cursor += 1
-	{ buf.WriteByte('?'); continue }
+	{ s.escape(mark, l.cursor, '?'); continue }
 yy144:
 	l.cursor += 1
-	{ buf.WriteByte('\\'); continue }
+	{ s.escape(mark, l.cursor, '\\'); continue }
 yy146:
 	l.cursor += 1
-	{ buf.WriteByte('\a'); continue }
+	{ s.escape(mark, l.cursor, '\a'); continue }
 yy148:
 	l.cursor += 1
-	{ buf.WriteByte('\b'); continue }
+	{ s.escape(mark, l.cursor, '\b'); continue }
 yy150:
 	l.cursor += 1
-	{ buf.WriteByte('\f'); continue }
+	{ s.escape(mark, l.cursor, '\f'); continue }
 yy152:
 	l.cursor += 1
-	{ buf.WriteByte('\n'); continue }
+	{ s.escape(mark, l.cursor, '\n'); continue }
 yy154:
 	l.cursor += 1
-	{ buf.WriteByte('\r'); continue }
+	{ s.escape(mark, l.cursor, '\r'); continue }
 yy156:
 	l.cursor += 1
-	{ buf.WriteByte('\t'); continue }
+	{ s.escape(mark, l.cursor, '\t'); continue }
 yy158:
 	l.cursor += 1
-	{ buf.WriteByte('\v'); continue }
-}
-		
-	}
-}
-
-func (l *Lexer) lexRawString(quote byte) (pos token.Pos, tok token.Type, lit string, err error) {
-	for {
-
-{
-	var yych byte
+	{ s.escape(mark, l.cursor, '\v'); continue }
+yy231:
+	l.cursor += 1
 	yych = l.input[l.cursor]
-	if (yych >= 0x01) {
-		goto yy164
+	if (yych == '{') {
+		goto yy232
 	}
+	{ continue }
+yy232:
 	l.cursor += 1
 	{
-			err = ErrUnterminatedString
-			tok = token.EOF
-            pos = l.file.Pos(l.token)
-			return
-		}
-yy164:
-	l.cursor += 1
-	{
-			if yych == quote {
-				tok = token.String
+			if quote == '"' {
+				l.interps = append(l.interps, 0)
+				tok = interp
 				pos = l.file.Pos(l.token)
-				lit = string(l.input[l.token+1:l.cursor-1])
+				lit = s.value(mark)
 				return
 			}
 			continue
 		}
+yy233:
+	l.cursor += 1
+	{ s.escape(mark, l.cursor, '#'); continue }
 }
 		
 	}
@@ -1185,7 +2096,7 @@ yy172:
 	{
 			tok = token.Comment
 			pos = l.file.Pos(l.token)
-			lit = string(l.input[l.token+2:l.cursor])
+			lit = l.src[l.token+2:l.cursor]
 			return
 		}
 }
@@ -0,0 +1,53 @@
+package lexer
+
+import "github.com/masp/garlang/token"
+
+// indent returns the Indent or Dedent token that comes before tok if tok is the first
+// token on its line and changes the indentation. The tokens after it, including tok,
+// are queued in l.pending.
+func (l *Lexer) indent(tok Token) Token {
+	var changes []Token
+	switch tok.Type {
+	case token.Comment:
+		return tok
+	case token.EOF:
+		// close every open block at the end of input
+		for range l.indents {
+			changes = append(changes, Token{Pos: tok.Pos, Type: token.Dedent})
+		}
+		l.indents = nil
+	default:
+		pos := l.file.Position(tok.Pos)
+		if pos.Line == l.line {
+			return tok
+		}
+		l.line = pos.Line
+		width := pos.Column - 1
+		if width > l.width() {
+			l.indents = append(l.indents, width)
+			changes = append(changes, Token{Pos: tok.Pos, Type: token.Indent})
+			break
+		}
+		for width < l.width() {
+			l.indents = l.indents[:len(l.indents)-1]
+			changes = append(changes, Token{Pos: tok.Pos, Type: token.Dedent})
+		}
+		if width != l.width() {
+			l.error(tok.Pos, ErrBadDedent)
+		}
+	}
+	if len(changes) == 0 {
+		return tok
+	}
+	l.pending = append(l.pending, changes[1:]...)
+	l.pending = append(l.pending, tok)
+	return changes[0]
+}
+
+// width returns the indentation of the innermost block.
+func (l *Lexer) width() int {
+	if len(l.indents) == 0 {
+		return 0
+	}
+	return l.indents[len(l.indents)-1]
+}
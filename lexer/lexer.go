@@ -1,9 +1,13 @@
 package lexer
 
-//go:generate re2go garlang.re -o garlang.go -i
+//go:generate re2go garlang.re -o garlang.go -i --no-generation-date --no-version
 
 import (
 	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/masp/garlang/token"
 )
@@ -11,16 +15,39 @@ import (
 var (
 	ErrUnrecognizedToken   = errors.New("unrecognized token")
 	ErrInvalidString       = errors.New("invalid string")
-	ErrUnterminatedString  = errors.New("unterminated string")
+	ErrUnterminatedString  = errors.New("unterminated string literal")
+	ErrUnterminatedAtom    = errors.New("unterminated atom literal")
+	ErrUnterminatedIdent   = errors.New("unterminated quoted identifier")
+	ErrEmptyIdent          = errors.New("quoted identifier cannot be empty")
 	ErrUnterminatedComment = errors.New("unterminated multiline comment")
+	ErrFloatNoFraction     = errors.New("float literal requires digits after '.'")
+	ErrFloatNoInteger      = errors.New("float literal requires digits before '.'")
+	ErrFloatNoDot          = errors.New("float literal requires '.' before exponent")
+	ErrInvalidBase         = errors.New("integer base must be between 2 and 36")
+	ErrInvalidDigit        = errors.New("invalid digit for integer base")
+	ErrBadDedent           = errors.New("unindent does not match any outer indentation level")
+	ErrInvalidUTF8         = errors.New("invalid UTF-8 encoding")
+	ErrIdentTooLong        = errors.New("identifier too long")
+	ErrAtomTooLong         = errors.New("atom too long")
+	ErrStringTooLong       = errors.New("string too long")
 )
 
+// DefaultMaxLiteralLen is the longest identifier, atom or string in bytes, unless
+// Options.MaxLiteralLen sets another limit. It is far longer than any real string, but
+// keeps pathological inputs from turning into huge strings.
+const DefaultMaxLiteralLen = 1 << 16
+
+// MaxAtomLen is the most characters an atom can have in Erlang, which is also the limit
+// for identifiers: they name functions and modules, which are atoms, and the variables
+// of Core Erlang are read as atoms too.
+const MaxAtomLen = 255
+
 type TokenType int
 
 type Token struct {
 	Pos  token.Pos
 	Type token.Type
-	Lit  string
+	Lit  string // substring of the source, except for the value of a string with escapes
 }
 
 func (t Token) String() string {
@@ -31,17 +58,64 @@ func (t Token) String() string {
 	}
 }
 
+// Position returns the line and column of the token in file, which must be the file it
+// was lexed from, like Lexer.File. The lines of file are only known up to the last token
+// the lexer returned.
+func (t Token) Position(file *token.File) token.Position {
+	return file.Position(t.Pos)
+}
+
+// End returns the position of the character right after the token. Strings and atoms
+// are lexed without their quotes, which are added back, but escapes make their end
+// approximate. A semicolon inserted at the end of a line takes no space.
+func (t Token) End() token.Pos {
+	switch {
+	case t.Type == token.String || t.Type == token.Atom:
+		return t.Pos + token.Pos(len(t.Lit)+2)
+	case t.Type == token.Semicolon && t.Lit == "\n":
+		return t.Pos
+	}
+	return t.Pos + token.Pos(len(t.Lit))
+}
+
 type Lexer struct {
 	file      *token.File
 	input     []byte
-	cursor    int // internal use by lexer
-	marker    int // internal use by lexer for backtracking
-	token     int // marks the start of the currently scanned token
+	src       string // input as a string, so literals are substrings of it instead of copies
+	cursor    int    // internal use by lexer
+	marker    int    // internal use by lexer for backtracking
+	token     int    // marks the start of the currently scanned token
 	prevToken Token
 
+	opts    Options
+	indents []int   // widths of the enclosing indented blocks, innermost last
+	line    int     // line of the last token checked for indentation
+	pending []Token // tokens to return before lexing more input
+	interps []int   // number of open '{' in each unfinished string interpolation, innermost last
+
 	errors token.ErrorList
 }
 
+// Options configure optional lexer behavior. The zero value is the default brace-based mode.
+type Options struct {
+	// Indentation emits an Indent token before the first token of a line that is indented
+	// more than the enclosing block, and a Dedent token for every block that a line
+	// closes by being indented less. Blank and comment-only lines are ignored.
+	Indentation bool
+
+	// CaseInsensitiveKeywords matches reserved words in any case, so `MODULE` and `Func`
+	// are keywords like `module` and `func`, for users used to other BEAM languages. The
+	// token has the lowercase spelling. Other identifiers, quoted identifiers and atoms
+	// keep their case.
+	CaseInsensitiveKeywords bool
+
+	// MaxLiteralLen is the longest identifier, atom or string in bytes, or each part of an
+	// interpolated string; a longer one is reported as too long. Zero means
+	// DefaultMaxLiteralLen. Identifiers and atoms are also limited to MaxAtomLen
+	// characters. A negative limit disables both checks.
+	MaxLiteralLen int
+}
+
 func (l *Lexer) error(pos token.Pos, err error) {
 	l.errors.Add(l.file.Position(pos), err)
 }
@@ -67,9 +141,60 @@ func (l *Lexer) insertSemi() bool {
 
 	switch l.prevToken.Type {
 	case token.Identifier, token.RParen, token.RCurlyBracket,
-		token.RSquareBracket, token.Return:
+		token.RSquareBracket, token.Return, token.InterpTail:
+		return true
+	}
+	return false
+}
+
+// lexString lexes a string or quoted atom after the opening quote. A string with an
+// interpolation like "a #{x} b" is lexed in parts, starting with a token.InterpHead.
+func (l *Lexer) lexString(quote byte) (pos token.Pos, tok token.Type, lit string, err error) {
+	return l.lexStringPart(quote, token.String, token.InterpHead)
+}
+
+// strValue builds the value of a string literal. The value is a substring of the source
+// unless the string has escapes, and only then is it copied.
+type strValue struct {
+	src  string
+	from int    // offset in src of the value after the last escape
+	buf  []byte // value up to the last escape; or nil if there were none
+}
+
+// escape adds c, the value of the escape sequence at src[at:next], to the value.
+func (s *strValue) escape(at, next int, c byte) {
+	s.buf = append(append(s.buf, s.src[s.from:at]...), c)
+	s.from = next
+}
+
+// value returns the value of the string that ends at offset end in src.
+func (s *strValue) value(end int) string {
+	if s.buf == nil {
+		return s.src[s.from:end]
+	}
+	return string(append(s.buf, s.src[s.from:end]...))
+}
+
+// openBrace counts a '{' inside a string interpolation, so its '}' does not end the
+// interpolation.
+func (l *Lexer) openBrace() {
+	if n := len(l.interps); n > 0 {
+		l.interps[n-1]++
+	}
+}
+
+// closeBrace counts a '}' and reports whether it ends a string interpolation, in which
+// case the rest of the string is lexed next.
+func (l *Lexer) closeBrace() bool {
+	n := len(l.interps)
+	if n == 0 {
+		return false
+	}
+	if l.interps[n-1] == 0 {
+		l.interps = l.interps[:n-1]
 		return true
 	}
+	l.interps[n-1]--
 	return false
 }
 
@@ -82,13 +207,20 @@ func Lex(input []byte) ([]Token, error) {
 	return tokens, nil
 }
 
+// NewLexerOptions is like NewLexer but with non-default options.
+func NewLexerOptions(filename string, input []byte, opts Options) *Lexer {
+	l := NewLexer(filename, input)
+	l.opts = opts
+	return l
+}
+
 func NewLexer(filename string, input []byte) *Lexer {
 	if len(input) == 0 || input[len(input)-1] != '\x00' {
 		// termination char, faster copying than branching every time in the lexer
 		input = append(input, '\x00')
 	}
 	file := token.NewFile(filename, len(input))
-	return &Lexer{file: file, input: input}
+	return &Lexer{file: file, input: input, src: string(input)}
 }
 
 func (l *Lexer) File() *token.File {
@@ -107,19 +239,218 @@ func (l *Lexer) All() []Token {
 	return tokens
 }
 
-func (l *Lexer) literal() string          { return string(l.input[l.token:l.cursor]) }
+func (l *Lexer) literal() string          { return l.src[l.token:l.cursor] }
 func (l *Lexer) pos() token.Pos           { return l.file.Pos(l.cursor) }
 func (l *Lexer) position() token.Position { return l.file.Position(l.pos()) }
 
 func (l *Lexer) NextToken() (tok Token) {
+	if len(l.pending) > 0 {
+		tok, l.pending = l.pending[0], l.pending[1:]
+		l.prevToken = tok
+		return
+	}
+
 	pos, typ, lit, err := l.lex()
+	if token.Lookup(lit) == typ && l.input[l.cursor] >= utf8.RuneSelf && l.input[l.token] != '`' {
+		// an identifier or keyword followed by Unicode letters, like `café` or `inné`
+		pos, typ, lit, err = l.lexIdent()
+	}
+	if err == nil {
+		lit, err = l.checkLength(typ, lit)
+	}
 	if err != nil {
 		l.error(pos, err)
 	}
+	if l.opts.CaseInsensitiveKeywords && typ == token.Identifier && l.input[l.token] != '`' {
+		typ, lit = foldKeyword(lit)
+	}
 
 	tok.Pos = pos
 	tok.Lit = lit
 	tok.Type = typ
+	if l.opts.Indentation {
+		tok = l.indent(tok)
+	}
 	l.prevToken = tok
 	return
 }
+
+// checkLength returns an error if lit, the value of a token of type typ, is an
+// identifier, atom or string longer than Options.MaxLiteralLen, or an identifier or atom
+// longer than MaxAtomLen characters. A literal that is too long is cut to the limit, so
+// the token doesn't keep it all.
+func (l *Lexer) checkLength(typ token.Type, lit string) (string, error) {
+	max := l.opts.MaxLiteralLen
+	if max == 0 {
+		max = DefaultMaxLiteralLen
+	}
+	if max < 0 {
+		return lit, nil
+	}
+	var err error
+	switch typ {
+	case token.Identifier:
+		err = ErrIdentTooLong
+	case token.Atom:
+		err = ErrAtomTooLong
+	case token.String, token.InterpHead, token.InterpMid, token.InterpTail:
+		if len(lit) > max {
+			return truncate(lit, max), ErrStringTooLong
+		}
+		return lit, nil
+	default:
+		return lit, nil
+	}
+	if len(lit) > max {
+		lit = truncate(lit, max)
+	} else if len(lit) <= MaxAtomLen || utf8.RuneCountInString(lit) <= MaxAtomLen {
+		return lit, nil
+	}
+	// cut after MaxAtomLen characters, if the byte limit left more
+	n := 0
+	for i := range lit {
+		if n == MaxAtomLen {
+			lit = lit[:i]
+			break
+		}
+		n++
+	}
+	return lit, err
+}
+
+// truncate returns the first n bytes of s, or fewer so that a character isn't cut.
+func truncate(s string, n int) string {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// foldKeyword returns the reserved word that ident spells in any case, or ident itself if
+// it is not one.
+func foldKeyword(ident string) (token.Type, string) {
+	lower := strings.ToLower(ident)
+	if tok := token.Lookup(lower); tok != token.Identifier && len(lower) == len(ident) {
+		return tok, lower
+	}
+	return token.Identifier, ident
+}
+
+// lexIdent scans the identifier at l.token. Like Erlang atoms, identifiers may contain
+// any Unicode letters, not only ASCII ones, so `größe` and `名前` are identifiers; digits
+// and '_' are allowed after the first character. Only identifiers with a non-ASCII
+// character are scanned here, since the re2c rules match ASCII ones.
+//
+// Bytes that are not valid UTF-8 are kept in the identifier and reported, and a first
+// character that is not a letter, like '€', is unrecognized.
+func (l *Lexer) lexIdent() (pos token.Pos, tok token.Type, lit string, err error) {
+	l.cursor = l.token
+	pos = l.file.Pos(l.token)
+	for {
+		r, size := utf8.DecodeRune(l.input[l.cursor:])
+		if r == utf8.RuneError && size == 1 {
+			err = ErrInvalidUTF8
+		} else if !isIdentRune(r, l.cursor == l.token) {
+			break
+		}
+		l.cursor += size
+	}
+	if l.cursor == l.token {
+		_, size := utf8.DecodeRune(l.input[l.cursor:])
+		l.cursor += size
+		return pos, token.Invalid, l.literal(), ErrUnrecognizedToken
+	}
+	return pos, token.Identifier, l.literal(), err
+}
+
+func isIdentRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || !first && unicode.IsDigit(r)
+}
+
+// lexNumber scans the integer or float literal at l.token. Numbers follow Erlang: floats
+// need digits on both sides of the '.' and may have an exponent (1.5e-3), and integers may
+// be written in any base from 2 to 36 as base#digits (16#ff).
+func (l *Lexer) lexNumber() (pos token.Pos, tok token.Type, lit string, err error) {
+	l.cursor = l.token
+	pos = l.file.Pos(l.token)
+	tok = token.Integer
+	if l.skipDigits() == 0 {
+		// only reached for '.' followed by digits, like .5
+		l.cursor++
+		l.skipDigits()
+		return pos, token.Float, l.literal(), ErrFloatNoInteger
+	}
+
+	switch l.input[l.cursor] {
+	case '#':
+		base, _ := strconv.Atoi(l.literal())
+		if base < 2 || base > 36 {
+			err = ErrInvalidBase
+		}
+		l.cursor++
+		start := l.cursor
+		for isAlnum(l.input[l.cursor]) {
+			if err == nil && digitVal(l.input[l.cursor]) >= base {
+				err = ErrInvalidDigit
+			}
+			l.cursor++
+		}
+		if l.cursor == start && err == nil {
+			err = ErrInvalidDigit
+		}
+	case '.':
+		if l.input[l.cursor+1] == '.' {
+			break // an integer at the start of a range like 1..10
+		}
+		tok = token.Float
+		l.cursor++
+		if l.skipDigits() == 0 {
+			err = ErrFloatNoFraction
+			break
+		}
+		l.skipExponent()
+	case 'e', 'E':
+		if l.skipExponent() {
+			tok = token.Float
+			err = ErrFloatNoDot
+		}
+	}
+	return pos, tok, l.literal(), err
+}
+
+// skipDigits advances past decimal digits and returns how many there were.
+func (l *Lexer) skipDigits() int {
+	start := l.cursor
+	for isDigit(l.input[l.cursor]) {
+		l.cursor++
+	}
+	return l.cursor - start
+}
+
+// skipExponent advances past an exponent like e10 or E-3 if there is one.
+func (l *Lexer) skipExponent() bool {
+	if c := l.input[l.cursor]; c != 'e' && c != 'E' {
+		return false
+	}
+	i := l.cursor + 1
+	if c := l.input[i]; c == '+' || c == '-' {
+		i++
+	}
+	if !isDigit(l.input[i]) {
+		return false
+	}
+	l.cursor = i
+	l.skipDigits()
+	return true
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+func isAlnum(c byte) bool { return isDigit(c) || 'a' <= c|0x20 && c|0x20 <= 'z' }
+
+// digitVal returns the value of c as a digit in base 36.
+func digitVal(c byte) int {
+	if isDigit(c) {
+		return int(c - '0')
+	}
+	return int(c|0x20-'a') + 10
+}
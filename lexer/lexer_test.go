@@ -1,10 +1,16 @@
 package lexer
 
 import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/masp/garlang/internal/golden"
 	"github.com/masp/garlang/token"
+	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,6 +35,49 @@ func TestLex(t *testing.T) {
 				{Type: token.EOF},
 			},
 		},
+		{
+			input: "[1] -- [2] - -x",
+			expected: []Token{
+				{Type: token.LSquareBracket, Lit: "["},
+				{Type: token.Integer, Lit: "1"},
+				{Type: token.RSquareBracket, Lit: "]"},
+				{Type: token.MinusMinus, Lit: "--"},
+				{Type: token.LSquareBracket, Lit: "["},
+				{Type: token.Integer, Lit: "2"},
+				{Type: token.RSquareBracket, Lit: "]"},
+				{Type: token.Minus, Lit: "-"},
+				{Type: token.Minus, Lit: "-"},
+				{Type: token.Identifier, Lit: "x"},
+				{Type: token.EOF},
+			},
+		},
+		{
+			input: "f(xs...) 1..10",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "f"},
+				{Type: token.LParen, Lit: "("},
+				{Type: token.Identifier, Lit: "xs"},
+				{Type: token.Ellipsis, Lit: "..."},
+				{Type: token.RParen, Lit: ")"},
+				{Type: token.Integer, Lit: "1"},
+				{Type: token.DotDot, Lit: ".."},
+				{Type: token.Integer, Lit: "10"},
+				{Type: token.EOF},
+			},
+		},
+		// Erlang number forms
+		{
+			input: "0 1.0 16#ff 2#101 2.5e-3 1.0E10",
+			expected: []Token{
+				{Type: token.Integer, Lit: "0"},
+				{Type: token.Float, Lit: "1.0"},
+				{Type: token.Integer, Lit: "16#ff"},
+				{Type: token.Integer, Lit: "2#101"},
+				{Type: token.Float, Lit: "2.5e-3"},
+				{Type: token.Float, Lit: "1.0E10"},
+				{Type: token.EOF},
+			},
+		},
 		{
 			input: "foo bar",
 			expected: []Token{
@@ -116,6 +165,27 @@ func TestLex(t *testing.T) {
 				{Type: token.EOF},
 			},
 		},
+		{
+			input: "a % b",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.Percent, Lit: "%"},
+				{Type: token.Identifier, Lit: "b"},
+				{Type: token.EOF},
+			},
+		},
+		// Exact equality
+		{
+			input: "a === b !== c",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.EqualEqualEqual, Lit: "==="},
+				{Type: token.Identifier, Lit: "b"},
+				{Type: token.BangEqualEqual, Lit: "!=="},
+				{Type: token.Identifier, Lit: "c"},
+				{Type: token.EOF},
+			},
+		},
 		// Comparison tests
 		{
 			input: `foo == bar; foo != bar; foo < bar; foo > bar; foo <= bar; foo >= bar;`,
@@ -147,6 +217,264 @@ func TestLex(t *testing.T) {
 				{Type: token.EOF},
 			},
 		},
+		// nil keyword
+		{
+			input: "nil nilly ni",
+			expected: []Token{
+				{Type: token.Nil, Lit: "nil"},
+				{Type: token.Identifier, Lit: "nilly"},
+				{Type: token.Identifier, Lit: "ni"},
+				{Type: token.EOF},
+			},
+		},
+		{
+			input: "const Pi = 3.14",
+			expected: []Token{
+				{Type: token.Const, Lit: "const"},
+				{Type: token.Identifier, Lit: "Pi"},
+				{Type: token.Equal, Lit: "="},
+				{Type: token.Float, Lit: "3.14"},
+				{Type: token.EOF},
+			},
+		},
+		// guard keyword
+		{
+			input: "when whenever wh while",
+			expected: []Token{
+				{Type: token.When, Lit: "when"},
+				{Type: token.Identifier, Lit: "whenever"},
+				{Type: token.Identifier, Lit: "wh"},
+				{Type: token.While, Lit: "while"},
+				{Type: token.EOF},
+			},
+		},
+		// case clauses
+		{
+			input: "case cases ca const a -> -b",
+			expected: []Token{
+				{Type: token.Case, Lit: "case"},
+				{Type: token.Identifier, Lit: "cases"},
+				{Type: token.Identifier, Lit: "ca"},
+				{Type: token.Const, Lit: "const"},
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.Arrow, Lit: "->"},
+				{Type: token.Minus, Lit: "-"},
+				{Type: token.Identifier, Lit: "b"},
+				{Type: token.EOF},
+			},
+		},
+		// fun expression
+		{
+			input: "fn fns f func is isnt",
+			expected: []Token{
+				{Type: token.Fn, Lit: "fn"},
+				{Type: token.Identifier, Lit: "fns"},
+				{Type: token.Identifier, Lit: "f"},
+				{Type: token.Func, Lit: "func"},
+				{Type: token.Is, Lit: "is"},
+				{Type: token.Identifier, Lit: "isnt"},
+				{Type: token.EOF},
+			},
+		},
+		// guard declaration
+		{
+			input: "guard guards gu g",
+			expected: []Token{
+				{Type: token.Guard, Lit: "guard"},
+				{Type: token.Identifier, Lit: "guards"},
+				{Type: token.Identifier, Lit: "gu"},
+				{Type: token.Identifier, Lit: "g"},
+				{Type: token.EOF},
+			},
+		},
+		// catch expression
+		{
+			input: "catch catches cat case",
+			expected: []Token{
+				{Type: token.CatchKeyword, Lit: "catch"},
+				{Type: token.Identifier, Lit: "catches"},
+				{Type: token.Identifier, Lit: "cat"},
+				{Type: token.Case, Lit: "case"},
+				{Type: token.EOF},
+			},
+		},
+		// receive expression
+		{
+			input: "receive receiver rec return",
+			expected: []Token{
+				{Type: token.Receive, Lit: "receive"},
+				{Type: token.Identifier, Lit: "receiver"},
+				{Type: token.Identifier, Lit: "rec"},
+				{Type: token.Return, Lit: "return"},
+				{Type: token.EOF},
+			},
+		},
+		// boolean operators
+		{
+			input: "and andalso andals or orelse orelsewhere an o not nots no nil",
+			expected: []Token{
+				{Type: token.And, Lit: "and"},
+				{Type: token.AndAlso, Lit: "andalso"},
+				{Type: token.Identifier, Lit: "andals"},
+				{Type: token.Or, Lit: "or"},
+				{Type: token.OrElse, Lit: "orelse"},
+				{Type: token.Identifier, Lit: "orelsewhere"},
+				{Type: token.Identifier, Lit: "an"},
+				{Type: token.Identifier, Lit: "o"},
+				{Type: token.Not, Lit: "not"},
+				{Type: token.Identifier, Lit: "nots"},
+				{Type: token.Identifier, Lit: "no"},
+				{Type: token.Nil, Lit: "nil"},
+				{Type: token.EOF},
+			},
+		},
+		// conditionals
+		{
+			input: "if else elsewhere els e",
+			expected: []Token{
+				{Type: token.If, Lit: "if"},
+				{Type: token.Else, Lit: "else"},
+				{Type: token.Identifier, Lit: "elsewhere"},
+				{Type: token.Identifier, Lit: "els"},
+				{Type: token.Identifier, Lit: "e"},
+				{Type: token.EOF},
+			},
+		},
+		// receive timeout
+		{
+			input: "after afters aft",
+			expected: []Token{
+				{Type: token.After, Lit: "after"},
+				{Type: token.Identifier, Lit: "afters"},
+				{Type: token.Identifier, Lit: "aft"},
+				{Type: token.EOF},
+			},
+		},
+		// let expression
+		{
+			input: "let x = 1 in lets inner",
+			expected: []Token{
+				{Type: token.Let, Lit: "let"},
+				{Type: token.Identifier, Lit: "x"},
+				{Type: token.Equal, Lit: "="},
+				{Type: token.Integer, Lit: "1"},
+				{Type: token.In, Lit: "in"},
+				{Type: token.Identifier, Lit: "lets"},
+				{Type: token.Identifier, Lit: "inner"},
+				{Type: token.EOF},
+			},
+		},
+		// ranges
+		{
+			input: "1..10 a..b 1.5",
+			expected: []Token{
+				{Type: token.Integer, Lit: "1"},
+				{Type: token.DotDot, Lit: ".."},
+				{Type: token.Integer, Lit: "10"},
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.DotDot, Lit: ".."},
+				{Type: token.Identifier, Lit: "b"},
+				{Type: token.Float, Lit: "1.5"},
+				{Type: token.EOF},
+			},
+		},
+		// quoted identifiers
+		{
+			input: "`weird name` = `receive`(`a\\tb`)",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "weird name"},
+				{Type: token.Equal, Lit: "="},
+				{Type: token.Identifier, Lit: "receive"},
+				{Type: token.LParen, Lit: "("},
+				{Type: token.Identifier, Lit: "a\tb"},
+				{Type: token.RParen, Lit: ")"},
+				{Type: token.EOF},
+			},
+		},
+		// String interpolation
+		{
+			input: `"hello #{name}, #{n} #{"x#{y}"}!"` + "\n",
+			expected: []Token{
+				{Type: token.InterpHead, Lit: "hello "},
+				{Type: token.Identifier, Lit: "name"},
+				{Type: token.InterpMid, Lit: ", "},
+				{Type: token.Identifier, Lit: "n"},
+				{Type: token.InterpMid, Lit: " "},
+				{Type: token.InterpHead, Lit: "x"},
+				{Type: token.Identifier, Lit: "y"},
+				{Type: token.InterpTail, Lit: ""},
+				{Type: token.InterpTail, Lit: "!"},
+				{Type: token.Semicolon, Lit: "\n"},
+				{Type: token.EOF},
+			},
+		},
+		{
+			// braces inside the interpolation and escaped interpolations
+			input: `"#{f({1})} \#{b} # 'c#{d}'" '#{e}'`,
+			expected: []Token{
+				{Type: token.InterpHead, Lit: ""},
+				{Type: token.Identifier, Lit: "f"},
+				{Type: token.LParen, Lit: "("},
+				{Type: token.LCurlyBracket, Lit: "{"},
+				{Type: token.Integer, Lit: "1"},
+				{Type: token.RCurlyBracket, Lit: "}"},
+				{Type: token.RParen, Lit: ")"},
+				{Type: token.InterpMid, Lit: " #{b} # 'c"},
+				{Type: token.Identifier, Lit: "d"},
+				{Type: token.InterpTail, Lit: "'"},
+				{Type: token.Atom, Lit: "#{e}"},
+				{Type: token.EOF},
+			},
+		},
+		// List cons
+		{
+			input: "[h | t]",
+			expected: []Token{
+				{Type: token.LSquareBracket, Lit: "["},
+				{Type: token.Identifier, Lit: "h"},
+				{Type: token.Pipe, Lit: "|"},
+				{Type: token.Identifier, Lit: "t"},
+				{Type: token.RSquareBracket, Lit: "]"},
+				{Type: token.EOF},
+			},
+		},
+		// Ternary
+		{
+			input: "a ? b : c",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.Question, Lit: "?"},
+				{Type: token.Identifier, Lit: "b"},
+				{Type: token.Colon, Lit: ":"},
+				{Type: token.Identifier, Lit: "c"},
+				{Type: token.EOF},
+			},
+		},
+		// Pin
+		{
+			input: "{^x, y}",
+			expected: []Token{
+				{Type: token.LCurlyBracket, Lit: "{"},
+				{Type: token.Caret, Lit: "^"},
+				{Type: token.Identifier, Lit: "x"},
+				{Type: token.Comma, Lit: ","},
+				{Type: token.Identifier, Lit: "y"},
+				{Type: token.RCurlyBracket, Lit: "}"},
+				{Type: token.EOF},
+			},
+		},
+		// Annotation
+		{
+			input: "@deprecated(\"use g\")",
+			expected: []Token{
+				{Type: token.At, Lit: "@"},
+				{Type: token.Identifier, Lit: "deprecated"},
+				{Type: token.LParen, Lit: "("},
+				{Type: token.String, Lit: "use g"},
+				{Type: token.RParen, Lit: ")"},
+				{Type: token.EOF},
+			},
+		},
 		// Comments
 		{
 			input: `// This is a comment
@@ -192,11 +520,40 @@ func TestLexErrors(t *testing.T) {
 	}{
 		{
 			input:    "func main() { test = \"hello world }",
-			expected: "<test>:1:22: unterminated string",
+			expected: "<test>:1:22: unterminated string literal",
 		},
 		{
 			input:    "'0",
-			expected: "<test>:1:1: unterminated string",
+			expected: "<test>:1:1: unterminated atom literal",
+		},
+		{
+			input:    "a = 1\nb = 'abc\nc = 2",
+			expected: "<test>:2:5: unterminated atom literal",
+		},
+		{
+			input:    "`weird name",
+			expected: "<test>:1:1: unterminated quoted identifier",
+		},
+		{
+			// backticks don't start raw strings anymore
+			input:    "`raw",
+			expected: "<test>:1:1: unterminated quoted identifier",
+		},
+		{
+			input:    "f(``)",
+			expected: "<test>:1:3: quoted identifier cannot be empty",
+		},
+		{
+			input:    "x = 'caf\xe9'",
+			expected: "<test>:1:5: invalid UTF-8 encoding",
+		},
+		{
+			input:    "x = ab\xffc",
+			expected: "<test>:1:5: invalid UTF-8 encoding",
+		},
+		{
+			input:    "x = €",
+			expected: "<test>:1:5: unrecognized token",
 		},
 		// Unterminated multiline comment
 		{
@@ -227,6 +584,60 @@ func TestLexErrors(t *testing.T) {
 	}
 }
 
+func TestLexUnterminated(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Token
+	}{
+		{
+			input: "a = \"hello\nb",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.Equal, Lit: "="},
+				{Type: token.String, Lit: "hello"},
+				{Type: token.Semicolon, Lit: "\n"},
+				{Type: token.Identifier, Lit: "b"},
+				{Type: token.EOF},
+			},
+		},
+		{
+			input: "a = 'hello",
+			expected: []Token{
+				{Type: token.Identifier, Lit: "a"},
+				{Type: token.Equal, Lit: "="},
+				{Type: token.Atom, Lit: "hello"},
+				{Type: token.EOF},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lex := NewLexer("<test>", []byte(test.input))
+			for _, expected := range test.expected {
+				tok := lex.NextToken()
+				require.Equal(t, expected.Type.String(), tok.Type.String())
+				require.Equal(t, expected.Lit, tok.Lit)
+			}
+			require.True(t, lex.HasErrors())
+			require.Equal(t, 5, lex.Errors()[0].Pos.Column, "error should point at the opening quote")
+		})
+	}
+}
+
+func TestDump(t *testing.T) {
+	src := `module dump
+
+// add two numbers
+func add(a, b) {
+	return a + b
+}`
+	var out bytes.Buffer
+	require.NoError(t, Dump(&out, []byte(src)))
+	g := goldie.New(t)
+	g.Assert(t, "dump.tokens", out.Bytes())
+}
+
 func FuzzLex(f *testing.F) {
 	f.Add([]byte("foo"))
 	f.Add([]byte("foo bar"))
@@ -246,3 +657,224 @@ func FuzzLex(f *testing.F) {
 		}
 	})
 }
+
+func TestLexBadNumber(t *testing.T) {
+	tests := []struct {
+		input   string
+		typ     token.Type
+		wantErr error
+	}{
+		{"1.", token.Float, ErrFloatNoFraction},
+		{".5", token.Float, ErrFloatNoInteger},
+		{"1e10", token.Float, ErrFloatNoDot},
+		{"37#1", token.Integer, ErrInvalidBase},
+		{"2#102", token.Integer, ErrInvalidDigit},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lex := NewLexer("<test>", []byte(test.input))
+			tok := lex.NextToken()
+			require.Equal(t, test.typ.String(), tok.Type.String())
+			require.Equal(t, test.input, tok.Lit)
+			require.Equal(t, token.EOF.String(), lex.NextToken().Type.String())
+			require.True(t, lex.HasErrors())
+			require.ErrorIs(t, lex.Errors()[0].Msg, test.wantErr)
+			require.Equal(t, 1, lex.Errors()[0].Pos.Column)
+		})
+	}
+}
+
+func TestLexIndentation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Type
+	}{
+		{
+			// nested blocks, closed one at a time and all at once at the end
+			input: "a\n  b\n    c\n  d\n    e",
+			expected: []token.Type{
+				token.Identifier, token.Semicolon,
+				token.Indent, token.Identifier, token.Semicolon,
+				token.Indent, token.Identifier, token.Semicolon,
+				token.Dedent, token.Identifier, token.Semicolon,
+				token.Indent, token.Identifier,
+				token.Dedent, token.Dedent, token.EOF,
+			},
+		},
+		{
+			// blank and comment-only lines don't change the indentation
+			input: "a\n  b\n\n   \n// comment\n  c\nd",
+			expected: []token.Type{
+				token.Identifier, token.Semicolon,
+				token.Indent, token.Identifier, token.Semicolon,
+				token.Comment,
+				token.Identifier, token.Semicolon,
+				token.Dedent, token.Identifier, token.EOF,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lex := NewLexerOptions("<test>", []byte(test.input), Options{Indentation: true})
+			var got []string
+			for {
+				tok := lex.NextToken()
+				got = append(got, tok.Type.String())
+				if tok.Type == token.EOF {
+					break
+				}
+			}
+			var want []string
+			for _, typ := range test.expected {
+				want = append(want, typ.String())
+			}
+			require.Equal(t, want, got)
+			require.False(t, lex.HasErrors())
+		})
+	}
+
+	// the default mode never emits indentation tokens
+	tokens, err := Lex([]byte("a\n  b\nc"))
+	require.NoError(t, err)
+	for _, tok := range tokens {
+		require.NotEqual(t, token.Indent, tok.Type)
+		require.NotEqual(t, token.Dedent, tok.Type)
+	}
+}
+
+func TestLexBadDedent(t *testing.T) {
+	lex := NewLexerOptions("<test>", []byte("a\n    b\n  c"), Options{Indentation: true})
+	lex.All()
+	require.True(t, lex.HasErrors())
+	require.ErrorIs(t, lex.Errors()[0].Msg, ErrBadDedent)
+	require.Equal(t, 3, lex.Errors()[0].Pos.Line)
+}
+
+func TestLexTooLong(t *testing.T) {
+	input := "x = " + strings.Repeat("a", DefaultMaxLiteralLen+1)
+	_, err := Lex([]byte(input))
+	require.EqualError(t, err, "<string>:1:5: identifier too long")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "abcd + `abcd` + 'abcd' + \"abcd\""},
+		{input: "abcde", expected: "<test>:1:1: identifier too long"},
+		{input: "x = `ab cde`", expected: "<test>:1:5: identifier too long"},
+		{input: "x = 'abcde'", expected: "<test>:1:5: atom too long"},
+		{input: "x = \"a\\tcde\"", expected: "<test>:1:5: string too long"},
+		{input: "x = \"ab #{x} abcde\"", expected: "<test>:1:12: string too long"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lex := NewLexerOptions("<test>", []byte(test.input), Options{MaxLiteralLen: 4})
+			lex.All()
+			if test.expected == "" {
+				require.False(t, lex.HasErrors())
+				return
+			}
+			require.EqualError(t, lex.Errors(), test.expected)
+		})
+	}
+
+	// the token keeps only as much of the literal as the limit allows
+	lex := NewLexerOptions("<test>", []byte("x = \"abcdéf\""), Options{MaxLiteralLen: 5})
+	require.Equal(t, "abcd", lex.All()[2].Lit, "é is not cut in half")
+
+	// like in Erlang, atoms and identifiers have at most 255 characters
+	atom := strings.Repeat("é", MaxAtomLen)
+	tokens, err := Lex([]byte("'" + atom + "' + " + atom))
+	require.NoError(t, err)
+	require.Equal(t, atom, tokens[0].Lit)
+	tokens, err = Lex([]byte("x = 'a" + atom + "'"))
+	require.EqualError(t, err, "<string>:1:5: atom too long")
+	require.Equal(t, "a"+atom[:len(atom)-len("é")], tokens[2].Lit)
+	_, err = Lex([]byte("x = a" + atom))
+	require.EqualError(t, err, "<string>:1:5: identifier too long")
+
+	lex = NewLexerOptions("<test>", []byte(input+" + a"+atom), Options{MaxLiteralLen: -1})
+	lex.All()
+	require.False(t, lex.HasErrors(), "a negative limit disables the checks")
+}
+
+func TestTokenPosition(t *testing.T) {
+	lex := NewLexer("test.gar", []byte("module m\n\nfunc f() {\n\treturn 'ok'\n}\n"))
+	var fn, ret Token
+	for _, tok := range lex.All() {
+		switch tok.Type {
+		case token.Func:
+			fn = tok
+		case token.Return:
+			ret = tok
+		}
+	}
+	require.Equal(t, "test.gar:3:1", fn.Position(lex.File()).String())
+	pos := ret.Position(lex.File())
+	require.Equal(t, 4, pos.Line)
+	require.Equal(t, 2, pos.Column)
+}
+
+func TestLexUnicode(t *testing.T) {
+	tokens, err := Lex([]byte("größe = 'ñandú' + café2 + 名前 + inné"))
+	require.NoError(t, err)
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, tok.Type.String()+" "+tok.Lit)
+	}
+	require.Equal(t, []string{
+		"Identifier größe", "Equal =", "Atom ñandú", "Plus +", "Identifier café2", "Plus +",
+		"Identifier 名前", "Plus +", "Identifier inné",
+	}, got)
+}
+
+func TestLexCaseInsensitiveKeywords(t *testing.T) {
+	input := "MODULE m; Func F() { Return `CASE` + 'Case' + Module.x }"
+	lit := func(tokens []Token) []string {
+		var got []string
+		for _, tok := range tokens {
+			got = append(got, tok.Type.String()+" "+tok.Lit)
+		}
+		return got
+	}
+
+	lex := NewLexerOptions("<test>", []byte(input), Options{CaseInsensitiveKeywords: true})
+	require.Equal(t, []string{
+		"Module module", "Identifier m", "Semicolon ;", "Func func", "Identifier F", "LeftParen (",
+		"RightParen )", "LeftBrace {", "Return return", "Identifier CASE", "Plus +", "Atom Case",
+		"Plus +", "Module module", "Period .", "Identifier x", "RightBrace }",
+	}, lit(lex.All()))
+	require.False(t, lex.HasErrors())
+
+	// keywords are case-sensitive by default
+	tokens, err := Lex([]byte("MODULE m; Func f"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"Identifier MODULE", "Identifier m", "Semicolon ;", "Identifier Func", "Identifier f",
+	}, lit(tokens))
+}
+
+func TestNoOrphanFixtures(t *testing.T) {
+	golden.CheckOrphans(t)
+}
+
+// TestGenerated checks that garlang.go is what re2go makes of garlang.re, so the
+// generated lexer isn't edited by hand. It needs re2go, which most machines don't have.
+func TestGenerated(t *testing.T) {
+	re2go, err := exec.LookPath("re2go")
+	if err != nil {
+		t.Skip("re2go is not installed")
+	}
+	out := filepath.Join(t.TempDir(), "garlang.go")
+	cmd := exec.Command(re2go, "garlang.re", "-o", out, "-i", "--no-generation-date", "--no-version")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("re2go: %v\n%s", err, output)
+	}
+	want, err := os.ReadFile(out)
+	require.NoError(t, err)
+	got, err := os.ReadFile("garlang.go")
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(got), "garlang.go is out of date, run go generate ./lexer")
+}
@@ -0,0 +1,21 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/internal/bench"
+)
+
+func BenchmarkParseModule(b *testing.B) {
+	src := bench.Module(500)
+	if _, err := Module("bench.gar", src); err != nil {
+		b.Fatalf("parse: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Module("bench.gar", src)
+	}
+}
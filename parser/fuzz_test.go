@@ -11,6 +11,7 @@ func FuzzParse(f *testing.F) {
 	f.Add("module A(func A()10;")
 	f.Add("module A(func A()1\"\".")
 	f.Add("module A; func A()\n1()=")
+	f.Add("module m; func f() { a, 1 = g() = 2 }")
 
 	f.Fuzz(func(t *testing.T, input string) {
 		mod, _ := Module("<test>", []byte(input))
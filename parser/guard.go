@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/core"
+	"github.com/masp/garlang/token"
+)
+
+// checkGuard reports every part of test that isn't allowed in a guard, see CheckGuard.
+func (p *Parser) checkGuard(test ast.Expression) {
+	CheckGuard(test, nil, p.error)
+}
+
+// CheckGuard calls report for every part of test that isn't allowed in a guard. Like in
+// Erlang, a guard may only use operators, type tests and calls to the guard BIFs, with or
+// without the erlang module, so that evaluating it can't have side effects. isGuard
+// reports whether a call to any other local name is allowed too, like a guard declared
+// with `guard`, and may be nil.
+//
+// The compiler checks the guards of a module with it, so a guard means the same wherever
+// it is written.
+func CheckGuard(test ast.Expression, isGuard func(name string) bool, report func(pos token.Pos, err error)) {
+	ast.Inspect(test, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case nil, *ast.Identifier, *ast.IntLiteral, *ast.FloatLiteral, *ast.StringLiteral,
+			*ast.AtomLiteral, *ast.NilLiteral, *ast.ListExpr, *ast.TupleExpr, *ast.ParenExpr,
+			*ast.UnaryExpr, *ast.IndexExpr, *ast.BadExpr,
+			*ast.FuncRef: // which may be a division
+			return true
+		case *ast.BinaryExpr:
+			if n.Op == token.MinusMinus {
+				// like in Erlang, list operators are not guard expressions
+				report(n.OpPos, fmt.Errorf("'--' is not allowed in a guard"))
+				return false
+			}
+			return true
+		case *ast.TypeTestExpr:
+			CheckGuard(n.X, isGuard, report) // the type is not an expression
+			return false
+		case *ast.CallExpr:
+			if n.Ellipsis.IsValid() {
+				report(n.Ellipsis, fmt.Errorf("'...' is not allowed in a guard"))
+				return false
+			}
+			if !isGuardCallee(n.Callee, isGuard) {
+				report(n.Pos(), fmt.Errorf("call to %s/%d is not allowed in a guard", calleeName(n.Callee), len(n.Arguments)))
+				return false
+			}
+			for _, arg := range n.Arguments {
+				CheckGuard(arg, isGuard, report)
+			}
+			return false
+		default:
+			report(n.Pos(), fmt.Errorf("%s is not allowed in a guard", describe(n)))
+			return false
+		}
+	})
+}
+
+// isGuardCallee reports whether a guard may call callee, a guard BIF like `is_list` or
+// `erlang.is_list`, or a local name accepted by isGuard.
+func isGuardCallee(callee ast.Expression, isGuard func(name string) bool) bool {
+	switch callee := callee.(type) {
+	case *ast.Identifier:
+		return core.IsGuardBIF(callee.Name) || isGuard != nil && isGuard(callee.Name)
+	case *ast.DotExpr:
+		mod, ok := callee.Target.(*ast.Identifier)
+		return ok && mod.Name == "erlang" && core.IsGuardBIF(callee.Attribute.Name)
+	}
+	return false
+}
+
+// calleeName returns the name of a called function like `f` or `lists.map`, or "fun"
+// if the callee is any other expression.
+func calleeName(callee ast.Expression) string {
+	switch callee := callee.(type) {
+	case *ast.Identifier:
+		return callee.Name
+	case *ast.DotExpr:
+		if mod, ok := callee.Target.(*ast.Identifier); ok {
+			return mod.Name + "." + callee.Attribute.Name
+		}
+	}
+	return "fun"
+}
+
+// describe returns what node is in an error message, like "case expression".
+func describe(node ast.Node) string {
+	switch node.(type) {
+	case *ast.CaseExpr:
+		return "case expression"
+	case *ast.ReceiveExpr:
+		return "receive expression"
+	case *ast.LetExpr:
+		return "let expression"
+	case *ast.TernaryExpr:
+		return "'?' expression"
+	case *ast.CatchExpr:
+		return "catch expression"
+	case *ast.FuncLit:
+		return "fun"
+	case *ast.AssignExpr, *ast.MatchAssignExpr, *ast.MultiAssignExpr:
+		return "assignment"
+	case *ast.InterpString:
+		return "string interpolation"
+	case *ast.PinExpr:
+		return "'^'"
+	case *ast.DotExpr:
+		return "'.' expression"
+	default:
+		return fmt.Sprintf("%T", node)
+	}
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/masp/garlang/ast"
@@ -8,25 +9,82 @@ import (
 	"github.com/masp/garlang/token"
 )
 
-func Module(filename string, src []byte) (mod *ast.Module, err error) {
-	lex := lexer.NewLexer(filename, src)
-	mod = &ast.Module{File: lex.File()}
-	tokens := lex.All()
-	if lex.HasErrors() {
-		err = lex.Errors()
-		return
+// Error is returned by Module and Function when the source has syntax errors, so
+// callers can tell them apart from errors in later phases with errors.As. The errors
+// are sorted by position.
+type Error struct {
+	Errors token.ErrorList
+}
+
+func (e Error) Error() string { return e.Errors.Error() }
+func (e Error) Unwrap() error { return e.Errors }
+
+// Is reports whether any of the errors is target, like ErrBadModule.
+func (e Error) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err.Msg, target) {
+			return true
+		}
 	}
+	return false
+}
+
+// As finds the first of the errors that matches target, like a *HeaderError.
+func (e Error) As(target any) bool {
+	for _, err := range e.Errors {
+		if errors.As(err.Msg, target) {
+			return true
+		}
+	}
+	return false
+}
 
-	parser := &Parser{
-		file:   lex.File(),
-		tokens: tokens,
+// HeaderPart is a part of the module header, `module name;`.
+type HeaderPart int
+
+const (
+	HeaderKeyword   HeaderPart = iota // the 'module' keyword
+	HeaderName                        // the module name after the keyword
+	HeaderSegment                     // a name after '.' in a dotted module name
+	HeaderSemicolon                   // the ';' after the name
+)
+
+// HeaderError is reported when the module header is malformed, and records which part of
+// the header was expected where. It is ErrBadModule according to errors.Is, and can be
+// found in the errors returned by Module with errors.As.
+type HeaderError struct {
+	Expected HeaderPart
+	Pos      token.Position // of the token found instead
+	Got      string         // the token found instead, like "{" or "EOF"
+}
+
+func (e *HeaderError) Error() string {
+	var expected string
+	switch e.Expected {
+	case HeaderKeyword:
+		expected = "expected 'module' keyword at start of file"
+	case HeaderName:
+		expected = "expected module name after 'module' keyword"
+	case HeaderSegment:
+		expected = "expected name after '.' in module name"
+	default:
+		expected = "expected ';' after module name"
 	}
+	return fmt.Sprintf("%s, got %s", expected, e.Got)
+}
+
+func (e *HeaderError) Is(target error) bool { return target == ErrBadModule }
+
+func Module(filename string, src []byte, opts ...Option) (mod *ast.Module, err error) {
+	lex := lexer.NewLexer(filename, src)
+	mod = &ast.Module{File: lex.File()}
+	parser := newParser(lex, opts)
 
 	defer func() {
-		errlist := parser.catchErrors()
+		errlist := parser.catchErrors(recover())
 		errlist.Sort()
 		if errlist.Len() > 0 {
-			err = errlist.Err()
+			err = Error{Errors: errlist}
 		}
 	}()
 
@@ -42,19 +100,32 @@ func Module(filename string, src []byte) (mod *ast.Module, err error) {
 			break
 		}
 
+		// a declaration under an unsatisfied //+build directive is parsed, so syntax
+		// errors are still reported, but left out of the module
+		keep, ndecls := parser.satisfied(), len(mod.Decls)
 		switch tok.Type {
 		case token.Func:
 			mod.Decls = append(mod.Decls, parser.parseFunction())
-			if !parser.matches(token.EOF) {
-				parser.eatOnly(token.Semicolon, "expected ';' after function declaration")
-			}
+			parser.endDecl("function")
 		case token.TypeKeyword:
 			mod.Decls = append(mod.Decls, parser.parseTypeDecl())
-			if !parser.matches(token.EOF) {
-				parser.eatOnly(token.Semicolon, "expected ';' after type declaration")
+			parser.endDecl("type")
+		case token.Const:
+			mod.Decls = append(mod.Decls, parser.parseConstDecl())
+			parser.endDecl("constant")
+		case token.Guard:
+			mod.Decls = append(mod.Decls, parser.parseGuardDecl())
+			parser.endDecl("guard")
+		case token.At:
+			decl := parser.parseAnnotatedDecl()
+			mod.Decls = append(mod.Decls, decl)
+			if _, ok := decl.(*ast.TypeDecl); ok {
+				parser.endDecl("type")
+			} else {
+				parser.endDecl("function")
 			}
 		case token.Semicolon:
-			parser.eat()
+			parser.eatAll(token.Semicolon)
 			continue
 		default:
 			from := parser.eat() // skip next token
@@ -62,26 +133,81 @@ func Module(filename string, src []byte) (mod *ast.Module, err error) {
 			to := parser.advance(declStart)
 			mod.Decls = append(mod.Decls, &ast.BadDecl{From: from.Pos, To: to.Pos})
 		}
+		if !keep {
+			mod.Decls = mod.Decls[:ndecls]
+		}
 	}
 	return
 }
 
-func Function(src []byte) (function *ast.FuncDecl, err error) {
+// Expression parses src as a single expression, like an expression typed into a shell.
+// file holds the lines of src, so the positions in expr can be reported.
+func Expression(src []byte, opts ...Option) (expr ast.Expression, file *token.File, err error) {
 	lex := lexer.NewLexer("<string>", src)
-	tokens := lex.All()
-	if lex.HasErrors() {
-		return nil, lex.Errors()
+	parser := newParser(lex, opts)
+	defer func() {
+		errlist := parser.catchErrors(recover())
+		errlist.Sort()
+		if errlist.Len() > 0 {
+			err = Error{Errors: errlist}
+		}
+	}()
+	expr = parser.parseExpression()
+	parser.eatAll(token.Semicolon)
+	if tok := parser.peek(); tok.Type != token.EOF {
+		parser.error(tok.Pos, fmt.Errorf("unexpected %s after expression", tok.String()))
+	}
+	return expr, lex.File(), err
+}
+
+// Guard parses src as a guard sequence without 'when', like `x > 0, x < 10; x == -1`,
+// and checks that it only uses what is allowed in a guard. The guard is returned as a
+// single expression where ',' is 'andalso' and ';' is 'orelse', so it can be compiled
+// like any expression.
+func Guard(src []byte, opts ...Option) (guard ast.Expression, err error) {
+	parser := newParser(lexer.NewLexer("<string>", src), opts)
+	defer func() {
+		errlist := parser.catchErrors(recover())
+		errlist.Sort()
+		if errlist.Len() > 0 {
+			err = Error{Errors: errlist}
+		}
+	}()
+	guard = parser.parseGuardExpr()
+	parser.eatAll(token.Semicolon)
+	if tok := parser.peek(); tok.Type != token.EOF {
+		parser.error(tok.Pos, fmt.Errorf("unexpected %s after guard", tok.String()))
 	}
+	parser.checkGuard(guard)
+	return guard, err
+}
 
-	parser := &Parser{
-		tokens: tokens,
-		file:   lex.File(),
+// Type parses src as a single type, like `int`, `lists.t` or `tuple[int, string]`, so
+// type annotations can be checked on their own.
+func Type(src []byte, opts ...Option) (typ ast.Expression, err error) {
+	parser := newParser(lexer.NewLexer("<string>", src), opts)
+	defer func() {
+		errlist := parser.catchErrors(recover())
+		errlist.Sort()
+		if errlist.Len() > 0 {
+			err = Error{Errors: errlist}
+		}
+	}()
+	typ = parser.parseType()
+	parser.eatAll(token.Semicolon)
+	if tok := parser.peek(); tok.Type != token.EOF {
+		parser.error(tok.Pos, fmt.Errorf("unexpected %s after type", tok.String()))
 	}
+	return typ, err
+}
+
+func Function(src []byte, opts ...Option) (function *ast.FuncDecl, err error) {
+	parser := newParser(lexer.NewLexer("<string>", src), opts)
 	defer func() {
-		errlist := parser.catchErrors()
+		errlist := parser.catchErrors(recover())
 		errlist.Sort()
 		if errlist.Len() > 0 {
-			err = errlist.Err()
+			err = Error{Errors: errlist}
 		}
 	}()
 	fn := parser.parseFunction()
@@ -4,13 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/masp/garlang/ast"
 	"github.com/masp/garlang/lexer"
 	"github.com/masp/garlang/token"
 )
 
-const maxErrors = 10
+// defaultMaxErrors is the number of errors reported before the parser gives up.
+const defaultMaxErrors = 10
 
 var (
 	ErrBailout   = errors.New("too many errors")
@@ -19,8 +21,12 @@ var (
 
 var (
 	declStart = map[token.Type]bool{
-		token.EOF:  true,
-		token.Func: true,
+		token.EOF:         true,
+		token.Func:        true,
+		token.TypeKeyword: true,
+		token.Const:       true,
+		token.Guard:       true,
+		token.At:          true,
 	}
 
 	exprEnd = map[token.Type]bool{
@@ -33,21 +39,70 @@ var (
 
 	stmtStart = map[token.Type]bool{
 		token.Return:        true,
+		token.While:         true,
+		token.If:            true,
+		token.Defer:         true,
 		token.Identifier:    true, // assignment
 		token.LCurlyBracket: true, // block/tuple
 	}
 
 	paramStart = map[token.Type]bool{
-		token.Identifier: true,
+		token.Identifier:     true,
+		token.LSquareBracket: true, // list pattern
+		token.LCurlyBracket:  true, // tuple pattern
 	}
 )
 
+// lowestPrec is the precedence of the binary operators that bind the loosest.
+const lowestPrec = 1
+
 type Parser struct {
 	tokens []lexer.Token
 	file   *token.File
 	pos    int
 
-	errors token.ErrorList
+	errors    token.ErrorList
+	maxErrors int             // 0 reports every error
+	tags      map[string]bool // build tags that are defined, see WithTags
+}
+
+// Option configures the parser used by Module and Function.
+type Option func(*Parser)
+
+// WithMaxErrors sets the number of errors reported before parsing gives up, which is 10
+// by default. An IDE can raise it to report every error in a file in one pass, and 0
+// means there is no limit.
+func WithMaxErrors(n int) Option {
+	return func(p *Parser) {
+		p.maxErrors = n
+	}
+}
+
+// WithTags defines the build tags that `//+build` directives are checked against. A
+// directive gates the declaration after it, which is skipped unless one of the tags
+// listed in the directive is defined, or a tag written as !tag is not. Without the
+// option no tags are defined.
+func WithTags(tags ...string) Option {
+	return func(p *Parser) {
+		p.tags = make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			p.tags[tag] = true
+		}
+	}
+}
+
+func newParser(lex *lexer.Lexer, opts []Option) *Parser {
+	// the lexer recovers from bad tokens, so keep parsing to report as many errors as possible
+	p := &Parser{
+		file:      lex.File(),
+		tokens:    lex.All(),
+		errors:    lex.Errors(),
+		maxErrors: defaultMaxErrors,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 func (p *Parser) advance(to map[token.Type]bool) (tok lexer.Token) {
@@ -102,6 +157,65 @@ func (p *Parser) peek() (tok lexer.Token) {
 	return lexer.Token{Type: token.EOF}
 }
 
+// leadComment returns the comments directly before the next token, which document it
+// like in Go. Only comments on consecutive lines that end on the line before the token
+// are included, so a blank line separates a doc comment from other comments.
+func (p *Parser) leadComment() *ast.CommentGroup {
+	end := p.pos
+	for end < len(p.tokens) && p.tokens[end].Type == token.Comment {
+		end++
+	}
+	if end == p.pos || end == len(p.tokens) {
+		return nil
+	}
+	next := p.file.Line(p.tokens[end].Pos) // line the comment before must end on
+	start := end
+	for start > p.pos {
+		tok := p.tokens[start-1]
+		line := p.file.Line(tok.Pos)
+		if line+strings.Count(tok.Lit, "\n") != next-1 {
+			break
+		}
+		next = line
+		start--
+	}
+	if start == end {
+		return nil
+	}
+	group := &ast.CommentGroup{}
+	for _, tok := range p.tokens[start:end] {
+		group.List = append(group.List, &ast.Comment{Slash: tok.Pos, Text: tok.Lit})
+	}
+	return group
+}
+
+// buildDirective is the prefix of a comment that gates the declaration after it.
+const buildDirective = "//+build"
+
+// satisfied reports whether the `//+build` directives in the comments before the next
+// token are satisfied by the tags defined with WithTags. Like in Go, the tags on one
+// line are alternatives and every line must be satisfied.
+func (p *Parser) satisfied() bool {
+	for i := p.pos; i < len(p.tokens) && p.tokens[i].Type == token.Comment; i++ {
+		text := p.tokens[i].Lit
+		if !strings.HasPrefix(text, buildDirective+" ") {
+			continue
+		}
+		ok := false
+		for _, tag := range strings.Fields(text[len(buildDirective):]) {
+			if strings.HasPrefix(tag, "!") {
+				ok = ok || !p.tags[tag[1:]]
+			} else {
+				ok = ok || p.tags[tag]
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) matches(types ...token.Type) bool {
 	for _, t := range types {
 		if p.peek().Type == t {
@@ -111,20 +225,48 @@ func (p *Parser) matches(types ...token.Type) bool {
 	return false
 }
 
+// error reports err at pos. The EOF token has no position, so errors at the end of the
+// input are reported at the end of the last token instead.
 func (p *Parser) error(pos token.Pos, err error) {
+	if pos == token.NoPos {
+		pos = p.lastEnd()
+	}
 	epos := p.file.Position(pos)
 	n := len(p.errors)
 	if n > 0 && p.errors[n-1].Pos.Line == epos.Line {
 		return // discard - likely a spurious error
 	}
-	if len(p.errors) > maxErrors {
+	if p.maxErrors > 0 && len(p.errors) >= p.maxErrors {
 		panic(ErrBailout)
 	}
 	p.errors.Add(epos, err)
 }
 
-func (p *Parser) catchErrors() token.ErrorList {
-	if r := recover(); r != nil {
+// lastEnd returns the end of the last token before the current position, ignoring
+// comments and inserted semicolons.
+func (p *Parser) lastEnd() token.Pos {
+	i := p.pos
+	if i > len(p.tokens) {
+		i = len(p.tokens)
+	}
+	for i--; i >= 0; i-- {
+		tok := p.tokens[i]
+		if tok.Type == token.Comment || (tok.Type == token.Semicolon && tok.Lit == "\n") {
+			continue
+		}
+		if end := tok.End(); end < p.file.Pos(p.file.Size) {
+			return end
+		}
+		return p.file.Pos(p.file.Size) // an unterminated string, for one
+	}
+	return token.NoPos
+}
+
+// catchErrors returns the errors found so far after recovering r, which must be the
+// result of recover in a deferred function since recover does nothing when called from
+// catchErrors itself. Any panic other than ErrBailout is a bug and is raised again.
+func (p *Parser) catchErrors(r any) token.ErrorList {
+	if r != nil {
 		if r == ErrBailout {
 			return p.errors
 		} else {
@@ -134,20 +276,41 @@ func (p *Parser) catchErrors() token.ErrorList {
 	return p.errors
 }
 
+// parseModuleHeader parses `module name;`, or a dotted name like `module a.b;`. If the
+// keyword or name is malformed the rest of the file is not parsed, and the *HeaderError
+// is returned as well as reported.
 func (p *Parser) parseModuleHeader(mod *ast.Module, file *token.File) error {
-	if tok := p.eatOnly(token.Module, "expected 'module' keyword at start of file"); tok.Type != token.Module {
+	if _, err := p.expectHeader(token.Module, HeaderKeyword); err != nil {
 		p.advance(declStart)
-		return ErrBadModule
+		return err
 	}
-	name := p.eatOnly(token.Identifier, "expected module name after 'module' keyword")
-	if name.Type != token.Identifier {
+	name, err := p.expectHeader(token.Identifier, HeaderName)
+	if err != nil {
 		p.advance(declStart)
-		return ErrBadModule
+		return err
 	}
 	mod.Id = ast.NewIdent(name)
+	if p.matches(token.Period) {
+		// a dotted name like a.b.c is a single Erlang module named 'a.b.c'
+		mod.Segments = []*ast.Identifier{mod.Id}
+		for p.matches(token.Period) {
+			p.eat()
+			seg, err := p.expectHeader(token.Identifier, HeaderSegment)
+			if err != nil {
+				p.advance(declStart)
+				return err
+			}
+			mod.Segments = append(mod.Segments, ast.NewIdent(seg))
+		}
+		names := make([]string, len(mod.Segments))
+		for i, seg := range mod.Segments {
+			names[i] = seg.Name
+		}
+		mod.Id = &ast.Identifier{NamePos: name.Pos, Name: strings.Join(names, ".")}
+	}
 
 	if !p.matches(token.Semicolon, token.EOF) {
-		p.eatOnly(token.Semicolon, "expected ';' after module name")
+		p.expectHeader(token.Semicolon, HeaderSemicolon) // the declarations can still be parsed
 	}
 	p.eatAll(token.Semicolon)
 
@@ -155,6 +318,31 @@ func (p *Parser) parseModuleHeader(mod *ast.Module, file *token.File) error {
 	return nil
 }
 
+// expectHeader eats the next token, which must be of type typ, or reports a *HeaderError
+// for the part of the header it should have been and returns it.
+func (p *Parser) expectHeader(typ token.Type, part HeaderPart) (lexer.Token, error) {
+	tok := p.eat()
+	if tok.Type == typ {
+		return tok, nil
+	}
+	pos := tok.Pos
+	if pos == token.NoPos {
+		pos = p.lastEnd()
+	}
+	err := &HeaderError{Expected: part, Pos: p.file.Position(pos), Got: tok.String()}
+	p.error(pos, err)
+	return tok, err
+}
+
+// endDecl eats the ';' after a top-level declaration of the given kind, unless it is the
+// last one in the file. Like in a body, any extra semicolons after it are ignored.
+func (p *Parser) endDecl(kind string) {
+	if !p.matches(token.EOF) {
+		p.eatOnly(token.Semicolon, "expected ';' after %s declaration", kind)
+	}
+	p.eatAll(token.Semicolon)
+}
+
 func (p *Parser) parseImports(mod *ast.Module) []*ast.ImportDecl {
 	var imports []*ast.ImportDecl
 	for p.matches(token.Import) {
@@ -165,10 +353,7 @@ func (p *Parser) parseImports(mod *ast.Module) []*ast.ImportDecl {
 
 		if imp, ok := imp.(*ast.ImportDecl); ok {
 			imports = append(imports, imp)
-			if !p.matches(token.Semicolon, token.EOF) {
-				p.eatOnly(token.Semicolon, "expected ';' after import declaration")
-			}
-			p.eatAll(token.Semicolon)
+			p.endDecl("import")
 		}
 	}
 	return imports
@@ -192,11 +377,111 @@ func (p *Parser) parseImport(mod *ast.Module) ast.Decl {
 		return &ast.BadDecl{From: importTok.Pos, To: to.Pos}
 	}
 
-	return &ast.ImportDecl{
+	imp := &ast.ImportDecl{
 		Import: importTok.Pos,
 		Alias:  alias,
 		Path:   &ast.StringLiteral{QuotePos: path.Pos, Value: path.Lit},
 	}
+	if p.matches(token.LParen) {
+		imp.LParen = p.eat().Pos
+		for !p.matches(token.RParen, token.EOF) {
+			fn, ok := p.parseImportedFunc()
+			if !ok {
+				to := p.advance(declStart)
+				return &ast.BadDecl{From: importTok.Pos, To: to.Pos}
+			}
+			imp.Funcs = append(imp.Funcs, fn)
+			if !p.matches(token.RParen) {
+				p.eatOnly(token.Comma, "expected ',' or ')' after imported function")
+			}
+		}
+		rparen := p.eatOnly(token.RParen, "expected ')' to end imported functions")
+		if rparen.Type != token.RParen {
+			to := p.advance(declStart)
+			return &ast.BadDecl{From: importTok.Pos, To: to.Pos}
+		}
+		imp.RParen = rparen.Pos
+	}
+	return imp
+}
+
+// parseImportedFunc parses a function and its arity in an import, like `foo/1`.
+func (p *Parser) parseImportedFunc() (*ast.ImportedFunc, bool) {
+	name := p.eatOnly(token.Identifier, "expected function name in import")
+	if name.Type != token.Identifier {
+		return nil, false
+	}
+	slash := p.eatOnly(token.Slash, "expected '/' and arity after imported function %s", name.Lit)
+	if slash.Type != token.Slash {
+		return nil, false
+	}
+	arity := p.eatOnly(token.Integer, "expected arity of imported function %s", name.Lit)
+	if arity.Type != token.Integer {
+		return nil, false
+	}
+	return &ast.ImportedFunc{
+		Name:  ast.NewIdent(name),
+		Slash: slash.Pos,
+		Arity: &ast.IntLiteral{IntPos: arity.Pos, Lit: arity.Lit, Value: p.parseInt(arity)},
+	}, true
+}
+
+// parseAnnotatedDecl parses the annotations before a function or type declaration, like
+// `@inline`, and the declaration they are attached to.
+func (p *Parser) parseAnnotatedDecl() ast.Decl {
+	doc := p.leadComment()
+	var annotations []*ast.Annotation
+	for p.matches(token.At) {
+		from := p.peek().Pos
+		if len(annotations) > 0 {
+			from = annotations[0].Pos()
+		}
+		ann := p.parseAnnotation()
+		if ann == nil {
+			to := p.advance(declStart)
+			return &ast.BadDecl{From: from, To: to.Pos}
+		}
+		annotations = append(annotations, ann)
+		p.eatAll(token.Semicolon) // an annotation may be on a line of its own
+	}
+	switch tok := p.peek(); tok.Type {
+	case token.Func:
+		decl := p.parseFunction()
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			fn.Annotations = annotations
+			if fn.Doc == nil {
+				fn.Doc = doc // the comment is before the annotations
+			}
+		}
+		return decl
+	case token.TypeKeyword:
+		decl := p.parseTypeDecl()
+		if typ, ok := decl.(*ast.TypeDecl); ok {
+			typ.Annotations = annotations
+		}
+		return decl
+	default:
+		p.error(tok.Pos, fmt.Errorf("expected func or type after annotation, got %s", tok.String()))
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: annotations[0].Pos(), To: to.Pos}
+	}
+}
+
+// parseAnnotation parses an annotation like `@inline` or `@deprecated("use g")`, or
+// returns nil if it has no name.
+func (p *Parser) parseAnnotation() *ast.Annotation {
+	at := p.eatOnly(token.At, "expected '@' at start of annotation")
+	name := p.eatOnly(token.Identifier, "expected annotation name after '@'")
+	if name.Type != token.Identifier {
+		return nil
+	}
+	ann := &ast.Annotation{At: at.Pos, Name: ast.NewIdent(name)}
+	if p.matches(token.LParen) {
+		ann.LParen = p.eat().Pos
+		ann.Args = p.parseArguments()
+		ann.RParen = p.eatOnly(token.RParen, "expected ')' after annotation arguments").Pos
+	}
+	return ann
 }
 
 func (p *Parser) parseTypeDecl() ast.Decl {
@@ -220,7 +505,73 @@ func (p *Parser) parseTypeDecl() ast.Decl {
 	}
 }
 
+func (p *Parser) parseConstDecl() ast.Decl {
+	constTok := p.eatOnly(token.Const, "expected 'const' keyword at start of constant declaration")
+	if constTok.Type != token.Const {
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: constTok.Pos, To: to.Pos}
+	}
+
+	name := p.eatOnly(token.Identifier, "expected constant name after 'const' keyword")
+	if name.Type != token.Identifier {
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: constTok.Pos, To: to.Pos}
+	}
+
+	equals := p.eatOnly(token.Equal, "expected '=' after constant name")
+	if equals.Type != token.Equal {
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: constTok.Pos, To: to.Pos}
+	}
+
+	return &ast.ConstDecl{
+		Const:  constTok.Pos,
+		Name:   ast.NewIdent(name),
+		Equals: equals.Pos,
+		Value:  p.parseExpression(),
+	}
+}
+
+// parseGuardDecl parses a reusable guard like `guard even(x) = x % 2 == 0`.
+func (p *Parser) parseGuardDecl() ast.Decl {
+	guardTok := p.eatOnly(token.Guard, "expected 'guard' keyword at start of guard declaration")
+	if guardTok.Type != token.Guard {
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: guardTok.Pos, To: to.Pos}
+	}
+
+	name := p.eatOnly(token.Identifier, "expected guard name after 'guard' keyword")
+	if name.Type != token.Identifier {
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: guardTok.Pos, To: to.Pos}
+	}
+	p.eatOnly(token.LParen, "expected '(' after guard name")
+	var params []*ast.Identifier
+	for _, param := range p.parseParams() {
+		if ident, ok := param.(*ast.Identifier); ok {
+			params = append(params, ident)
+		} else if _, bad := param.(*ast.BadExpr); !bad {
+			p.error(param.Pos(), fmt.Errorf("guard parameter must be a name"))
+		}
+	}
+
+	equals := p.eatOnly(token.Equal, "expected '=' after guard parameters")
+	if equals.Type != token.Equal {
+		to := p.advance(declStart)
+		return &ast.BadDecl{From: guardTok.Pos, To: to.Pos}
+	}
+
+	return &ast.GuardDecl{
+		Guard:      guardTok.Pos,
+		Name:       ast.NewIdent(name),
+		Parameters: params,
+		Equals:     equals.Pos,
+		Body:       p.parseExpression(),
+	}
+}
+
 func (p *Parser) parseFunction() ast.Decl {
+	doc := p.leadComment()
 	funcTok := p.eatOnly(token.Func, "expected 'func' keyword at start of function")
 	if funcTok.Type != token.Func {
 		to := p.advance(declStart)
@@ -234,22 +585,28 @@ func (p *Parser) parseFunction() ast.Decl {
 	}
 	p.eatOnly(token.LParen, "expected '(' after function name")
 	params := p.parseParams()
+	var guard *ast.GuardSeq
+	if p.matches(token.When) {
+		guard = p.parseGuard()
+	}
 
 	lbrace := p.eatOnly(token.LCurlyBracket, "expected '{' after function parameters")
 	body := p.parseBody()
 	rbrace := p.eatOnly(token.RCurlyBracket, "expected '}' to end function body")
 	return &ast.FuncDecl{
+		Doc:        doc,
 		Name:       ast.NewIdent(name),
 		Func:       funcTok.Pos,
 		Statements: body,
 		Parameters: params,
+		Guard:      guard,
 		LeftBrace:  lbrace.Pos,
 		RightBrace: rbrace.Pos,
 	}
 }
 
-func (p *Parser) parseParams() []*ast.Identifier {
-	var params []*ast.Identifier
+func (p *Parser) parseParams() []ast.Expression {
+	var params []ast.Expression
 	i := 0
 	for !p.matches(token.EOF) {
 		if p.matches(token.RParen) {
@@ -261,15 +618,141 @@ func (p *Parser) parseParams() []*ast.Identifier {
 				p.advance(paramStart)
 			}
 		}
-		name := p.eatOnly(token.Identifier, "expected parameter name")
-		if name.Type == token.Identifier {
-			params = append(params, ast.NewIdent(name))
-		}
+		params = append(params, p.parseParam())
 		i++
 	}
 	return params
 }
 
+// parseParam parses a single parameter, which is either a name or a pattern
+// like `[h | t]`, `{}` or `'red'` that the argument is matched against.
+func (p *Parser) parseParam() ast.Expression {
+	if p.matches(token.LSquareBracket) {
+		return p.parseList(p.eat())
+	}
+	if p.matches(token.LCurlyBracket) {
+		return p.parseTuple(p.eat())
+	}
+	if p.matches(token.Integer, token.Atom) {
+		return p.parsePrimary()
+	}
+	name := p.eatOnly(token.Identifier, "expected parameter name")
+	if name.Type != token.Identifier {
+		return &ast.BadExpr{From: name.Pos, To: name.Pos}
+	}
+	return ast.NewIdent(name)
+}
+
+// parseGuard parses a guard sequence like `when x > 0, x < 10; x == -1`, where ','
+// separates tests that must all be true and ';' separates alternative guards.
+func (p *Parser) parseGuard() *ast.GuardSeq {
+	when := p.eatOnly(token.When, "expected 'when' keyword at start of guard")
+	return &ast.GuardSeq{When: when.Pos, Guards: p.parseGuards()}
+}
+
+// parseGuards parses the guards of a guard sequence after 'when'.
+func (p *Parser) parseGuards() [][]ast.Expression {
+	var guards [][]ast.Expression
+	guard := p.parseGuardTest()
+	for p.matches(token.Comma, token.Semicolon) {
+		if sep := p.eat(); sep.Type == token.Semicolon {
+			guards = append(guards, guard)
+			guard = nil
+		}
+		guard = append(guard, p.parseGuardTest()...)
+	}
+	return append(guards, guard)
+}
+
+// parseGuardExpr parses a guard sequence like parseGuards, but joins the tests of each
+// guard with 'andalso' and the guards with 'orelse' into a single expression.
+func (p *Parser) parseGuardExpr() ast.Expression {
+	join := func(left ast.Expression, op token.Type, pos token.Pos, right ast.Expression) ast.Expression {
+		if left == nil {
+			return right
+		}
+		return &ast.BinaryExpr{Left: left, Op: op, OpPos: pos, Right: right}
+	}
+	var expr, guard ast.Expression
+	var orPos, andPos token.Pos
+	for {
+		for _, test := range p.parseGuardTest() {
+			guard = join(guard, token.AndAlso, andPos, test)
+			andPos = test.Pos()
+		}
+		// a semicolon inserted at the end of the line ends the guard instead
+		if !p.matches(token.Comma, token.Semicolon) || p.peek().Lit == "\n" {
+			break
+		}
+		sep := p.eat()
+		if sep.Type == token.Semicolon {
+			expr = join(expr, token.OrElse, orPos, guard)
+			guard = nil
+			orPos = sep.Pos
+		} else {
+			andPos = sep.Pos
+		}
+	}
+	return join(expr, token.OrElse, orPos, guard)
+}
+
+// parseGuardTest parses a single test of a guard. A range test like `x in 1..10` is
+// parsed as the two tests `x >= 1, x <= 10`, which must both be true. The range binds
+// like a comparison, so `not x in 1..10` is the one test `not (x >= 1 andalso x <= 10)`.
+func (p *Parser) parseGuardTest() []ast.Expression {
+	x := p.parseExpression()
+	if !p.matches(token.In) {
+		return []ast.Expression{x}
+	}
+	in := p.eat()
+	// the bounds take arithmetic but not comparisons, like `x in 0..n - 1`
+	boundPrec, _ := token.Plus.Precedence()
+	low := p.parseBinaryExpr(boundPrec)
+	dots := p.eatOnly(token.DotDot, "expected '..' in range after 'in'")
+	high := p.parseBinaryExpr(boundPrec)
+	inRange := func(x ast.Expression) (ast.Expression, ast.Expression) {
+		// each test gets its own copy of x, so no node has two parents
+		var x2 ast.Expression
+		if x != nil {
+			x2 = ast.Clone(x).(ast.Expression)
+		}
+		return &ast.BinaryExpr{Left: x, OpPos: in.Pos, Op: token.GreaterEqual, Right: low},
+			&ast.BinaryExpr{Left: x2, OpPos: dots.Pos, Op: token.LessEqual, Right: high}
+	}
+	if operand := rangeOperand(x); operand != nil {
+		lower, upper := inRange(*operand)
+		*operand = &ast.BinaryExpr{Left: lower, OpPos: in.Pos, Op: token.AndAlso, Right: upper}
+		return []ast.Expression{x}
+	}
+	lower, upper := inRange(x)
+	return []ast.Expression{lower, upper}
+}
+
+// rangeOperand returns where the operand of a range after x is in x, if x ends with an
+// operator that binds looser than the range, like the not of `not x in 1..10` or the
+// andalso of `a andalso x in 1..10`, and nil otherwise.
+func rangeOperand(x ast.Expression) *ast.Expression {
+	rangePrec, _ := token.GreaterEqual.Precedence()
+	var operand *ast.Expression
+	for {
+		switch e := x.(type) {
+		case *ast.UnaryExpr:
+			if e.Op != token.Not {
+				return operand
+			}
+			operand = &e.Right
+		case *ast.BinaryExpr:
+			if prec, ok := e.Op.Precedence(); !ok || prec >= rangePrec {
+				return operand
+			}
+			operand = &e.Right
+		default:
+			return operand
+		}
+		x = *operand
+	}
+}
+
 func (p *Parser) parseBody() []ast.Statement {
 	var body []ast.Statement
 	for !p.matches(token.EOF) {
@@ -298,43 +781,158 @@ func (p *Parser) parseStatement(tok lexer.Token) ast.Statement {
 	switch tok.Type {
 	case token.Return:
 		return p.parseReturnStatement()
+	case token.While:
+		return p.parseWhileStatement()
+	case token.If:
+		return p.parseIfStatement()
+	case token.Defer:
+		p.eat()
+		return &ast.DeferStmt{Defer: tok.Pos, Expression: p.parseExpression()}
 	default: // expression statement
 		return p.parseExpressionStatement(tok)
 	}
 }
 
+// parseReturnStatement parses `return a` or a multiple value return `return a, b`,
+// which returns the tuple {a, b}.
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	p.eatOnly(token.Return, "expected 'return' keyword")
+	ret := p.eatOnly(token.Return, "expected 'return' keyword")
+	expr := p.parseExpression()
+	if p.matches(token.Comma) {
+		tuple := &ast.TupleExpr{Elements: []ast.Expression{expr}}
+		for p.matches(token.Comma) {
+			p.eat()
+			tuple.Elements = append(tuple.Elements, p.parseExpression())
+		}
+		expr = tuple
+	}
 	return &ast.ReturnStatement{
-		Expression: p.parseExpression(),
+		Return:     ret.Pos,
+		Expression: expr,
+	}
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStmt {
+	while := p.eatOnly(token.While, "expected 'while' keyword")
+	cond := p.parseExpression()
+	lbrace := p.eatOnly(token.LCurlyBracket, "expected '{' after while condition")
+	body := p.parseBody()
+	rbrace := p.eatOnly(token.RCurlyBracket, "expected '}' to end while body")
+	return &ast.WhileStmt{
+		While:  while.Pos,
+		Cond:   cond,
+		LBrace: lbrace.Pos,
+		Body:   body,
+		RBrace: rbrace.Pos,
 	}
 }
 
+// parseIfStatement parses `if cond { ... }` or `if init; cond { ... }`, where init is
+// a simple statement like `x := f()`, followed by an optional `else if ...` or
+// `else { ... }` on the same line as the closing brace.
+func (p *Parser) parseIfStatement() *ast.IfStmt {
+	stmt := &ast.IfStmt{If: p.eatOnly(token.If, "expected 'if' keyword").Pos}
+	cond := p.parseExpression()
+	if p.matches(token.Semicolon) {
+		p.eat()
+		stmt.Init = &ast.ExprStatement{Expression: cond}
+		cond = p.parseExpression()
+	}
+	stmt.Cond = cond
+	stmt.LBrace = p.eatOnly(token.LCurlyBracket, "expected '{' after if condition").Pos
+	stmt.Body = p.parseBody()
+	stmt.RBrace = p.eatOnly(token.RCurlyBracket, "expected '}' to end if body").Pos
+	if p.matches(token.Else) {
+		p.eat()
+		if p.matches(token.If) {
+			stmt.Else = p.parseIfStatement()
+		} else {
+			block := &ast.BlockStmt{LBrace: p.eatOnly(token.LCurlyBracket, "expected 'if' or '{' after else").Pos}
+			block.List = p.parseBody()
+			block.RBrace = p.eatOnly(token.RCurlyBracket, "expected '}' to end else body").Pos
+			stmt.Else = block
+		}
+	}
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement(tok lexer.Token) *ast.ExprStatement {
-	return &ast.ExprStatement{Expression: p.parseExpression()}
+	expr := p.parseExpression()
+	if expr != nil && p.matches(token.Comma) {
+		expr = p.parseMultiAssign(expr)
+	}
+	return &ast.ExprStatement{Expression: expr}
+}
+
+// parseMultiAssign parses the rest of `q, r = expr` after the first name, which
+// destructures the tuple that expr evaluates to.
+func (p *Parser) parseMultiAssign(first ast.Expression) ast.Expression {
+	assign := &ast.MultiAssignExpr{}
+	names := []ast.Expression{first}
+	for p.matches(token.Comma) {
+		p.eat()
+		names = append(names, p.parseBinaryExpr(lowestPrec))
+	}
+	assign.Equals = p.eatOnly(token.Equal, "expected '=' after names in assignment").Pos
+	assign.Right = p.parseExpression()
+	for _, name := range names {
+		ident, ok := name.(*ast.Identifier)
+		if !ok {
+			to := p.lastEnd()
+			if assign.Right != nil {
+				to = assign.Right.End()
+			}
+			if name != nil {
+				p.error(name.Pos(), fmt.Errorf("left hand side of assignment must be an identifier"))
+			}
+			return &ast.BadExpr{From: first.Pos(), To: to}
+		}
+		assign.Left = append(assign.Left, ident)
+	}
+	return assign
 }
 
-// The order of precedence is defined by which parse* function is called first.
+// Binary operators are parsed by precedence climbing with the precedence table in
+// token.Type.Precedence, so adding an operator only needs a new entry there.
 // The BNF for the parsing looks like:
 // expression     → match ;
-// match          → equality ( ( "=" | ":=" ) equality ) ;
-// equality       → comparison ( ( "!=" | "==" ) comparison )* ;
-// comparison     → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
-// term           → factor ( ( "-" | "+" ) factor )* ;
-// factor         → unary ( ( "/" | "*" ) unary )* ;
-// unary          → ( "!" | "-" | "+" ) unary
+// match          → ternary ( ( ":" type )? "=" match | ":=" ternary )? ;
+// ternary        → binary ( "?" ternary ":" ternary )? ;
+// binary         → unary ( BINOP unary | "is" type )* ;  // IDENTIFIER "/" NUMBER is a FuncRef
+// unary          → ( "!" | "-" | "+" | "catch" ) unary
+//                | "not" binary    // with operators that bind at least like comparisons
 //                | primary ;
-// call		      → primary ( "(" arguments? ")" | "." IDENTIFIER)* ;
+// call		      → primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" )* ;
 // arguments      → expression ( "," expression )* ;
-// primary        → NUMBER | STRING | ATOM | IDENTIFIER
-//                | "(" expression ")" ;
+// primary        → NUMBER | STRING | ATOM | IDENTIFIER | "nil" | list | tuple | case
+//                | receive | let | fun | interp | "^" IDENTIFIER | "(" expression ")" ;
+// list           → "[" ( arguments ( "|" expression )? )? "]" ;
+// tuple          → "{" arguments? "}" ;
+// case           → "case" expression "{" ( clause ";" )* "}" ;
+// receive        → "receive" "{" ( clause ";" )* ( "after" expression "->" expression )? "}" ;
+// clause         → expression ( "when" guard )? "->" expression ;
+// guard          → test ( ( "," | ";" ) test )* ;
+// test           → expression ( "in" binary ".." binary )? ;
+// let            → "let" IDENTIFIER "=" expression "in" expression ;
+// fun            → "fn" IDENTIFIER? "(" params? ")" "{" statements "}" ;
+// interp         → INTERP_HEAD expression ( INTERP_MID expression )* INTERP_TAIL ;
 
 func (p *Parser) parseExpression() ast.Expression {
 	return p.parseMatch()
 }
 
 func (p *Parser) parseMatch() ast.Expression {
-	left := p.parseEquality()
+	left := p.parseTernary()
+	var colon token.Pos
+	var typ ast.Expression
+	if _, ok := left.(*ast.Identifier); ok && p.matches(token.Colon) {
+		// type annotation, `p: Point = ...`
+		colon = p.eat().Pos
+		typ = p.parseType()
+		if !p.matches(token.Equal) {
+			p.error(p.peek().Pos, fmt.Errorf("expected '=' after type annotation"))
+		}
+	}
 	// just if and not while because these are right-associative
 	if p.matches(token.Equal) {
 		equals := p.eat()
@@ -342,22 +940,28 @@ func (p *Parser) parseMatch() ast.Expression {
 		if leftId, ok := left.(*ast.Identifier); ok {
 			return &ast.AssignExpr{
 				Left:   leftId,
+				Colon:  colon,
+				Type:   typ,
 				Equals: equals.Pos,
 				Right:  right,
 			}
+		} else if isPattern(left) && typ == nil {
+			// like Erlang's `{ok, V} = f()`, which fails with badmatch
+			return &ast.MatchAssignExpr{Left: left, Op: token.Equal, Equals: equals.Pos, Right: right}
 		} else {
 			pos := equals.Pos
 			if left != nil {
 				pos = left.Pos()
 			}
-			p.error(pos, fmt.Errorf("left hand side of assignment must be an identifier"))
+			p.error(pos, fmt.Errorf("left hand side of assignment must be an identifier or pattern"))
 			return nil
 		}
 	} else if p.matches(token.ColonEqual) {
 		equals := p.eat()
-		right := p.parseEquality()
+		right := p.parseTernary()
 		left = &ast.MatchAssignExpr{
 			Left:   left,
+			Op:     token.ColonEqual,
 			Equals: equals.Pos,
 			Right:  right,
 		}
@@ -365,41 +969,57 @@ func (p *Parser) parseMatch() ast.Expression {
 	return left
 }
 
-func (p *Parser) parseEquality() ast.Expression {
-	left := p.parseComparison()
-	for p.matches(token.EqualEqual, token.BangEqual) {
-		op := p.eat()
-		right := p.parseComparison()
-		left = &ast.BinaryExpr{
-			Left:  left,
-			Op:    op.Type,
-			OpPos: op.Pos,
-			Right: right,
-		}
+// isPattern reports whether expr is a pattern that '=' matches against, like a tuple or
+// a list. An identifier on the left of '=' is assigned instead.
+func isPattern(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.TupleExpr, *ast.ListExpr, *ast.PinExpr, ast.Literal:
+		return true
+	case *ast.ParenExpr:
+		return isPattern(expr.Expression)
 	}
-	return left
+	return false
 }
 
-func (p *Parser) parseComparison() ast.Expression {
-	left := p.parseTerm()
-	for p.matches(token.Greater, token.GreaterEqual, token.Less, token.LessEqual) {
-		op := p.eat()
-		right := p.parseTerm()
-		left = &ast.BinaryExpr{
-			Left:  left,
-			Op:    op.Type,
-			OpPos: op.Pos,
-			Right: right,
-		}
+// parseTernary parses `cond ? then : else`, which binds looser than every binary
+// operator. It is right-associative, so `a ? b : c ? d : e` is `a ? b : (c ? d : e)`.
+func (p *Parser) parseTernary() ast.Expression {
+	cond := p.parseBinaryExpr(lowestPrec)
+	if !p.matches(token.Question) {
+		return cond
+	}
+	question := p.eat()
+	then := p.parseTernary()
+	colon := p.eatOnly(token.Colon, "expected ':' after then branch of '?'")
+	return &ast.TernaryExpr{
+		Cond:     cond,
+		Question: question.Pos,
+		Then:     then,
+		Colon:    colon.Pos,
+		Else:     p.parseTernary(),
 	}
-	return left
 }
 
-func (p *Parser) parseTerm() ast.Expression {
-	left := p.parseFactor()
-	for p.matches(token.Plus, token.Minus) {
+// parseBinaryExpr parses a binary expression whose operators bind at least as tightly as
+// minPrec, with the precedence of each operator given by token.Type.Precedence. Operators
+// are left-associative, so the right operand only takes operators that bind tighter.
+func (p *Parser) parseBinaryExpr(minPrec int) ast.Expression {
+	left := p.parseUnary()
+	for {
+		prec, ok := p.peek().Type.Precedence()
+		if !ok || prec < minPrec {
+			return left
+		}
 		op := p.eat()
-		right := p.parseFactor()
+		if op.Type == token.Is {
+			left = &ast.TypeTestExpr{X: left, Is: op.Pos, Type: p.parseTypeTestType()}
+			continue
+		}
+		right := p.parseBinaryExpr(prec + 1)
+		if ref := funcRef(left, op, right); ref != nil {
+			left = ref
+			continue
+		}
 		left = &ast.BinaryExpr{
 			Left:  left,
 			Op:    op.Type,
@@ -407,25 +1027,35 @@ func (p *Parser) parseTerm() ast.Expression {
 			Right: right,
 		}
 	}
-	return left
 }
 
-func (p *Parser) parseFactor() ast.Expression {
-	left := p.parseUnary()
-	for p.matches(token.Slash, token.Star) {
+// funcRef returns `left op right` as a function reference like `foo/2` if left is a bare
+// name and right an integer, or nil otherwise. Whether a reference like `x/2` is really a
+// division of the variable x depends on what x is, which the compiler decides.
+func funcRef(left ast.Expression, op lexer.Token, right ast.Expression) *ast.FuncRef {
+	name, ok := left.(*ast.Identifier)
+	if !ok || op.Type != token.Slash {
+		return nil
+	}
+	arity, ok := right.(*ast.IntLiteral)
+	if !ok {
+		return nil
+	}
+	return &ast.FuncRef{Name: name, Slash: op.Pos, Arity: arity}
+}
+
+func (p *Parser) parseUnary() ast.Expression {
+	if p.matches(token.Not) {
+		// like the boolean operators, not binds looser than comparisons, so `not x > 0`
+		// is `not (x > 0)`
 		op := p.eat()
-		right := p.parseUnary()
-		left = &ast.BinaryExpr{
-			Left:  left,
+		prec, _ := token.EqualEqual.Precedence()
+		return &ast.UnaryExpr{
 			Op:    op.Type,
 			OpPos: op.Pos,
-			Right: right,
+			Right: p.parseBinaryExpr(prec),
 		}
 	}
-	return left
-}
-
-func (p *Parser) parseUnary() ast.Expression {
 	if p.matches(token.Minus, token.Plus) {
 		op := p.eat()
 		return &ast.UnaryExpr{
@@ -434,6 +1064,10 @@ func (p *Parser) parseUnary() ast.Expression {
 			Right: p.parseUnary(),
 		}
 	}
+	if p.matches(token.CatchKeyword) {
+		catch := p.eat()
+		return &ast.CatchExpr{Catch: catch.Pos, Expr: p.parseUnary()}
+	}
 	return p.parseCall()
 }
 
@@ -442,18 +1076,27 @@ func (p *Parser) parseCall() ast.Expression {
 	for {
 		if p.matches(token.LParen) {
 			lparen := p.eat()
-			args := p.parseArguments()
-			rparen := p.eat()
-			callee = &ast.CallExpr{
-				Callee:     callee,
-				Arguments:  args,
-				LeftParen:  lparen.Pos,
-				RightParen: rparen.Pos,
+			call := &ast.CallExpr{
+				Callee:    callee,
+				Arguments: p.parseArguments(),
+				LeftParen: lparen.Pos,
 			}
+			if p.matches(token.Ellipsis) {
+				// `f(a, rest...)` spreads the list rest into the arguments
+				call.Ellipsis = p.eat().Pos
+				call.RightParen = p.eatOnly(token.RParen, "expected ')' after '...', only the last argument can be spread").Pos
+			} else {
+				call.RightParen = p.eat().Pos
+			}
+			callee = call
 		} else if p.matches(token.Period) {
 			dot := p.eat()
-			name := p.eatOnly(token.Identifier, "expected identifier after '.'")
+			name := p.eat()
+			if name.Type.IsKeyword() {
+				name.Type = token.Identifier // Erlang functions may be named like keywords, e.g. mod.fn
+			}
 			if name.Type != token.Identifier {
+				p.error(name.Pos, fmt.Errorf("expected identifier after '.', got %s", name.String()))
 				p.advance(exprEnd)
 				return &ast.BadExpr{From: name.Pos, To: name.Pos}
 			}
@@ -462,6 +1105,17 @@ func (p *Parser) parseCall() ast.Expression {
 				Target:    callee,
 				Attribute: ast.NewIdent(name),
 			}
+		} else if p.matches(token.LSquareBracket) && p.peek().Pos == p.lastEnd() {
+			// a '[' right after an operand is an index like `p[0]`, and otherwise a list
+			lbrack := p.eat()
+			index := p.parseExpression()
+			rbrack := p.eatOnly(token.RSquareBracket, "expected ']' after index")
+			callee = &ast.IndexExpr{
+				Target:   callee,
+				LBracket: lbrack.Pos,
+				Index:    index,
+				RBracket: rbrack.Pos,
+			}
 		} else {
 			break
 		}
@@ -507,11 +1161,33 @@ func (p *Parser) parsePrimary() ast.Expression {
 			QuotePos: tok.Pos,
 			Value:    tok.Lit,
 		}
+	case token.InterpHead:
+		return p.parseInterpString(tok)
 	case token.Atom:
 		return &ast.AtomLiteral{
 			QuotePos: tok.Pos,
 			Value:    tok.Lit,
 		}
+	case token.Nil:
+		return &ast.NilLiteral{NilPos: tok.Pos}
+	case token.LSquareBracket:
+		return p.parseList(tok)
+	case token.LCurlyBracket:
+		return p.parseTuple(tok)
+	case token.Case:
+		return p.parseCase(tok)
+	case token.Receive:
+		return p.parseReceive(tok)
+	case token.Let:
+		return p.parseLet(tok)
+	case token.Fn:
+		return p.parseFuncLit(tok)
+	case token.Caret:
+		name := p.eatOnly(token.Identifier, "expected variable after '^'")
+		if name.Type != token.Identifier {
+			return &ast.BadExpr{From: tok.Pos, To: name.Pos}
+		}
+		return &ast.PinExpr{Caret: tok.Pos, Var: ast.NewIdent(name)}
 	case token.LParen:
 		expr := p.parseExpression()
 		rparen := p.eatOnly(token.RParen, "unclosed '(' around expression")
@@ -527,9 +1203,167 @@ func (p *Parser) parsePrimary() ast.Expression {
 	}
 }
 
-// parseInt converts a string to an integer.
+// parseList parses the rest of a list after the opening '['. The list is either
+// a plain list `[a, b]` or a cons `[a, b | t]`.
+func (p *Parser) parseList(lbracket lexer.Token) ast.Expression {
+	list := &ast.ListExpr{LBracket: lbracket.Pos}
+	if !p.matches(token.RSquareBracket) {
+		list.Elements = append(list.Elements, p.parseExpression())
+		for p.matches(token.Comma) {
+			p.eat()
+			list.Elements = append(list.Elements, p.parseExpression())
+		}
+		if p.matches(token.Pipe) {
+			list.Pipe = p.eat().Pos
+			list.Tail = p.parseExpression()
+		}
+	}
+	rbracket := p.eatOnly(token.RSquareBracket, "expected ']' to close list")
+	list.RBracket = rbracket.Pos
+	return list
+}
+
+// parseInterpString parses the rest of an interpolated string like "a #{x} b" after its
+// first literal part.
+func (p *Parser) parseInterpString(head lexer.Token) ast.Expression {
+	str := &ast.InterpString{Parts: []ast.Expression{&ast.StringLiteral{QuotePos: head.Pos, Value: head.Lit}}}
+	for {
+		str.Parts = append(str.Parts, p.parseExpression())
+		tok := p.peek()
+		if tok.Type != token.InterpMid && tok.Type != token.InterpTail {
+			p.error(tok.Pos, fmt.Errorf("expected '}' to end interpolation, got %s", tok.String()))
+			to := p.advance(exprEnd)
+			return &ast.BadExpr{From: head.Pos, To: to.Pos}
+		}
+		p.eat()
+		str.Parts = append(str.Parts, &ast.StringLiteral{QuotePos: tok.Pos, Value: tok.Lit})
+		if tok.Type == token.InterpTail {
+			return str
+		}
+	}
+}
+
+// parseTuple parses the rest of a tuple like `{a, b}` after the opening '{'.
+func (p *Parser) parseTuple(lbrace lexer.Token) ast.Expression {
+	tuple := &ast.TupleExpr{LBrace: lbrace.Pos}
+	if !p.matches(token.RCurlyBracket) {
+		tuple.Elements = append(tuple.Elements, p.parseExpression())
+		for p.matches(token.Comma) {
+			p.eat()
+			tuple.Elements = append(tuple.Elements, p.parseExpression())
+		}
+	}
+	rbrace := p.eatOnly(token.RCurlyBracket, "expected '}' to close tuple")
+	tuple.RBrace = rbrace.Pos
+	return tuple
+}
+
+// parseLet parses the rest of a let expression after the `let` keyword. The body extends
+// as far as possible, so `let x = 1 in x + 1` is `let x = 1 in (x + 1)`.
+func (p *Parser) parseLet(letTok lexer.Token) ast.Expression {
+	expr := &ast.LetExpr{Let: letTok.Pos}
+	name := p.eatOnly(token.Identifier, "expected name after 'let'")
+	expr.Name = &ast.Identifier{NamePos: name.Pos, Name: name.Lit}
+	expr.Equal = p.eatOnly(token.Equal, "expected '=' after let name").Pos
+	expr.Value = p.parseExpression()
+	expr.In = p.eatOnly(token.In, "expected 'in' after let value").Pos
+	expr.Body = p.parseExpression()
+	return expr
+}
+
+// parseFuncLit parses the rest of a fun expression after the `fn` keyword, which is
+// either anonymous like `fn(x) { ... }` or named like `fn loop(n) { ... }`.
+func (p *Parser) parseFuncLit(fnTok lexer.Token) ast.Expression {
+	fn := &ast.FuncLit{Fn: fnTok.Pos}
+	if p.matches(token.Identifier) {
+		fn.Name = ast.NewIdent(p.eat())
+	}
+	p.eatOnly(token.LParen, "expected '(' after 'fn'")
+	fn.Parameters = p.parseParams()
+	fn.LeftBrace = p.eatOnly(token.LCurlyBracket, "expected '{' after fun parameters").Pos
+	fn.Statements = p.parseBody()
+	fn.RightBrace = p.eatOnly(token.RCurlyBracket, "expected '}' to end fun body").Pos
+	return fn
+}
+
+// parseCase parses the rest of a case expression after the `case` keyword. The clauses
+// are separated by ';' or new lines:
+//
+//	case x {
+//		{'ok', v} when v > 0 -> v
+//		_ -> 0
+//	}
+func (p *Parser) parseCase(caseTok lexer.Token) ast.Expression {
+	expr := &ast.CaseExpr{Case: caseTok.Pos, Value: p.parseExpression()}
+	expr.LBrace = p.eatOnly(token.LCurlyBracket, "expected '{' after case value").Pos
+	expr.Clauses = p.parseClauses("case")
+	expr.RBrace = p.eatOnly(token.RCurlyBracket, "expected '}' to close case").Pos
+	return expr
+}
+
+// parseReceive parses the rest of a receive expression after the `receive` keyword,
+// which has clauses like a case and may end with a timeout:
+//
+//	receive {
+//		{'ping', from} -> erlang.send(from, 'pong')
+//		after 1000 -> 'timeout'
+//	}
+func (p *Parser) parseReceive(receiveTok lexer.Token) ast.Expression {
+	expr := &ast.ReceiveExpr{Receive: receiveTok.Pos}
+	expr.LBrace = p.eatOnly(token.LCurlyBracket, "expected '{' after 'receive'").Pos
+	expr.Clauses = p.parseClauses("receive")
+	if p.matches(token.After) {
+		expr.After = p.eat().Pos
+		expr.Timeout = p.parseExpression()
+		expr.AfterArrow = p.eatOnly(token.Arrow, "expected '->' after receive timeout").Pos
+		expr.Action = p.parseExpression()
+		p.eatAll(token.Semicolon)
+	}
+	expr.RBrace = p.eatOnly(token.RCurlyBracket, "expected '}' to close receive").Pos
+	return expr
+}
+
+// parseClauses parses the clauses of a case or receive up to the closing '}' or the
+// `after` of a receive. The clauses are separated by ';' or new lines, and kind names the
+// expression in errors.
+func (p *Parser) parseClauses(kind string) []*ast.Clause {
+	var clauses []*ast.Clause
+	for {
+		p.eatAll(token.Semicolon)
+		if p.matches(token.RCurlyBracket, token.After, token.EOF) {
+			break
+		}
+		clauses = append(clauses, p.parseClause(kind))
+		if !p.matches(token.Semicolon, token.RCurlyBracket) {
+			tok := p.eat()
+			p.error(tok.Pos, fmt.Errorf("expected ';' or new line after %s clause", kind))
+			p.advance(exprEnd)
+		}
+	}
+	return clauses
+}
+
+// parseClause parses a single `pattern when guard -> body` clause. The guard is parsed
+// by parseGuard like the guard of a function head.
+func (p *Parser) parseClause(kind string) *ast.Clause {
+	clause := &ast.Clause{Patterns: []ast.Expression{p.parseExpression()}}
+	if p.matches(token.When) {
+		clause.Guard = p.parseGuard()
+	}
+	clause.Arrow = p.eatOnly(token.Arrow, "expected '->' after %s pattern", kind).Pos
+	clause.Body = p.parseExpression()
+	return clause
+}
+
+// parseInt converts a string to an integer, which is either decimal or in the
+// form base#digits.
 func (p *Parser) parseInt(tok lexer.Token) int64 {
-	v, err := strconv.ParseInt(tok.Lit, 10, 64)
+	base, digits := 10, tok.Lit
+	if prefix, rest, ok := strings.Cut(tok.Lit, "#"); ok {
+		base, _ = strconv.Atoi(prefix)
+		digits = rest
+	}
+	v, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
 		p.error(tok.Pos, fmt.Errorf("parse int: %s", err))
 	}
@@ -570,6 +1404,19 @@ func (p *Parser) parseType() ast.Expression {
 	}
 }
 
+// parseTypeTestType parses the type after `is`, which may also be a bare `tuple` for
+// any tuple.
+func (p *Parser) parseTypeTestType() ast.Expression {
+	if !p.matches(token.Tuple) {
+		return p.parseType()
+	}
+	tok := p.eat()
+	if p.matches(token.LSquareBracket) {
+		return p.parseTupleType(tok)
+	}
+	return &ast.Identifier{NamePos: tok.Pos, Name: tok.Lit}
+}
+
 // parseTupleType parses a tuple of the form `tuple[<fieldlist>]` and returns
 // the resulting expression. A tuple can look like:
 // - tuple[] (only empty tuple {} allowed)
@@ -577,7 +1424,7 @@ func (p *Parser) parseType() ast.Expression {
 func (p *Parser) parseTupleType(tupleTok lexer.Token) *ast.TupleType {
 	lbracket := p.eatOnly(token.LSquareBracket, "expected '[' after 'tuple'")
 	fields := &ast.FieldList{}
-	for !p.matches(token.RSquareBracket) {
+	for !p.matches(token.RSquareBracket, token.EOF) {
 		typExpr := p.parseType()
 		fields.List = append(fields.List, &ast.Field{Type: typExpr})
 		if p.matches(token.RSquareBracket) {
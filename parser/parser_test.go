@@ -3,9 +3,11 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/internal/golden"
 	"github.com/masp/garlang/token"
 	"github.com/sebdah/goldie/v2"
 	"github.com/stretchr/testify/assert"
@@ -56,6 +58,19 @@ func TestParseFunc(t *testing.T) {
 			input:       "func assign() { a = 1.23; b = (2+3)*4; c = 'atom' }",
 			expectedAst: "assign.ast",
 		},
+		{
+			// list pattern parameter
+			input:       "func sum([h | t]) { return h + sum(t) }",
+			expectedAst: "list_param.ast",
+		},
+		{
+			input:       "func lists() { a = []; b = [1, 2]; c = [3, 4 | b] }",
+			expectedAst: "list.ast",
+		},
+		{
+			input:       "func empty() { return nil }",
+			expectedAst: "nil.ast",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.input, func(t *testing.T) {
@@ -90,16 +105,321 @@ func TestParseModule(t *testing.T) {
 			input:       "module test",
 			expectedAst: "empty_module.ast",
 		},
+		{
+			// dotted module name
+			input:       "module app.http.server; func f() { return 'ok' }",
+			expectedAst: "dotted_module.ast",
+		},
 		{
 			// type decl
 			input:       "module test; type Foo tuple[int, int, int]",
 			expectedAst: "type.ast",
 		},
+		{
+			// const decl
+			input:       "module test; const Pi = 3.14; const Tau = 2 * Pi",
+			expectedAst: "const.ast",
+		},
+		{
+			// doc comments are the comments on the lines right before a declaration
+			input: `module test
+// unrelated
+
+// add returns the sum
+/* of a and b. */
+func add(a, b) { return a + b }`,
+			expectedAst: "doc.ast",
+		},
+		{
+			input: `module loop
+func count(n) {
+	i = 0
+	while i < n {
+		i = i + 1
+	}
+	return i
+}`,
+			expectedAst: "while.ast",
+		},
+		{
+			input: `module cond
+func clamp(t, n) {
+	if x := erlang.element(1, t); x > n {
+		n = x
+	}
+	if n < 0 {
+		return 0
+	}
+}`,
+			expectedAst: "if.ast",
+		},
+		{
+			input: `module chain
+func sign(n) {
+	if n < 0 {
+		return 'negative'
+	} else if n > 0 {
+		return 'positive'
+	} else {
+		return 'zero'
+	}
+}`,
+			expectedAst: "if_else.ast",
+		},
+		{
+			input: `module spread
+func call(f, x, args) {
+	return f(x, args...)
+}`,
+			expectedAst: "spread.ast",
+		},
+		{
+			// case with an alias pattern binding both the tuple and its elements
+			input: `module test
+func sum(t) {
+	return case t {
+		all = {x, y} when x > 0 -> {all, x + y}
+		_ -> 'none'
+	}
+}`,
+			expectedAst: "case_alias.ast",
+		},
+		{
+			// a pinned variable matches its current value instead of being bound again
+			input: `module test
+func find(x, t) {
+	{^x, y} := t
+	return case y {
+		[^x | _] -> 'first'
+		^x when x > 0 -> 'same'
+		_ -> y
+	}
+}`,
+			expectedAst: "pin.ast",
+		},
+		{
+			// a cons prepends to any list, not only in patterns
+			input: `module test
+func push(x, xs) { return [x | xs] }
+func push2(a, b, xs) { return [a, b | xs] }
+func cons(x) { return [x | [1, 2]] }`,
+			expectedAst: "prepend.ast",
+		},
+		{
+			// empty list and tuple patterns
+			input: `module test
+func sum([]) { return 0 }
+func sum([x | xs]) { return x + sum(xs) }
+func size({}) { return 0 }
+func size({_}) { return 1 }
+func empty(x) { return case x { [] -> 'true'
+	{} -> 'true'
+	_ -> 'false' } }`,
+			expectedAst: "empty_patterns.ast",
+		},
+		{
+			input: `module test
+func process(f) {
+	defer file.close(f)
+	return file.read(f)
+}`,
+			expectedAst: "defer.ast",
+		},
+		{
+			// name/arity refers to a function, and is only a division in the compiler if
+			// the name is a variable or constant
+			input: `module test
+import "lists" (sum/1)
+func double(x) { return x * 2 }
+func refs(n) {
+	return {double/1, sum/1, n/2, (n)/1}
+}`,
+			expectedAst: "func_ref.ast",
+		},
+		{
+			input: `module test
+// f is inlined where it is called.
+@inline
+func f() { return 1 }
+@deprecated("use f") @inline
+func g(x) { return x }
+@deprecated type Old tuple[int]`,
+			expectedAst: "annotation.ast",
+		},
+		{
+			// case on a tuple with tuple patterns
+			input: `module sw
+func classify(a, b) {
+	return case {a, b} {
+		{1, _} -> 'first'
+		{_, 2} -> 'second'
+	}
+}`,
+			expectedAst: "case_tuple.ast",
+		},
+		{
+			// named fun that calls itself
+			input: `module fact
+func facts(ns) {
+	return lists.map(fn fact(n) {
+		return case n {
+			0 -> 1
+			_ -> n * fact(n - 1)
+		}
+	}, ns)
+}`,
+			expectedAst: "fun_named.ast",
+		},
+		{
+			// string interpolation, and an escaped one that is a plain string
+			input: `module greet
+func greet(name, n) {
+	return "hello #{name}, you have #{n + 1} messages"
+}
+func escaped() {
+	return "use \#{name} to interpolate"
+}`,
+			expectedAst: "interp.ast",
+		},
+		{
+			// type tests in a guard and in an expression
+			input: `module types
+func kind(x) when x is int; x is float {
+	return 'number'
+}
+func kind(x) {
+	return x is tuple == (x is atom)
+}`,
+			expectedAst: "type_test.ast",
+		},
+		{
+			// guard declarations used in a function guard and a case guard
+			input: `module guards
+guard even(x) = x % 2 == 0
+guard small(x, max) = x < max
+func f(n) when even(n) {
+	return case n {
+		m when small(m, 10) -> 'small'
+		_ -> 'big'
+	}
+}`,
+			expectedAst: "guard_decl.ast",
+		},
+		{
+			// assignment with a type annotation
+			input:       "module test; type Point tuple[int, int]; func f() { p: Point = {1, 2}; return p }",
+			expectedAst: "typed_assign.ast",
+		},
+		{
+			// ternaries bind looser than binary operators and nest to the right
+			input:       "module test; func sign(x) { s = x > 0 ? 1 : x < 0 ? -1 : 0; return s }",
+			expectedAst: "ternary.ast",
+		},
+		{
+			// catch binds like a unary operator
+			input:       "module test; func f() { r = catch risky() + 1; return r }",
+			expectedAst: "catch.ast",
+		},
+		{
+			// function heads with literal parameters
+			input: `module colors
+func color('red') { return 1 }
+func color(2) { return 'green' }`,
+			expectedAst: "literal_params.ast",
+		},
+		{
+			// a '[' right after an operand is an index, and after a space it is a list
+			input:       "module test; func f(p, i) { return {p[0], p[i][1], [p]} }",
+			expectedAst: "index.ast",
+		},
+		{
+			// receive with clauses like a case
+			input: `module echo
+func loop() {
+	return receive {
+		{'echo', from, msg} when msg != 'stop' -> erlang.send(from, msg)
+		'stop' -> 'ok'
+	}
+}`,
+			expectedAst: "receive.ast",
+		},
+		{
+			// receive with an integer and an 'infinity' timeout
+			input: `module timer
+func wait() {
+	return receive {
+		'stop' -> 'stopped'; after 1000 -> 'timeout'
+	}
+}
+func forever() { return receive { after 'infinity' -> 'never' } }`,
+			expectedAst: "receive_after.ast",
+		},
+		{
+			// a range test is the two comparisons
+			input: `module test
+func f(x, n) when x in 1..n - 1, n > 2 { return x }`,
+			expectedAst: "range_guard.ast",
+		},
+		{
+			// quoted identifiers as a function name and variables
+			input: `module test
+func ` + "`weird name`(`my var`, x) { `the sum` = `my var` + x; return `receive`(`the sum`) }",
+			expectedAst: "quoted_ident.ast",
+		},
+		{
+			// let binds looser than binary operators and can be nested
+			input: `module test
+func f(y) {
+	return fn(x) { return let z = x * 2 in let w = z + y in {z, w} }
+}`,
+			expectedAst: "let.ast",
+		},
+		{
+			// multiple value return and destructuring
+			input: `module divmod
+func divmod(a, b) { return a / b, a % b }
+func sum() {
+	q, r = divmod(10, 3)
+	s = q + r
+	return s
+}`,
+			expectedAst: "multi_return.ast",
+		},
+		{
+			// every binary operator, checking precedence and left associativity
+			input:       "module test; func ops() { return a == b != c === d !== e < f <= g > h >= i + j - k * l / m % n - -o }",
+			expectedAst: "operators.ast",
+		},
+		{
+			// arithmetic and exact equality
+			input:       "module test; func eq(a, b) { return a == b != (a === b !== b) }",
+			expectedAst: "equality.ast",
+		},
+		{
+			// Erlang number forms
+			input:       "module test; func n() { return [0, 16#ff, 2.5e-3] }",
+			expectedAst: "numbers.ast",
+		},
+		{
+			// guard with tests that must all pass
+			input:       "module test; func f(x) when x > 3, x < 10 { return x }",
+			expectedAst: "guard_and.ast",
+		},
+		{
+			// guard with alternatives
+			input:       "module test; func g(x) when x < 1; x > 10, x != 20 { return x }",
+			expectedAst: "guard_or.ast",
+		},
 		{
 			// module imports
 			input:       `module test; import "a/b/c"; import b "belong"`,
 			expectedAst: "import.ast",
 		},
+		{
+			// importing functions by name
+			input:       `module test; import "lists" (sum/1, reverse/1); func f(xs) { return sum(reverse(xs)) }`,
+			expectedAst: "import_funcs.ast",
+		},
 		{
 			// module with comments
 			input: `module test
@@ -131,9 +451,73 @@ func TestParseFail(t *testing.T) {
 			input:   "module abc; func foo() {",
 			wantErr: "expected '}' to end function body, got EOF",
 		},
+		{
+			input:   "module abc.; func foo() { return 1 }",
+			wantErr: "expected name after '.' in module name, got ;",
+		},
 		{
 			input:   "module abc; fn foo() { return 1 }",
-			wantErr: `expected func, got "fn" (Identifier)`,
+			wantErr: `expected func, got "fn" (Fn)`,
+		},
+		{
+			input:   "module abc; func f(x) { return x ? 1 }",
+			wantErr: "expected ':' after then branch of '?', got }",
+		},
+		{
+			input:   `module abc; import "lists" (sum)`,
+			wantErr: "expected '/' and arity after imported function sum, got )",
+		},
+		{
+			input:   "module abc; func f(p) { return p[0 }",
+			wantErr: "expected ']' after index, got }",
+		},
+		{
+			input:   "module abc; @inline const X = 1",
+			wantErr: "expected func or type after annotation, got const",
+		},
+		{
+			input:   "module abc; func f(x) when x in 1 10 { return x }",
+			wantErr: "expected '..' in range after 'in', got 10",
+		},
+		{
+			input:   "module abc; func f() { return receive { after 10 'ok' } }",
+			wantErr: "expected '->' after receive timeout, got ok",
+		},
+		{
+			input:   "module abc; func f(x) { return case x { after 10 -> 'ok' } }",
+			wantErr: "expected '}' to close case, got after",
+		},
+		{
+			input:   "module abc; func f() { return let x = 1 x }",
+			wantErr: "expected 'in' after let value, got x",
+		},
+		{
+			input:   "module abc; func f(xs) { return g(xs..., 1) }",
+			wantErr: "expected ')' after '...', only the last argument can be spread, got ,",
+		},
+		{
+			input:   "module abc; func f(x) { if x { return 1 } else return 2 }",
+			wantErr: "expected 'if' or '{' after else, got return",
+		},
+		{
+			input:   "module a\n@1 func f() {}",
+			wantErr: "expected annotation name after '@', got 1",
+		},
+		{
+			input:   "module a; func f(x) { return case x { ^1 -> 1 } }",
+			wantErr: "expected variable after '^', got 1",
+		},
+		{
+			input:   "module a; func f(x) { a = ^(x) }",
+			wantErr: "expected variable after '^', got (",
+		},
+		{
+			input:   "module a; func f() { return ^ }",
+			wantErr: "expected variable after '^', got }",
+		},
+		{
+			input:   "module m; func f() { a, 1 = g() = 2 }",
+			wantErr: "<test>:1:29: left hand side of assignment must be an identifier or pattern",
 		},
 	}
 	for _, tt := range tests {
@@ -173,6 +557,10 @@ func bad() {
 			input:       "module test; func\nfunc test() {return 1}",
 			expectedAst: "missingname.ast",
 		},
+		{
+			input:       "module test; func unterminated() { return \"abc }",
+			expectedAst: "unterminated.ast",
+		},
 	}
 
 	for _, tt := range tests {
@@ -224,10 +612,24 @@ fn bad() { return 1 }
 			input:        "mo",
 			expectedErrs: "nomodule.errors",
 		},
+		{
+			input: `module test
+func bad() {
+	a = "unterminated
+	b = 'atom
+	return a
+}`,
+			expectedErrs: "unterminated.errors",
+		},
 		{
 			input:        "module {}",
 			expectedErrs: "badmodule.errors",
 		},
+		{
+			// EOF errors point at the end of the last token, not past the input
+			input:        "module test\nfunc f() {\n\ta = 1",
+			expectedErrs: "unterminated_func.errors",
+		},
 	}
 
 	for _, tt := range tests {
@@ -236,7 +638,8 @@ fn bad() { return 1 }
 			require.Error(t, err, "there should be at least 1 error in the program")
 			require.NotNil(t, mod)
 
-			errlist := err.(token.ErrorList)
+			var errlist token.ErrorList
+			require.ErrorAs(t, err, &errlist)
 
 			var out bytes.Buffer
 			for _, err := range errlist {
@@ -247,3 +650,313 @@ fn bad() { return 1 }
 		})
 	}
 }
+
+func TestParseExpression(t *testing.T) {
+	expr, _, err := Expression([]byte("f(x) + 1;\n"))
+	require.NoError(t, err)
+	bin, ok := expr.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", expr)
+	require.Equal(t, token.Plus, bin.Op)
+
+	_, _, err = Expression([]byte("x = 1 }"))
+	require.EqualError(t, err, "<string>:1:7: unexpected } after expression")
+
+	// a pattern on the left of '=' is matched, like with ':='
+	expr, _, err = Expression([]byte("{'ok', v} = f()"))
+	require.NoError(t, err)
+	match, ok := expr.(*ast.MatchAssignExpr)
+	require.True(t, ok, "got %T", expr)
+	require.Equal(t, token.Equal, match.Op)
+
+	_, _, err = Expression([]byte("f(x) = 1"))
+	require.EqualError(t, err, "<string>:1:1: left hand side of assignment must be an identifier or pattern")
+
+	// list subtraction binds looser than + and tighter than comparisons
+	expr, _, err = Expression([]byte("a + b -- c == d"))
+	require.NoError(t, err)
+	eq, ok := expr.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", expr)
+	require.Equal(t, token.EqualEqual, eq.Op)
+	sub, ok := eq.Left.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", eq.Left)
+	require.Equal(t, token.MinusMinus, sub.Op)
+	require.IsType(t, &ast.BinaryExpr{}, sub.Left, "a + b")
+	require.IsType(t, &ast.Identifier{}, sub.Right)
+
+	// not takes comparisons and type tests as its operand, but not and or or
+	expr, _, err = Expression([]byte("not x > 0 and not x is int"))
+	require.NoError(t, err)
+	and, ok := expr.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", expr)
+	require.Equal(t, token.And, and.Op)
+	not, ok := and.Left.(*ast.UnaryExpr)
+	require.True(t, ok, "got %T", and.Left)
+	require.Equal(t, token.Not, not.Op)
+	require.IsType(t, &ast.BinaryExpr{}, not.Right, "x > 0")
+	not, ok = and.Right.(*ast.UnaryExpr)
+	require.True(t, ok, "got %T", and.Right)
+	require.IsType(t, &ast.TypeTestExpr{}, not.Right, "x is int")
+}
+
+func TestParseHeaderErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected HeaderPart
+		pos      string
+		got      string
+	}{
+		{"mo", HeaderKeyword, "<test>:1:1", "mo"},
+		{"module {}", HeaderName, "<test>:1:8", "{"},
+		{"module", HeaderName, "<test>:1:7", "EOF"},
+		{"module a.{}", HeaderSegment, "<test>:1:10", "{"},
+		{"module m func f() {}", HeaderSemicolon, "<test>:1:10", "func"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Module("<test>", []byte(tt.input))
+			require.ErrorIs(t, err, ErrBadModule)
+			var herr *HeaderError
+			require.ErrorAs(t, err, &herr)
+			require.Equal(t, tt.expected, herr.Expected)
+			require.Equal(t, tt.pos, herr.Pos.String())
+			require.Equal(t, tt.got, herr.Got)
+		})
+	}
+
+	_, err := Module("<test>", []byte("module m; func f() { return }"))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrBadModule, "an error after the header is not a header error")
+}
+
+func TestParseExtraSemicolons(t *testing.T) {
+	mod, err := Module("<test>", []byte("module m;;\nimport \"lists\";;\nfunc a() {};;func b() {};\n;;const C = 1;;;\n"))
+	require.NoError(t, err)
+	var kinds []string
+	for _, decl := range mod.Decls {
+		kinds = append(kinds, fmt.Sprintf("%T", decl))
+	}
+	require.Equal(t, []string{"*ast.ImportDecl", "*ast.FuncDecl", "*ast.FuncDecl", "*ast.ConstDecl"}, kinds)
+}
+
+func TestParseGuard(t *testing.T) {
+	guard, err := Guard([]byte("x is int, erlang.abs(x) < 10; x == 'none'\n"))
+	require.NoError(t, err)
+	or, ok := guard.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", guard)
+	require.Equal(t, token.OrElse, or.Op)
+	require.Equal(t, token.Pos(29), or.OpPos)
+	and, ok := or.Left.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", or.Left)
+	require.Equal(t, token.AndAlso, and.Op)
+	require.Equal(t, token.Pos(9), and.OpPos)
+
+	// a range is two tests, each with its own copy of the value
+	guard, err = Guard([]byte("erlang.abs(x) in 0..9"))
+	require.NoError(t, err)
+	and, ok = guard.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", guard)
+	low, high := and.Left.(*ast.BinaryExpr), and.Right.(*ast.BinaryExpr)
+	require.Equal(t, low.Left, high.Left)
+	require.NotSame(t, low.Left, high.Left)
+	require.NotSame(t, low.Left.(*ast.CallExpr).Arguments[0], high.Left.(*ast.CallExpr).Arguments[0])
+
+	// the range binds like a comparison, so not negates the whole range
+	guard, err = Guard([]byte("not x in 1..10"))
+	require.NoError(t, err)
+	not, ok := guard.(*ast.UnaryExpr)
+	require.True(t, ok, "got %T", guard)
+	require.Equal(t, token.Not, not.Op)
+	and, ok = not.Right.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", not.Right)
+	require.Equal(t, token.AndAlso, and.Op)
+	low, high = and.Left.(*ast.BinaryExpr), and.Right.(*ast.BinaryExpr)
+	require.Equal(t, token.GreaterEqual, low.Op)
+	require.Equal(t, "x", low.Left.(*ast.Identifier).Name)
+	require.Equal(t, token.LessEqual, high.Op)
+	require.Equal(t, "x", high.Left.(*ast.Identifier).Name)
+
+	// and the range after andalso only tests x
+	guard, err = Guard([]byte("y andalso x in 1..10"))
+	require.NoError(t, err)
+	and, ok = guard.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", guard)
+	require.Equal(t, "y", and.Left.(*ast.Identifier).Name)
+	inner, ok := and.Right.(*ast.BinaryExpr)
+	require.True(t, ok, "got %T", and.Right)
+	require.Equal(t, token.AndAlso, inner.Op)
+	require.Equal(t, "x", inner.Left.(*ast.BinaryExpr).Left.(*ast.Identifier).Name)
+
+	// the guard BIFs can be called without the module, like in a `when` clause
+	_, err = Guard([]byte("is_list(x) andalso length(x) > 0"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{"x > 0, lists.member(x, xs)", "<string>:1:8: call to lists.member/2 is not allowed in a guard"},
+		{"erlang.length(send(p, x)) > 0", "<string>:1:15: call to send/2 is not allowed in a guard"},
+		{"case x { _ -> 'true' }", "<string>:1:1: case expression is not allowed in a guard"},
+		{"xs -- [1] == []", "<string>:1:4: '--' is not allowed in a guard"},
+		{"erlang.max(xs...) > 0", "<string>:1:14: '...' is not allowed in a guard"},
+		{"is_list(x) andalso lists.member(1, x)", "<string>:1:20: call to lists.member/2 is not allowed in a guard"},
+		{"x > 0 }", "<string>:1:7: unexpected } after guard"},
+	}
+	for _, tt := range tests {
+		_, err := Guard([]byte(tt.input))
+		require.EqualError(t, err, tt.wantErr, tt.input)
+	}
+}
+
+func TestParseType(t *testing.T) {
+	typ, err := Type([]byte("tuple[int, lists.t]\n"))
+	require.NoError(t, err)
+	tuple, ok := typ.(*ast.TupleType)
+	require.True(t, ok, "got %T", typ)
+	require.Len(t, tuple.Elts.List, 2)
+	require.Equal(t, "int", tuple.Elts.List[0].Type.(*ast.Identifier).Name)
+	require.IsType(t, &ast.DotExpr{}, tuple.Elts.List[1].Type)
+
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{"tuple[int, string] x", "<string>:1:20: unexpected x after type"},
+		{"int]", "<string>:1:4: unexpected ] after type"},
+		{"tuple[int string]", "<string>:1:11: missing ',' in tuple type list, got string"},
+		{"1", "<string>:1:1: expected type, got IntLiteral"},
+		{"tuple[int", "<string>:1:10: missing ',' in tuple type list, got EOF"},
+	}
+	for _, tt := range tests {
+		_, err := Type([]byte(tt.input))
+		require.EqualError(t, err, tt.wantErr, tt.input)
+	}
+}
+
+func TestParseMaxErrors(t *testing.T) {
+	var src bytes.Buffer
+	src.WriteString("module test\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&src, "func f%d() { return ) }\n", i)
+	}
+	tests := []struct {
+		opts []Option
+		want int
+	}{
+		{want: defaultMaxErrors},
+		{opts: []Option{WithMaxErrors(5)}, want: 5},
+		{opts: []Option{WithMaxErrors(50)}, want: 20},
+		{opts: []Option{WithMaxErrors(0)}, want: 20}, // unlimited
+	}
+	for _, tt := range tests {
+		_, err := Module("<test>", src.Bytes(), tt.opts...)
+		var perr Error
+		require.ErrorAs(t, err, &perr)
+		require.Len(t, perr.Errors, tt.want)
+		for i, e := range perr.Errors {
+			require.Equal(t, i+2, e.Pos.Line, "one error for each function")
+		}
+	}
+}
+
+func TestParseBuildTags(t *testing.T) {
+	const input = `module test
+
+func a() { return 1 }
+
+//+build linux darwin
+func b() { return 2 }
+
+// A doc comment.
+//+build !windows
+func c() { return 3 }
+`
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{want: []string{"a", "c"}},
+		{tags: []string{"linux"}, want: []string{"a", "b", "c"}},
+		{tags: []string{"darwin", "windows"}, want: []string{"a", "b"}},
+		{tags: []string{"windows"}, want: []string{"a"}},
+	}
+	for _, tt := range tests {
+		mod, err := Module("<test>", []byte(input), WithTags(tt.tags...))
+		require.NoError(t, err, tt.tags)
+		var names []string
+		for _, decl := range mod.Decls {
+			names = append(names, decl.(*ast.FuncDecl).Name.Name)
+		}
+		require.Equal(t, tt.want, names, tt.tags)
+	}
+}
+
+// TestGuardInEveryClause checks that a guard parses the same in a function head, a case
+// clause and a receive clause.
+func TestGuardInEveryClause(t *testing.T) {
+	const guard = "when x > 0, x < 10; x == -1"
+	inputs := []string{
+		"module test; func f(x) " + guard + " { return x }",
+		"module test; func f(y) { return case y { x " + guard + " -> x } }",
+		"module test; func f() { return receive { x " + guard + " -> x } }",
+	}
+	var guards []string
+	for _, input := range inputs {
+		mod, err := Module("<test>", []byte(input))
+		require.NoError(t, err, input)
+
+		var seq *ast.GuardSeq
+		ast.Inspect(mod, func(node ast.Node) bool {
+			if g, ok := node.(*ast.GuardSeq); ok {
+				seq = g
+			}
+			return seq == nil
+		})
+		require.NotNil(t, seq, input)
+		var out bytes.Buffer
+		ast.Fprint(&out, nil, seq, ast.NotNilFilter)
+		// the guards are at different offsets, so only compare their structure
+		guards = append(guards, positions.ReplaceAllString(out.String(), "$1"))
+	}
+	require.Equal(t, guards[0], guards[1], "case guard")
+	require.Equal(t, guards[0], guards[2], "receive guard")
+}
+
+// positions matches the positions printed by ast.Fprint.
+var positions = regexp.MustCompile(`(Pos|When|OpPos): \d+`)
+
+func TestOperatorPositions(t *testing.T) {
+	input := `module test
+func f(x) {
+	a = -x
+	b, c = {a + 1, 2}
+	{d, _} := {b * c, x is int}
+	[e] = [d]
+	return e
+}`
+	mod, err := Module("<test>", []byte(input))
+	require.NoError(t, err)
+
+	var ops []string
+	ast.Inspect(mod, func(node ast.Node) bool {
+		if op, ok := node.(ast.OpExpr); ok {
+			typ, pos := op.Operator()
+			ops = append(ops, fmt.Sprintf("%s %s", mod.File.Position(pos), typ))
+		}
+		return true
+	})
+	assert.Equal(t, []string{
+		"<test>:3:4 Equal",
+		"<test>:3:6 Minus",
+		"<test>:4:7 Equal",
+		"<test>:4:12 Plus",
+		"<test>:5:9 ColonEqual",
+		"<test>:5:15 Star",
+		"<test>:5:22 Is",
+		"<test>:6:6 Equal",
+	}, ops)
+}
+
+func TestNoOrphanFixtures(t *testing.T) {
+	golden.CheckOrphans(t)
+}
@@ -0,0 +1,269 @@
+// Package resolve binds every identifier in a module to the declaration it refers to.
+//
+// Unlike the compiler, the resolver only reports what names mean and is meant to be reused
+// by tooling like goto-definition and rename.
+package resolve
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/token"
+)
+
+// Scopes is the result of resolving a module.
+type Scopes struct {
+	Module *ast.Scope                      // functions, constants, types and imports of the module
+	Funcs  map[*ast.FuncDecl]*ast.Scope    // parameters and variables bound in each function
+	Uses   map[*ast.Identifier]*ast.Object // identifier uses to the object they refer to
+
+	Unresolved []*ast.Identifier // identifier uses that refer to nothing, in source order
+}
+
+// Module resolves all the identifiers in mod. The scopes are always returned, and an
+// error listing every unresolved identifier is returned if there are any.
+func Module(mod *ast.Module) (*Scopes, error) {
+	r := &resolver{
+		file:   mod.File,
+		blocks: make(map[*ast.Scope]bool),
+		scopes: &Scopes{
+			Module: ast.NewScope(nil),
+			Funcs:  make(map[*ast.FuncDecl]*ast.Scope),
+			Uses:   make(map[*ast.Identifier]*ast.Object),
+		},
+	}
+	r.declareModule(mod)
+	for _, decl := range mod.Decls {
+		ast.Walk(r, decl)
+	}
+	return r.scopes, r.errors.Err()
+}
+
+type resolver struct {
+	file   *token.File
+	scopes *Scopes
+	scope  *ast.Scope // innermost scope, nil outside of functions
+	errors token.ErrorList
+	blocks map[*ast.Scope]bool // scopes of if statements, which can assign outer variables
+}
+
+// declareModule inserts every top level declaration into the module scope so functions
+// can refer to declarations that come after them.
+func (r *resolver) declareModule(mod *ast.Module) {
+	for _, decl := range mod.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			r.insert(r.scopes.Module, ast.Fun, d.Name.Name, d)
+		case *ast.ConstDecl:
+			r.insert(r.scopes.Module, ast.Con, d.Name.Name, d)
+		case *ast.GuardDecl:
+			r.insert(r.scopes.Module, ast.Fun, d.Name.Name, d)
+		case *ast.TypeDecl:
+			r.insert(r.scopes.Module, ast.Typ, d.Name.Name, d)
+		case *ast.ImportDecl:
+			name := path.Base(d.Path.Value)
+			if d.Alias != nil {
+				name = d.Alias.Name
+			}
+			r.insert(r.scopes.Module, ast.Mod, name, d)
+			for _, fn := range d.Funcs {
+				r.insert(r.scopes.Module, ast.Fun, fn.Name.Name, d)
+			}
+		}
+	}
+}
+
+func (r *resolver) insert(scope *ast.Scope, kind ast.ObjKind, name string, decl any) *ast.Object {
+	obj := ast.NewObj(kind, name)
+	obj.Decl = decl
+	if alt := scope.Insert(obj); alt != nil {
+		return alt // functions with the same name and different arities share an object
+	}
+	return obj
+}
+
+func (r *resolver) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		r.scope = ast.NewScope(r.scopes.Module)
+		r.scopes.Funcs[n] = r.scope
+		for _, param := range n.Parameters {
+			r.bind(param)
+		}
+		if n.Guard != nil {
+			ast.Walk(r, n.Guard)
+		}
+		for _, stmt := range n.Statements {
+			ast.Walk(r, stmt)
+		}
+		r.scope = nil
+		return nil
+	case *ast.TypeDecl, *ast.ImportDecl:
+		return nil // types are resolved by the type checker
+	case *ast.ConstDecl:
+		ast.Walk(r, n.Value)
+		return nil
+	case *ast.GuardDecl:
+		r.scope = ast.NewScope(r.scopes.Module)
+		for _, param := range n.Parameters {
+			r.bind(param)
+		}
+		ast.Walk(r, n.Body)
+		r.scope = nil
+		return nil
+	case *ast.AssignExpr:
+		// the right side is evaluated before the name is bound
+		ast.Walk(r, n.Right)
+		r.bind(n.Left)
+		return nil
+	case *ast.MatchAssignExpr:
+		ast.Walk(r, n.Right)
+		r.bind(n.Left)
+		return nil
+	case *ast.MultiAssignExpr:
+		ast.Walk(r, n.Right)
+		for _, ident := range n.Left {
+			r.bind(ident)
+		}
+		return nil
+	case *ast.LetExpr:
+		// the value is evaluated before the name is bound, which is only visible in the body
+		ast.Walk(r, n.Value)
+		outer := r.scope
+		r.scope = ast.NewScope(outer)
+		r.scopes.Uses[n.Name] = r.insert(r.scope, ast.Var, n.Name.Name, n.Name)
+		ast.Walk(r, n.Body)
+		r.scope = outer
+		return nil
+	case *ast.IfStmt:
+		// the names bound by the init statement are only visible in the if, and the names
+		// bound by each branch only in that branch
+		outer := r.scope
+		r.scope = ast.NewScope(outer)
+		if n.Init != nil {
+			ast.Walk(r, n.Init) // binds new variables, even if the names are bound outside
+		}
+		r.blocks[r.scope] = true
+		ast.Walk(r, n.Cond)
+		init := r.scope
+		r.scope = ast.NewScope(init)
+		r.blocks[r.scope] = true
+		for _, stmt := range n.Body {
+			ast.Walk(r, stmt)
+		}
+		if n.Else != nil {
+			// the else branch sees the names bound by the init statement, but not the body
+			r.scope = init
+			ast.Walk(r, n.Else)
+		}
+		r.scope = outer
+		return nil
+	case *ast.BlockStmt:
+		outer := r.scope
+		r.scope = ast.NewScope(outer)
+		r.blocks[r.scope] = true
+		for _, stmt := range n.List {
+			ast.Walk(r, stmt)
+		}
+		r.scope = outer
+		return nil
+	case *ast.FuncLit:
+		// the name of a named fun and its parameters are only visible in its body
+		outer := r.scope
+		r.scope = ast.NewScope(outer)
+		if n.Name != nil {
+			r.scopes.Uses[n.Name] = r.insert(r.scope, ast.Fun, n.Name.Name, n)
+		}
+		for _, param := range n.Parameters {
+			r.bind(param)
+		}
+		for _, stmt := range n.Statements {
+			ast.Walk(r, stmt)
+		}
+		r.scope = outer
+		return nil
+	case *ast.TypeTestExpr:
+		ast.Walk(r, n.X)
+		return nil // the type is built-in
+	case *ast.Clause:
+		// like in Erlang, the variables bound by a clause belong to the whole function
+		for _, pattern := range n.Patterns {
+			r.bind(pattern)
+		}
+		if n.Guard != nil {
+			ast.Walk(r, n.Guard)
+		}
+		ast.Walk(r, n.Body)
+		return nil
+	case *ast.CallExpr:
+		if ident, ok := n.Callee.(*ast.Identifier); ok {
+			r.resolve(ident) // local function call
+		} else {
+			ast.Walk(r, n.Callee)
+		}
+		for _, arg := range n.Arguments {
+			ast.Walk(r, arg)
+		}
+		return nil
+	case *ast.DotExpr:
+		if ident, ok := n.Target.(*ast.Identifier); ok {
+			// either an imported module or any other Erlang module, which are not declared
+			if obj := r.lookup(ident.Name); obj != nil {
+				r.scopes.Uses[ident] = obj
+			}
+		} else {
+			ast.Walk(r, n.Target)
+		}
+		return nil // the attribute belongs to the target
+	case *ast.Identifier:
+		r.resolve(n)
+		return nil
+	}
+	return r
+}
+
+// bind declares every identifier in the pattern as a variable in the current scope.
+// An identifier that is already bound refers to the existing variable instead, and so
+// does a pinned variable, which must be bound.
+func (r *resolver) bind(pattern ast.Expression) {
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		if pin, ok := node.(*ast.PinExpr); ok {
+			r.resolve(pin.Var)
+			return false
+		}
+		ident, ok := node.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		for s := r.scope; s != nil; s = s.Outer {
+			if obj := s.Lookup(ident.Name); obj != nil {
+				r.scopes.Uses[ident] = obj
+				return false
+			}
+			if !r.blocks[s] {
+				break
+			}
+		}
+		r.scopes.Uses[ident] = r.insert(r.scope, ast.Var, ident.Name, ident)
+		return false
+	})
+}
+
+func (r *resolver) lookup(name string) *ast.Object {
+	for s := r.scope; s != nil; s = s.Outer {
+		if obj := s.Lookup(name); obj != nil {
+			return obj
+		}
+	}
+	return r.scopes.Module.Lookup(name)
+}
+
+func (r *resolver) resolve(ident *ast.Identifier) {
+	if obj := r.lookup(ident.Name); obj != nil {
+		r.scopes.Uses[ident] = obj
+		return
+	}
+	r.scopes.Unresolved = append(r.scopes.Unresolved, ident)
+	r.errors.Add(r.file.Position(ident.Pos()), fmt.Errorf("undefined: %s", ident.Name))
+}
@@ -0,0 +1,207 @@
+package resolve
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/parser"
+	"github.com/masp/garlang/token"
+	"github.com/stretchr/testify/require"
+)
+
+// findIdents returns every identifier named name in node, in source order.
+func findIdents(node ast.Node, name string) []*ast.Identifier {
+	var idents []*ast.Identifier
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Name == name {
+			idents = append(idents, ident)
+		}
+		return true
+	})
+	return idents
+}
+
+func TestResolveParameter(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func add(a, b) {
+	c = a + b
+	return double(c)
+}
+func double(x) { return x * 2 }`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.NoError(t, err)
+
+	a := findIdents(mod, "a")
+	require.Len(t, a, 2)
+	obj := scopes.Uses[a[1]]
+	require.NotNil(t, obj)
+	require.Equal(t, ast.Var, obj.Kind)
+	require.Equal(t, a[0].Pos(), obj.Pos(), "use of a should resolve to the parameter")
+
+	c := findIdents(mod, "c")
+	require.Len(t, c, 2)
+	require.Same(t, scopes.Uses[c[0]], scopes.Uses[c[1]], "use of c should resolve to the assignment")
+
+	double := findIdents(mod, "double")
+	require.Len(t, double, 2)
+	fn := scopes.Uses[double[0]]
+	require.NotNil(t, fn)
+	require.Equal(t, ast.Fun, fn.Kind)
+	require.Equal(t, double[1].Pos(), fn.Pos(), "call should resolve to the function declared later")
+}
+
+func TestResolveUnresolved(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func f(a) {
+	return a + unknown
+}`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.EqualError(t, err, "<test>:3:13: undefined: unknown")
+	require.IsType(t, token.ErrorList{}, err)
+	require.Len(t, scopes.Unresolved, 1)
+	require.Equal(t, "unknown", scopes.Unresolved[0].Name)
+}
+
+func TestResolveScopesArePerFunction(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func f(a) { return a }
+func g() { return a }`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.Error(t, err)
+	require.Len(t, scopes.Funcs, 2)
+	require.Len(t, scopes.Unresolved, 1)
+	require.Equal(t, 3, mod.File.Line(scopes.Unresolved[0].Pos()))
+}
+
+func TestResolveLetScope(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func f(x) {
+	return {let x = x + 1 in x * 2, x}
+}`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.NoError(t, err)
+
+	x := findIdents(mod, "x")
+	require.Len(t, x, 5) // parameter, let name, value, body and after the let
+	param, name := scopes.Uses[x[0]], scopes.Uses[x[1]]
+	require.NotSame(t, param, name, "let should declare a new variable")
+	require.Same(t, param, scopes.Uses[x[2]], "value is evaluated before the name is bound")
+	require.Same(t, name, scopes.Uses[x[3]])
+	require.Same(t, param, scopes.Uses[x[4]], "name is only visible in the body")
+}
+
+func TestResolveIfScope(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func f(n) {
+	if x := n + 1; x > 0 {
+		n = x
+	}
+	return x
+}`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.EqualError(t, err, "<test>:6:9: undefined: x", "x is only visible in the if")
+
+	x := findIdents(mod, "x")
+	require.Len(t, x, 4)
+	require.Same(t, scopes.Uses[x[0]], scopes.Uses[x[1]])
+	require.Same(t, scopes.Uses[x[0]], scopes.Uses[x[2]])
+
+	n := findIdents(mod, "n")
+	require.Len(t, n, 3)
+	require.Same(t, scopes.Uses[n[0]], scopes.Uses[n[2]], "the body assigns the parameter")
+}
+
+func TestResolveIfInitShadows(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func f(x) {
+	if x := erlang.abs(x); x > 5 {
+		x = 2
+	}
+	return x
+}`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.NoError(t, err)
+
+	x := findIdents(mod, "x")
+	require.Len(t, x, 6)
+	// the init's x is visited before its value
+	require.Same(t, scopes.Uses[x[0]], scopes.Uses[x[2]], "the init's value uses the parameter")
+	require.NotSame(t, scopes.Uses[x[0]], scopes.Uses[x[1]], "the init binds a new x")
+	require.Same(t, scopes.Uses[x[1]], scopes.Uses[x[3]], "the condition uses the init's x")
+	require.Same(t, scopes.Uses[x[1]], scopes.Uses[x[4]], "the body assigns the init's x")
+	require.Same(t, scopes.Uses[x[0]], scopes.Uses[x[5]], "the parameter is returned")
+}
+
+func TestResolveElseScope(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+func f(n) {
+	if x := n + 1; x > 0 {
+		y = x
+	} else {
+		n = x
+		return y
+	}
+}`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.EqualError(t, err, "<test>:7:10: undefined: y", "y is only visible in the if branch")
+
+	x := findIdents(mod, "x")
+	require.Len(t, x, 4)
+	require.Same(t, scopes.Uses[x[0]], scopes.Uses[x[3]], "the else branch sees the init statement")
+
+	n := findIdents(mod, "n")
+	require.Len(t, n, 3)
+	require.Same(t, scopes.Uses[n[0]], scopes.Uses[n[2]], "the else branch assigns the parameter")
+}
+
+func TestResolveGuardDecl(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+guard even(x) = x % 2 == 0
+func f(n) when even(n) { return n }`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.NoError(t, err)
+
+	even := findIdents(mod, "even")
+	require.Len(t, even, 2)
+	obj := scopes.Uses[even[1]]
+	require.NotNil(t, obj)
+	require.Equal(t, ast.Fun, obj.Kind)
+	require.Equal(t, even[0].Pos(), obj.Pos(), "call should resolve to the guard")
+
+	x := findIdents(mod, "x")
+	require.Len(t, x, 2)
+	require.Same(t, scopes.Uses[x[0]], scopes.Uses[x[1]], "use of x should resolve to the guard parameter")
+}
+
+func TestResolveImportedFunc(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(`module test
+import "lists" (sum/1)
+func f(xs) { return sum(xs) }`))
+	require.NoError(t, err)
+
+	scopes, err := Module(mod)
+	require.NoError(t, err)
+
+	sum := findIdents(mod, "sum")
+	require.Len(t, sum, 2)
+	obj := scopes.Uses[sum[1]]
+	require.NotNil(t, obj)
+	require.Equal(t, ast.Fun, obj.Kind)
+	require.Equal(t, sum[0].Pos(), obj.Pos(), "call should resolve to the import")
+}
@@ -153,13 +153,14 @@ func (f *File) Line(p Pos) int {
 // PositionFor returns the Position value for the given file position p.
 // If adjusted is set, the position may be adjusted by position-altering
 // //line comments; otherwise those comments are ignored.
-// p must be a Pos value in f or NoPos.
+// p must be a Pos value in f or NoPos. The position right after the last character,
+// f.Pos(f.Size), is valid too.
 func (f *File) Position(p Pos) (pos Position) {
 	pos = Position{Filename: f.Name, Offset: p}
 	if p != NoPos {
 		offset := int(p) - 1
-		if offset < 0 || offset >= f.Size {
-			panic(fmt.Sprintf("invalid Pos value %d (should be in [%d, %d])", p, 1, f.Size))
+		if offset < 0 || offset > f.Size {
+			panic(fmt.Sprintf("invalid Pos value %d (should be in [%d, %d])", p, 1, f.Size+1))
 		}
 		f.lineMut.Lock()
 		defer f.lineMut.Unlock()
@@ -16,12 +16,21 @@ const (
 	String
 	Integer
 	Float
+	Nil
 	literal_end
 
+	// String interpolation. "a #{x} b #{y} c" is lexed as InterpHead("a "), the tokens of
+	// x, InterpMid(" b "), the tokens of y and InterpTail(" c").
+	InterpHead
+	InterpMid
+	InterpTail
+
 	// Comparisons
 	Bang
 	EqualEqual
 	BangEqual
+	EqualEqualEqual // '===', exact equality
+	BangEqualEqual  // '!==', exact inequality
 	LessEqual
 	Less
 	GreaterEqual
@@ -32,9 +41,13 @@ const (
 	Minus
 	Slash
 	Star
+	Percent
+	MinusMinus // '--', list subtraction
 
 	// Other
 	Period
+	DotDot   // '..' in a range like `1..10`
+	Ellipsis // '...' after the last argument of a call, `f(args...)`
 	Colon
 	Equal
 	ColonEqual
@@ -46,8 +59,16 @@ const (
 	LSquareBracket // '['
 	RSquareBracket // ']'
 	Comma
+	Pipe     // '|'
+	Question // '?'
+	Caret    // '^'
+	At       // '@'
+	Arrow    // '->'
+	Indent   // increase in indentation, only with lexer.Options.Indentation
+	Dedent   // decrease in indentation, only with lexer.Options.Indentation
 
 	// Keywords
+	keyword_begin
 	Func
 	Return
 	Module
@@ -55,45 +76,107 @@ const (
 	Map
 	TypeKeyword
 	Import
+	Const
+	When
+	While
+	Case
+	Fn           // fun expression
+	Is           // type test, `x is int`
+	Guard        // guard declaration, `guard even(x) = x % 2 == 0`
+	CatchKeyword // `catch expr`, turns exceptions into values
+	Receive
+	After   // timeout of a receive, `after 1000 -> 'timeout'`
+	And     // evaluates both sides, like Erlang's and
+	Or      // evaluates both sides, like Erlang's or
+	Not     // boolean negation, like Erlang's not
+	AndAlso // short-circuit and
+	OrElse  // short-circuit or
+	Let     // `let x = e1 in e2`
+	In
+	Defer // `defer expr`, evaluates expr when the function returns
+	If    // `if x := f(); x > 0 { ... }`
+	Else  // `if a { ... } else { ... }`
+	keyword_end
 
 	EOF Type = 999 // must be at end
 )
 
 var types = [...]string{
-	Invalid:        "Invalid",
-	Comment:        "Comment",
-	Atom:           "Atom",
-	Identifier:     "Identifier",
-	String:         "String",
-	Integer:        "IntLiteral",
-	Float:          "FloatLiteral",
-	Bang:           "Bang",
-	EqualEqual:     "EqualEqual",
-	BangEqual:      "BangEqual",
-	LessEqual:      "LessEqual",
-	Less:           "Less",
-	GreaterEqual:   "GreaterEqual",
-	Greater:        "Greater",
-	Plus:           "Plus",
-	Minus:          "Minus",
-	Slash:          "Slash",
-	Star:           "Star",
-	Period:         "Period",
-	Colon:          "Colon",
-	Equal:          "Equal",
-	ColonEqual:     "ColonEqual",
-	Semicolon:      "Semicolon",
-	LParen:         "LeftParen",
-	RParen:         "RightParen",
-	LCurlyBracket:  "LeftBrace",
-	RCurlyBracket:  "RightBrace",
-	LSquareBracket: "LeftSquareBracket",
-	RSquareBracket: "RightSquareBracket",
-	Comma:          "Comma",
-	Func:           "Func",
-	Return:         "Return",
-	Module:         "Module",
-	EOF:            "EOF",
+	Invalid:         "Invalid",
+	Comment:         "Comment",
+	Atom:            "Atom",
+	Identifier:      "Identifier",
+	String:          "String",
+	Integer:         "IntLiteral",
+	Float:           "FloatLiteral",
+	Nil:             "Nil",
+	InterpHead:      "InterpHead",
+	InterpMid:       "InterpMid",
+	InterpTail:      "InterpTail",
+	Bang:            "Bang",
+	EqualEqual:      "EqualEqual",
+	BangEqual:       "BangEqual",
+	EqualEqualEqual: "EqualEqualEqual",
+	BangEqualEqual:  "BangEqualEqual",
+	LessEqual:       "LessEqual",
+	Less:            "Less",
+	GreaterEqual:    "GreaterEqual",
+	Greater:         "Greater",
+	Plus:            "Plus",
+	Minus:           "Minus",
+	Slash:           "Slash",
+	Star:            "Star",
+	Percent:         "Percent",
+	MinusMinus:      "MinusMinus",
+	Period:          "Period",
+	DotDot:          "DotDot",
+	Ellipsis:        "Ellipsis",
+	Colon:           "Colon",
+	Equal:           "Equal",
+	ColonEqual:      "ColonEqual",
+	Semicolon:       "Semicolon",
+	LParen:          "LeftParen",
+	RParen:          "RightParen",
+	LCurlyBracket:   "LeftBrace",
+	RCurlyBracket:   "RightBrace",
+	LSquareBracket:  "LeftSquareBracket",
+	RSquareBracket:  "RightSquareBracket",
+	Comma:           "Comma",
+	Pipe:            "Pipe",
+	Question:        "Question",
+	Caret:           "Caret",
+	At:              "At",
+	Arrow:           "Arrow",
+	Indent:          "Indent",
+	Dedent:          "Dedent",
+	Func:            "Func",
+	Return:          "Return",
+	Module:          "Module",
+	Tuple:           "Tuple",
+	Map:             "Map",
+	TypeKeyword:     "Type",
+	Import:          "Import",
+	Const:           "Const",
+	When:            "When",
+	While:           "While",
+	Case:            "Case",
+	Fn:              "Fn",
+	Is:              "Is",
+	Guard:           "Guard",
+	CatchKeyword:    "Catch",
+	Receive:         "Receive",
+	After:           "After",
+	And:             "And",
+	Or:              "Or",
+	Not:             "Not",
+	AndAlso:         "AndAlso",
+	OrElse:          "OrElse",
+	Let:             "Let",
+	In:              "In",
+	Defer:           "Defer",
+	If:              "If",
+	Else:            "Else",
+	EOF:             "EOF",
 }
 
 func (tok Type) String() string {
@@ -110,3 +193,61 @@ func (tok Type) String() string {
 func (tok Type) IsLiteral() bool {
 	return literal_begin < tok && tok < literal_end
 }
+
+// keywords are the spellings of the reserved words, which the lexer matches itself.
+var keywords = map[string]Type{
+	"func": Func, "return": Return, "module": Module, "tuple": Tuple, "map": Map,
+	"type": TypeKeyword, "import": Import, "const": Const, "when": When, "while": While,
+	"case": Case, "fn": Fn, "is": Is, "guard": Guard, "catch": CatchKeyword,
+	"receive": Receive, "after": After, "and": And, "or": Or, "not": Not, "andalso": AndAlso,
+	"orelse": OrElse, "let": Let, "in": In, "nil": Nil, "defer": Defer,
+	"if": If, "else": Else,
+}
+
+// Lookup returns the reserved word spelled ident, like Func for "func", or Identifier if
+// ident is not reserved. nil is reserved as well, although it is a literal.
+func Lookup(ident string) Type {
+	if tok, ok := keywords[ident]; ok {
+		return tok
+	}
+	return Identifier
+}
+
+// IsKeyword reports whether tok is a reserved word like func or return.
+func (tok Type) IsKeyword() bool {
+	return keyword_begin < tok && tok < keyword_end
+}
+
+// IsBinaryOp reports whether tok is an operator of binary expressions like a + b.
+func (tok Type) IsBinaryOp() bool {
+	_, ok := tok.Precedence()
+	return ok
+}
+
+// Precedence returns the binding power of tok as a binary operator. Operators with a
+// higher precedence bind tighter, so a + b * c is a + (b * c). All binary operators are
+// left-associative. If tok is not a binary operator, ok is false.
+//
+// Unlike in Erlang, where and and or bind like * and +, the boolean operators all bind
+// looser than comparisons, so `a > 0 and b > 0` needs no parentheses. List subtraction
+// binds like in Erlang, looser than + and tighter than comparisons, but it is
+// left-associative too, so `xs -- ys -- zs` removes ys and then zs from xs.
+func (tok Type) Precedence() (prec int, ok bool) {
+	switch tok {
+	case Or, OrElse:
+		return 1, true
+	case And, AndAlso:
+		return 2, true
+	case EqualEqual, BangEqual, EqualEqualEqual, BangEqualEqual:
+		return 3, true
+	case Less, LessEqual, Greater, GreaterEqual, Is:
+		return 4, true
+	case MinusMinus:
+		return 5, true
+	case Plus, Minus:
+		return 6, true
+	case Star, Slash, Percent:
+		return 7, true
+	}
+	return 0, false
+}
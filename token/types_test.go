@@ -6,8 +6,42 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func TestPrecedence(t *testing.T) {
+	prec := func(tok Type) int {
+		p, ok := tok.Precedence()
+		require.True(t, ok, "%s is a binary operator", tok)
+		return p
+	}
+	require.Greater(t, prec(Star), prec(Plus), "* binds tighter than +")
+	require.Equal(t, prec(Plus), prec(Minus))
+	require.Less(t, prec(EqualEqual), prec(Less), "== binds looser than <")
+	require.Less(t, prec(Less), prec(MinusMinus), "-- binds tighter than <")
+	require.Less(t, prec(MinusMinus), prec(Plus), "-- binds looser than +")
+
+	_, ok := Equal.Precedence()
+	require.False(t, ok, "assignment is not a binary operator")
+	require.False(t, Identifier.IsBinaryOp())
+	require.True(t, Percent.IsBinaryOp())
+	require.Equal(t, prec(Less), prec(Is), "type tests bind like comparisons")
+}
+
 func TestTokenTypeSTring(t *testing.T) {
 	for i := Invalid; i < EOF; i += 1 {
 		require.NotPanics(t, func() { _ = i.String() })
 	}
 }
+
+func TestLookup(t *testing.T) {
+	require.Equal(t, Func, Lookup("func"))
+	require.Equal(t, Identifier, Lookup("Func"))
+	require.Equal(t, Identifier, Lookup("x"))
+
+	// every keyword has a spelling
+	spelled := make(map[Type]bool)
+	for _, tok := range keywords {
+		spelled[tok] = true
+	}
+	for tok := keyword_begin + 1; tok < keyword_end; tok++ {
+		require.True(t, spelled[tok], "%s has no spelling", tok)
+	}
+}
@@ -0,0 +1,17 @@
+package tooling
+
+import "github.com/masp/garlang/ast"
+
+// ReplaceDecl returns a copy of src with the text of decl, which was parsed from src,
+// replaced by newText. The rest of src is kept byte for byte, so editing one declaration
+// doesn't reformat the others. The text of a function includes its doc comment.
+func ReplaceDecl(src []byte, decl ast.Decl, newText []byte) []byte {
+	start, end := decl.Pos(), decl.End()
+	if fn, ok := decl.(*ast.FuncDecl); ok {
+		start, end = fn.Span()
+	}
+	out := make([]byte, 0, len(src)-(end.Offset()-start.Offset())+len(newText))
+	out = append(out, src[:start.Offset()]...)
+	out = append(out, newText...)
+	return append(out, src[end.Offset():]...)
+}
@@ -0,0 +1,54 @@
+package tooling
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceDecl(t *testing.T) {
+	src := []byte(`module edit
+
+// add returns the sum.
+func add(a, b) {
+	return a + b
+}
+
+func   twice(x)   { return add(x, x) }   // keeps its odd spacing
+`)
+	mod, err := parser.Module("<test>", src)
+	require.NoError(t, err)
+
+	add, ok := mod.Func("add", 2)
+	require.True(t, ok)
+	out := ReplaceDecl(src, add, []byte("// sub returns the difference.\nfunc sub(a, b) { return a - b }"))
+	require.Equal(t, `module edit
+
+// sub returns the difference.
+func sub(a, b) { return a - b }
+
+func   twice(x)   { return add(x, x) }   // keeps its odd spacing
+`, string(out))
+
+	_, err = parser.Module("<test>", out)
+	require.NoError(t, err, "the edited source should still parse")
+}
+
+func TestFuncDeclSpan(t *testing.T) {
+	src := []byte("module m\n// doc\nfunc f() { return 1 }\nfunc g() { return 2 }")
+	mod, err := parser.Module("<test>", src)
+	require.NoError(t, err)
+
+	spans := map[string]string{}
+	for _, decl := range mod.Decls {
+		fn := decl.(*ast.FuncDecl)
+		start, end := fn.Span()
+		spans[fn.Name.Name] = string(src[start.Offset():end.Offset()])
+	}
+	require.Equal(t, map[string]string{
+		"f": "// doc\nfunc f() { return 1 }",
+		"g": "func g() { return 2 }",
+	}, spans)
+}
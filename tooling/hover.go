@@ -0,0 +1,107 @@
+// Package tooling answers editor queries about a parsed module, like what the name under
+// the cursor refers to. It is the backend for the language server.
+package tooling
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/resolve"
+	"github.com/masp/garlang/token"
+)
+
+// Hover returns a human-readable description of the name at pos, like "parameter a" or
+// "function foo/2" followed by the function's doc comment. It returns false if there is
+// no name at pos or the name refers to nothing.
+func Hover(mod *ast.Module, pos token.Pos) (string, bool) {
+	ident, fn, call := identAt(mod, pos)
+	if ident == nil {
+		return "", false
+	}
+	if fn != nil && fn.Name == ident {
+		return describeFunc(fn), true
+	}
+
+	scopes, _ := resolve.Module(mod) // unresolved names are reported as not found below
+	obj := scopes.Uses[ident]
+	if obj == nil {
+		return "", false
+	}
+	switch obj.Kind {
+	case ast.Var:
+		if fn != nil && isParam(fn, obj.Decl) {
+			return "parameter " + obj.Name, true
+		}
+		return "variable " + obj.Name, true
+	case ast.Fun:
+		decl, _ := obj.Decl.(*ast.FuncDecl)
+		if call != nil {
+			// functions with the same name share an object, so use the arity of the call
+			decl, _ = mod.Func(obj.Name, len(call.Arguments))
+		}
+		if decl == nil {
+			return "function " + obj.Name, true
+		}
+		return describeFunc(decl), true
+	case ast.Con:
+		return "constant " + obj.Name, true
+	case ast.Typ:
+		return "type " + obj.Name, true
+	case ast.Mod:
+		if imp, ok := obj.Decl.(*ast.ImportDecl); ok {
+			return fmt.Sprintf("module %s (%q)", path.Base(imp.Path.Value), imp.Path.Value), true
+		}
+		return "module " + obj.Name, true
+	}
+	return "", false
+}
+
+// identAt returns the identifier containing pos, the function it is in and, if the
+// identifier is the callee of a call, the call.
+func identAt(mod *ast.Module, pos token.Pos) (ident *ast.Identifier, fn *ast.FuncDecl, call *ast.CallExpr) {
+	for _, decl := range mod.Decls {
+		if decl.Pos() > pos || pos >= decl.End() {
+			continue
+		}
+		fn, _ = decl.(*ast.FuncDecl)
+		ast.Inspect(decl, func(node ast.Node) bool {
+			if node == nil || ident != nil || node.Pos() > pos || pos >= node.End() {
+				return false
+			}
+			switch n := node.(type) {
+			case *ast.Identifier:
+				ident = n
+			case *ast.CallExpr:
+				if callee, ok := n.Callee.(*ast.Identifier); ok && callee.Pos() <= pos && pos < callee.End() {
+					call = n
+				}
+			}
+			return true
+		})
+		return ident, fn, call
+	}
+	return nil, nil, nil
+}
+
+// isParam reports whether the binding identifier decl is a parameter of fn.
+func isParam(fn *ast.FuncDecl, decl any) bool {
+	found := false
+	for _, param := range fn.Parameters {
+		ast.Inspect(param, func(node ast.Node) bool {
+			if node != nil && node == decl {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+func describeFunc(fn *ast.FuncDecl) string {
+	desc := fmt.Sprintf("function %s/%d", fn.Name.Name, len(fn.Parameters))
+	if doc := fn.Doc.Text(); doc != "" {
+		desc += "\n\n" + doc
+	}
+	return desc
+}
@@ -0,0 +1,60 @@
+package tooling
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/masp/garlang/parser"
+	"github.com/masp/garlang/token"
+	"github.com/stretchr/testify/require"
+)
+
+const hoverSrc = `module hover
+
+// add returns the sum
+// of a and b.
+func add(a, b) {
+	c = a + b
+	return c
+}
+
+func twice(x) { return add(x, x) }
+`
+
+// posOf returns the position of the nth occurrence of name in hoverSrc.
+func posOf(t *testing.T, file *token.File, name string, n int) token.Pos {
+	offset := -1
+	for i := 0; i <= n; i++ {
+		next := strings.Index(hoverSrc[offset+1:], name)
+		require.NotEqual(t, -1, next, "occurrence %d of %s", n, name)
+		offset += next + 1
+	}
+	return file.Pos(offset)
+}
+
+func TestHover(t *testing.T) {
+	mod, err := parser.Module("<test>", []byte(hoverSrc))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"add", 1, "function add/2\n\nadd returns the sum\nof a and b.\n"}, // declaration
+		{"add", 2, "function add/2\n\nadd returns the sum\nof a and b.\n"}, // call
+		{"a, b", 0, "parameter a"},
+		{"c =", 0, "variable c"},
+		{"x)", 0, "parameter x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := Hover(mod, posOf(t, mod.File, test.name, test.n))
+			require.True(t, ok)
+			require.Equal(t, test.want, got)
+		})
+	}
+
+	_, ok := Hover(mod, posOf(t, mod.File, "return", 0))
+	require.False(t, ok, "keywords have no hover info")
+}
@@ -0,0 +1,113 @@
+// Package types checks that values agree with the types declared for them.
+//
+// This is the start of a type checker. For now it only understands tuple types, and
+// checks that a tuple literal assigned to a variable with a declared tuple type has the
+// right number of elements, and that a type is declared only once.
+package types
+
+import (
+	"fmt"
+
+	"github.com/masp/garlang/ast"
+	"github.com/masp/garlang/token"
+)
+
+// Check type checks mod and returns an error listing every problem found.
+func Check(mod *ast.Module) error {
+	c := &checker{
+		file:  mod.File,
+		types: make(map[string]*ast.TypeDecl),
+	}
+	for _, decl := range mod.Decls {
+		if d, ok := decl.(*ast.TypeDecl); ok {
+			if prev, ok := c.types[d.Name.Name]; ok {
+				c.errorf(d.Name.Pos(), "type %s redefined, previous declaration at %s", d.Name.Name, c.file.Position(prev.Name.Pos()))
+				continue // the first declaration is the one that counts
+			}
+			c.types[d.Name.Name] = d
+		}
+	}
+	for _, decl := range mod.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			c.checkFunc(fn)
+		}
+	}
+	return c.errors.Err()
+}
+
+type checker struct {
+	file   *token.File
+	types  map[string]*ast.TypeDecl  // type declarations of the module
+	vars   map[string]*ast.TupleType // declared tuple type of the variables in the current function
+	errors token.ErrorList
+}
+
+func (c *checker) errorf(pos token.Pos, format string, args ...any) {
+	c.errors.Add(c.file.Position(pos), fmt.Errorf(format, args...))
+}
+
+// checkFunc checks every assignment in fn to a variable with a declared tuple type. The
+// type declared for a variable applies to every assignment to it after the declaration.
+func (c *checker) checkFunc(fn *ast.FuncDecl) {
+	c.vars = make(map[string]*ast.TupleType)
+	ast.Inspect(fn, func(node ast.Node) bool {
+		assign, ok := node.(*ast.AssignExpr)
+		if !ok {
+			return true
+		}
+		if assign.Type != nil {
+			c.vars[assign.Left.Name] = c.tupleType(assign.Type)
+		}
+		if typ := c.vars[assign.Left.Name]; typ != nil {
+			c.checkTuple(assign.Right, typ, assign.Left.Name)
+		}
+		return true
+	})
+}
+
+// tupleType returns the tuple type that typ refers to, following type declarations, or
+// nil if typ is not a tuple type.
+func (c *checker) tupleType(typ ast.Expression) *ast.TupleType {
+	seen := make(map[string]bool)
+	for {
+		switch t := typ.(type) {
+		case *ast.TupleType:
+			return t
+		case *ast.Identifier:
+			decl, ok := c.types[t.Name]
+			if !ok || seen[t.Name] {
+				return nil // built-in type or a declaration that refers to itself
+			}
+			seen[t.Name] = true
+			typ = decl.Definition
+		default:
+			return nil
+		}
+	}
+}
+
+// checkTuple checks that expr, if it is a tuple literal, has as many elements as typ,
+// and does the same for every element with a tuple type. what describes expr in errors.
+func (c *checker) checkTuple(expr ast.Expression, typ *ast.TupleType, what string) {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expression
+	}
+	tuple, ok := expr.(*ast.TupleExpr)
+	if !ok {
+		return
+	}
+	fields := typ.Elts.List
+	if n := typ.Elts.NumFields(); len(tuple.Elements) != n {
+		c.errorf(tuple.Pos(), "tuple has %d elements, but %s is a %d-tuple", len(tuple.Elements), what, n)
+		return
+	}
+	for i, elem := range tuple.Elements {
+		if elemType := c.tupleType(fields[i].Type); elemType != nil {
+			c.checkTuple(elem, elemType, fmt.Sprintf("element %d of %s", i+1, what))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/masp/garlang/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTupleArity(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr string
+	}{
+		{
+			input: `module test
+type Point tuple[int, int]
+func f() {
+	p: Point = {1, 2}
+	p = {3, 4}
+	return p
+}`,
+		},
+		{
+			input: `module test
+type Point tuple[int, int]
+func f() {
+	p: Point = {1, 2, 3}
+	return p
+}`,
+			wantErr: "<test>:4:13: tuple has 3 elements, but p is a 2-tuple",
+		},
+		{
+			// the declared type applies to later assignments
+			input: `module test
+func f() {
+	p: tuple[int, int] = {1, 2}
+	p = {1}
+	return p
+}`,
+			wantErr: "<test>:4:6: tuple has 1 elements, but p is a 2-tuple",
+		},
+		{
+			input: `module test
+type Point tuple[int, int]
+type Line tuple[Point, Point]
+func f() {
+	l: Line = {{0, 0}, ({1, 1, 1})}
+	return l
+}`,
+			wantErr: "<test>:5:22: tuple has 3 elements, but element 2 of l is a 2-tuple",
+		},
+		{
+			// a redefined type is reported, and the first declaration is used
+			input: `module test
+type Pair tuple[int, int]
+type Pair tuple[int]
+func f() {
+	p: Pair = {1, 2}
+	return p
+}`,
+			wantErr: "<test>:3:6: type Pair redefined, previous declaration at <test>:2:6",
+		},
+		{
+			// only tuple literals are checked
+			input: `module test
+type Point tuple[int, int]
+func f(x) {
+	p: Point = x
+	return p
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mod, err := parser.Module("<test>", []byte(tt.input))
+			require.NoError(t, err)
+
+			err = Check(mod)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}